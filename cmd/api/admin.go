@@ -0,0 +1,414 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/puremike/event-mgt-api/internal/storage"
+)
+
+type adminUserResponse struct {
+	ID              int                `json:"id"`
+	Name            string             `json:"name"`
+	Email           string             `json:"email"`
+	Role            storage.UserRole   `json:"role"`
+	Status          storage.UserStatus `json:"status"`
+	StatusReason    *string            `json:"status_reason,omitempty"`
+	SuspendedUntil  *time.Time         `json:"suspended_until,omitempty"`
+	EmailVerifiedAt *time.Time         `json:"email_verified_at"`
+	CreatedAt       time.Time          `json:"created_at"`
+}
+
+func newAdminUserResponse(user storage.User) adminUserResponse {
+	return adminUserResponse{
+		ID:              user.ID,
+		Name:            user.Name,
+		Email:           user.Email,
+		Role:            user.Role,
+		Status:          user.Status,
+		StatusReason:    user.StatusReason,
+		SuspendedUntil:  user.SuspendedUntil,
+		EmailVerifiedAt: user.EmailVerifiedAt,
+		CreatedAt:       user.CreatedAt,
+	}
+}
+
+// setUserStatusRequest suspends a user until the given time, or indefinitely
+// without until, bans them or reinstates them.
+type setUserStatusRequest struct {
+	Status storage.UserStatus `json:"status" binding:"required,oneof=active suspended banned"`
+	Reason *string            `json:"reason" binding:"omitempty,max=500"`
+	Until  *time.Time         `json:"until"`
+}
+
+type setUserRoleRequest struct {
+	Role storage.UserRole `json:"role" binding:"required,oneof=user moderator admin"`
+}
+
+type updateReportRequest struct {
+	Status storage.ReportStatus `json:"status" binding:"required,oneof=open resolved dismissed"`
+}
+
+// GetUsers godoc
+//
+//	@Summary		List users
+//	@Description	Lists users with their platform role and account status. q searches name and email. Requires a moderator or admin.
+//	@Tags			Admin
+//	@Produce		json
+//	@Param			q		query		string	false	"Search name and email"
+//	@Param			role	query		string	false	"Filter by role (user, moderator, admin)"
+//	@Param			status	query		string	false	"Filter by status (active, suspended, banned)"
+//	@Param			sort	query		string	false	"Sort by id (default), name, email or created_at"
+//	@Param			order	query		string	false	"asc (default) or desc"
+//	@Param			cursor	query		string	false	"Cursor from the previous page"
+//	@Param			limit	query		int		false	"Page size (default 20, max 100)"
+//	@Success		200		{object}	storage.Page[adminUserResponse]
+//	@Failure		400		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		500		{object}	error
+//	@Router			/admin/users [get]
+//	@Security		BearerAuth
+func (app *application) getUsers(c *gin.Context) {
+	page, err := parsePageParams(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	filter := storage.UserFilter{
+		Query:  c.Query("q"),
+		Role:   storage.UserRole(c.Query("role")),
+		Status: storage.UserStatus(c.Query("status")),
+	}
+
+	users, err := app.store.Users.GetUsers(c.Request.Context(), filter, page)
+	if err != nil {
+		if listQueryError(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve users"})
+		return
+	}
+
+	response := storage.Page[adminUserResponse]{
+		Data:       make([]adminUserResponse, 0, len(users.Data)),
+		NextCursor: users.NextCursor,
+		Total:      users.Total,
+	}
+	for _, user := range users.Data {
+		response.Data = append(response.Data, newAdminUserResponse(user))
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// SetUserStatus godoc
+//
+//	@Summary		Suspend, ban or reinstate user
+//	@Description	Changes a user's account status. Suspended and banned users are turned away at login and on every authenticated request, including with tokens issued before. Suspensions end on their own at until, if given. Moderators can suspend and reinstate users; only admins can ban or lift bans. Nobody can change the status of a user whose role is equal to or above their own.
+//	@Tags			Admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		int						true	"User ID"
+//	@Param			payload	body		setUserStatusRequest	true	"Status"
+//	@Success		200		{object}	adminUserResponse
+//	@Failure		400		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Router			/admin/users/{id}/status [put]
+//	@Security		BearerAuth
+func (app *application) setUserStatus(c *gin.Context) {
+	var payload setUserStatusRequest
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if payload.Until != nil {
+		if payload.Status != storage.UserStatusSuspended {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "until only applies to suspensions"})
+			return
+		}
+		if !payload.Until.After(time.Now()) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "until must be in the future"})
+			return
+		}
+	}
+
+	actor := app.getUserFromContext(c)
+	if payload.Status == storage.UserStatusBanned && !actor.Role.AtLeast(storage.UserRoleAdmin) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only admins can ban users"})
+		return
+	}
+
+	target, ok := app.moderatedUser(c, actor)
+	if !ok {
+		return
+	}
+
+	if target.Status == storage.UserStatusBanned && !actor.Role.AtLeast(storage.UserRoleAdmin) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only admins can lift bans"})
+		return
+	}
+
+	if err := app.store.Users.SetStatus(c.Request.Context(), target.ID, payload.Status, payload.Reason, payload.Until); err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update user status"})
+		return
+	}
+
+	app.respondWithUpdatedUser(c, target.ID)
+}
+
+// SetUserRole godoc
+//
+//	@Summary		Change user role
+//	@Description	Changes a user's platform role to user, moderator or admin. Admins cannot change their own role. Requires an admin.
+//	@Tags			Admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		int					true	"User ID"
+//	@Param			payload	body		setUserRoleRequest	true	"Role"
+//	@Success		200		{object}	adminUserResponse
+//	@Failure		400		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Router			/admin/users/{id}/role [put]
+//	@Security		BearerAuth
+func (app *application) setUserRole(c *gin.Context) {
+	var payload setUserRoleRequest
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user ID"})
+		return
+	}
+
+	if userId == app.getUserFromContext(c).ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "you cannot change your own role"})
+		return
+	}
+
+	if err := app.store.Users.SetRole(c.Request.Context(), userId, payload.Role); err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update user role"})
+		return
+	}
+
+	app.respondWithUpdatedUser(c, userId)
+}
+
+// UnlockUser godoc
+//
+//	@Summary		Unlock user login
+//	@Description	Clears the failed login attempts of a user's account, lifting a lockout. Attempts counted against client addresses are kept. Requires a moderator or admin.
+//	@Tags			Admin
+//	@Produce		json
+//	@Param			id	path		int		true	"User ID"
+//	@Success		204	{string}	string	"no content"
+//	@Failure		400	{object}	error
+//	@Failure		403	{object}	error
+//	@Failure		404	{object}	error
+//	@Failure		500	{object}	error
+//	@Router			/admin/users/{id}/lockout [delete]
+//	@Security		BearerAuth
+func (app *application) unlockUser(c *gin.Context) {
+	userId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user ID"})
+		return
+	}
+
+	user, err := app.store.Users.GetUserByID(c.Request.Context(), userId)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve user"})
+		return
+	}
+
+	if err := app.loginThrottle.Unlock(c.Request.Context(), user.ID, user.Email); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to unlock user"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ForceDeleteEvent godoc
+//
+//	@Summary		Force delete event
+//	@Description	Deletes any event, including all occurrences of a recurring event, regardless of who owns it. Requires a moderator or admin.
+//	@Tags			Admin
+//	@Produce		json
+//	@Param			id	path		int		true	"Event ID"
+//	@Success		204	{string}	string	"no content"
+//	@Failure		400	{object}	error
+//	@Failure		403	{object}	error
+//	@Failure		404	{object}	error
+//	@Failure		500	{object}	error
+//	@Router			/admin/events/{id} [delete]
+//	@Security		BearerAuth
+func (app *application) forceDeleteEvent(c *gin.Context) {
+	eventId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid event ID"})
+		return
+	}
+
+	if err := app.store.Events.DeleteEvent(c.Request.Context(), eventId); err != nil {
+		if errors.Is(err, storage.ErrEventNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "event not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete event"})
+		return
+	}
+
+	app.invalidateCachedEvent(c.Request.Context(), eventId)
+	app.invalidateEventLists(c.Request.Context(), eventId)
+
+	c.Status(http.StatusNoContent)
+}
+
+// GetReports godoc
+//
+//	@Summary		List reports
+//	@Description	Lists reports about events and users, oldest first. Requires a moderator or admin.
+//	@Tags			Admin
+//	@Produce		json
+//	@Param			status		query		string	false	"Filter by status (open, resolved, dismissed)"
+//	@Param			target_type	query		string	false	"Filter by target (event, user)"
+//	@Param			sort		query		string	false	"Sort by created_at (default) or id"
+//	@Param			order		query		string	false	"asc (default) or desc"
+//	@Param			cursor		query		string	false	"Cursor from the previous page"
+//	@Param			limit		query		int		false	"Page size (default 20, max 100)"
+//	@Success		200			{object}	storage.Page[storage.Report]
+//	@Failure		400			{object}	error
+//	@Failure		403			{object}	error
+//	@Failure		500			{object}	error
+//	@Router			/admin/reports [get]
+//	@Security		BearerAuth
+func (app *application) getReports(c *gin.Context) {
+	page, err := parsePageParams(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	filter := storage.ReportFilter{
+		Status:     storage.ReportStatus(c.Query("status")),
+		TargetType: storage.ReportTarget(c.Query("target_type")),
+	}
+
+	reports, err := app.store.Reports.GetReports(c.Request.Context(), filter, page)
+	if err != nil {
+		if listQueryError(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve reports"})
+		return
+	}
+
+	c.JSON(http.StatusOK, reports)
+}
+
+// UpdateReport godoc
+//
+//	@Summary		Resolve report
+//	@Description	Marks a report as resolved or dismissed, or reopens it. Requires a moderator or admin.
+//	@Tags			Admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		int					true	"Report ID"
+//	@Param			payload	body		updateReportRequest	true	"Status"
+//	@Success		200		{object}	storage.Report
+//	@Failure		400		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Router			/admin/reports/{id} [put]
+//	@Security		BearerAuth
+func (app *application) updateReport(c *gin.Context) {
+	var payload updateReportRequest
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	reportId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid report ID"})
+		return
+	}
+
+	report, err := app.store.Reports.ResolveReport(c.Request.Context(), reportId, payload.Status, app.getUserFromContext(c).ID)
+	if err != nil {
+		if errors.Is(err, storage.ErrReportNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "report not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update report"})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// moderatedUser loads the user in the id path parameter and checks that the
+// actor outranks them, writing the error response when they do not.
+func (app *application) moderatedUser(c *gin.Context, actor *storage.User) (*storage.User, bool) {
+	userId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user ID"})
+		return nil, false
+	}
+
+	target, err := app.store.Users.GetUserByID(c.Request.Context(), userId)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve user"})
+		return nil, false
+	}
+
+	if target.Role.AtLeast(actor.Role) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "you are not authorized to moderate this user"})
+		return nil, false
+	}
+
+	return target, true
+}
+
+// respondWithUpdatedUser drops the user from the cache so that the change
+// applies to their next request, and responds with the updated user.
+func (app *application) respondWithUpdatedUser(c *gin.Context, userId int) {
+	app.invalidateCachedUser(c.Request.Context(), userId)
+
+	user, err := app.store.Users.GetUserByID(c.Request.Context(), userId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve user"})
+		return
+	}
+
+	c.JSON(http.StatusOK, newAdminUserResponse(*user))
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/puremike/event-mgt-api/internal/auth"
+	"github.com/puremike/event-mgt-api/internal/storage"
+)
+
+// createAPIKeyRequest creates a key that can do everything without scopes
+// and never expires without expires_at.
+type createAPIKeyRequest struct {
+	Name      string     `json:"name" binding:"required,max=100"`
+	Scopes    []string   `json:"scopes" binding:"omitempty,dive,oneof=events:read events:write attendees:write"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type apiKeyResponse struct {
+	storage.APIKey
+	// Key is only returned when the key is created
+	Key string `json:"key"`
+}
+
+// CreateAPIKey godoc
+//
+//	@Summary		Create API key
+//	@Description	Creates a personal API key for scripts and integrations, sent as "Authorization: ApiKey <key>". Scopes (events:read, events:write, attendees:write) limit what the key can do; a key without scopes can do everything they cover. API keys cannot manage the account, its sessions or other API keys. The key is only shown once.
+//	@Tags			API Keys
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		createAPIKeyRequest	true	"API key"
+//	@Success		201		{object}	apiKeyResponse
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		500		{object}	error
+//	@Router			/api-keys [post]
+//	@Security		BearerAuth
+func (app *application) createAPIKey(c *gin.Context) {
+	var payload createAPIKeyRequest
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if payload.ExpiresAt != nil && !payload.ExpiresAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expires_at must be in the future"})
+		return
+	}
+
+	user := app.getUserFromContext(c)
+
+	token, prefix, hash, err := auth.GenerateAPIKey()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate API key"})
+		return
+	}
+
+	key := &storage.APIKey{
+		UserID:    user.ID,
+		Name:      payload.Name,
+		Prefix:    prefix,
+		KeyHash:   hash,
+		Scopes:    payload.Scopes,
+		ExpiresAt: payload.ExpiresAt,
+	}
+
+	if err := app.store.APIKeys.CreateAPIKey(c.Request.Context(), key); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create API key"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, apiKeyResponse{APIKey: *key, Key: token})
+}
+
+// GetAPIKeys godoc
+//
+//	@Summary		List API keys
+//	@Description	Lists the authenticated user's API keys that have not been revoked, newest first, with their prefix, scopes, expiry and when they were last used.
+//	@Tags			API Keys
+//	@Produce		json
+//	@Success		200	{array}		storage.APIKey
+//	@Failure		401	{object}	error
+//	@Failure		403	{object}	error
+//	@Failure		500	{object}	error
+//	@Router			/api-keys [get]
+//	@Security		BearerAuth
+func (app *application) getAPIKeys(c *gin.Context) {
+	user := app.getUserFromContext(c)
+
+	keys, err := app.store.APIKeys.GetAPIKeysByUser(c.Request.Context(), user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve API keys"})
+		return
+	}
+
+	c.JSON(http.StatusOK, keys)
+}
+
+// RevokeAPIKey godoc
+//
+//	@Summary		Revoke API key
+//	@Description	Revokes one of the authenticated user's API keys. Requests with the key are rejected from then on.
+//	@Tags			API Keys
+//	@Produce		json
+//	@Param			keyId	path		int		true	"API key ID"
+//	@Success		204		{string}	string	"no content"
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Router			/api-keys/{keyId} [delete]
+//	@Security		BearerAuth
+func (app *application) revokeAPIKey(c *gin.Context) {
+	keyId, err := strconv.Atoi(c.Param("keyId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid API key ID"})
+		return
+	}
+
+	user := app.getUserFromContext(c)
+
+	if err := app.store.APIKeys.RevokeAPIKey(c.Request.Context(), user.ID, keyId); err != nil {
+		if errors.Is(err, storage.ErrAPIKeyNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke API key"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -1,22 +1,34 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"github.com/puremike/event-mgt-api/internal/storage"
+	"github.com/puremike/event-mgt-api/internal/storage/cache"
 )
 
 // GetEventsOfAnAttendee  get the events of an attendee.
 //
 //	@Summary		Get Attendee events
-//	@Description	Get the list of events for a given attendee.
+//	@Description	Get the list of events for a given attendee, filtered, sorted and paginated with a keyset cursor. The list is empty for users who hide their attendance, except to themselves.
 //	@Tags			Attendees
 //	@Accept			json
 //	@Produce		json
-//	@Param			userId	path		int					true	"User ID"
-//	@Success		200		{object}	storage.Event		"Events successfully retrieved"
-//	@Failure		400		{object}	map[string]string	"Invalid user ID"
+//	@Param			userId		path		int										true	"User ID"
+//	@Param			from		query		string									false	"Only events on or after this date (RFC 3339 or YYYY-MM-DD)"
+//	@Param			to			query		string									false	"Only events on or before this date (RFC 3339 or YYYY-MM-DD)"
+//	@Param			location	query		string									false	"Case-insensitive location substring"
+//	@Param			owner_id	query		int										false	"Only events owned by this user"
+//	@Param			sort		query		string									false	"Sort field"	Enums(date, name, id)
+//	@Param			order		query		string									false	"Sort order"	Enums(asc, desc)
+//	@Param			cursor		query		string									false	"next_cursor from the previous page"
+//	@Param			limit		query		int										false	"Page size (max 100)"
+//	@Success		200			{object}	storage.Page[storage.AttendingEvent]	"Events successfully retrieved"
+//	@Failure		400			{object}	map[string]string						"Invalid user ID"
 //	@Failure		409		{object}	error
 //	@Failure		500		{object}	error
 //	@Router			/attendees/{userId}/events [get]
@@ -27,9 +39,45 @@ func (app *application) getEventsOfAttendee(c *gin.Context) {
 		return
 	}
 
-	events, err := app.store.Attendees.GetEventsOfAttendee(c.Request.Context(), userId)
+	filter, err := parseEventFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	page, err := parsePageParams(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// users who hide their attendance only see their own events
+	if viewer := app.getUserFromContext(c); viewer.ID != userId {
+		user, err := app.getUserFromCache(c.Request.Context(), userId)
+		if err != nil && !errors.Is(err, storage.ErrUserNotFound) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve events"})
+			return
+		}
+		if user != nil && user.Privacy.HideAttendance {
+			c.JSON(http.StatusOK, storage.Page[storage.AttendingEvent]{Data: []storage.AttendingEvent{}})
+			return
+		}
+	}
 
+	key := cache.ListKey("attending", userId, filter, page)
+	events, err := cache.FetchList(c.Request.Context(), &app.cacheStorage.Lists, key, func(ctx context.Context) (*storage.Page[storage.AttendingEvent], []string, error) {
+		events, err := app.store.Attendees.GetEventsOfAttendee(ctx, userId, filter, page)
+		if err != nil {
+			return nil, nil, err
+		}
+		// the page moves whenever any of the user's events changes
+		tags, err := app.attendeeTags(ctx, userId)
+		return events, tags, err
+	})
 	if err != nil {
+		if listQueryError(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve events"})
 		return
 	}
@@ -2,12 +2,12 @@ package main
 
 import (
 	"errors"
+	"math"
 	"net/http"
 	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/puremike/event-mgt-api/internal/storage"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -21,29 +21,40 @@ type registerUserRequest struct {
 type userResponse struct {
 	ID    int    `json:"id"`
 	Name  string `json:"name"`
-	Email string `json:"email"`
+	Email string `json:"email,omitempty"`
 }
 
+// dummyPasswordHash is compared against when logging in with an unknown
+// email. It uses the same cost as real password hashes.
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("not a real password"), bcrypt.DefaultCost)
+
 type loginRequest struct {
 	Email    string `json:"email" binding:"required,email"`
 	Password string `json:"password" binding:"required,min=8"`
 }
 
+// loginResponse carries a short-lived access token, valid until ExpiresAt,
+// and the single-use refresh token that renews it.
 type loginResponse struct {
-	Token string `json:"token"`
+	Token        string    `json:"token"`
+	RefreshToken string    `json:"refresh_token"`
+	ExpiresAt    time.Time `json:"expires_at"`
 }
 
 // loginUser handles user login and returns a JWT token if credentials are valid.
 //
 //	@Summary		Login User
-//	@Description	Authenticates a user using email and password, and returns a JWT token on success.
+//	@Description	Authenticates a user using email and password, and returns a short-lived JWT access token and a refresh token on success. Repeated failures for an account or from a client address slow down further attempts and eventually lock them out for a while. The access token carries the user's platform role in its role claim.
 //	@Tags			Users
 //	@Accept			json
 //	@Produce		json
 //	@Param			payload	body		loginRequest	true	"Login credentials"
-//	@Success		200		{object}	loginResponse
+//	@Success		200		{object}	loginResponse			"Logged in"
+//	@Success		200		{object}	mfaChallengeResponse	"Two-factor authentication required, continue with /auth/login/mfa"
 //	@Failure		400		{object}	gin.H	"Bad Request - invalid input"
 //	@Failure		401		{object}	gin.H	"Unauthorized - invalid credentials"
+//	@Failure		403		{object}	gin.H	"Forbidden - account suspended or banned, or email not verified"
+//	@Failure		429		{object}	gin.H	"Too Many Requests - too many failed attempts, see Retry-After"
 //	@Failure		500		{object}	gin.H	"Internal Server Error"
 //	@Router			/auth/login [post]
 //
@@ -55,42 +66,53 @@ func (app *application) loginUser(c *gin.Context) {
 		return
 	}
 
-	user, err := app.store.Users.GetUserByEmail(c.Request.Context(), payload.Email)
-	if err != nil {
-		if errors.Is(err, storage.ErrUserNotFound) {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid email or password"})
-			return
-		}
+	ctx := c.Request.Context()
+
+	if !app.checkLoginThrottle(c, payload.Email) {
+		return
+	}
+
+	user, err := app.store.Users.GetUserByEmail(ctx, payload.Email)
+	if err != nil && !errors.Is(err, storage.ErrUserNotFound) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve user"})
+		return
 	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(payload.Password)); err != nil {
+	// unknown emails are checked against a dummy hash so that they take as
+	// long to reject as wrong passwords
+	passwordHash := dummyPasswordHash
+	if user != nil {
+		passwordHash = []byte(user.Password)
+	}
+
+	if err := bcrypt.CompareHashAndPassword(passwordHash, []byte(payload.Password)); err != nil || user == nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid email or password"})
 		return
 	}
 
-	claims := jwt.MapClaims{
-		"sub": user.ID,
-		"exp": time.Now().Add(app.config.authConfig.tokenExp).Unix(),
-		"iat": time.Now().Unix(),
-		"nbf": time.Now().Unix(),
-		"iss": app.config.authConfig.iss,
-		"aud": app.config.authConfig.aud,
+	// with two-factor authentication the attempt only succeeds once the code
+	// is checked
+	if user.TOTPEnabledAt == nil {
+		app.loginSucceeded(c, payload.Email)
 	}
 
-	token, err := app.jWTAuthenticator.GenerateToken(claims)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate token"})
+	if !user.Active(time.Now()) {
+		c.JSON(http.StatusForbidden, gin.H{"error": accountStatusError(user)})
+		return
+	}
+
+	if user.EmailVerifiedAt == nil && !app.config.verification.allowLogin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "verify your email address to log in"})
 		return
 	}
 
-	c.JSON(http.StatusOK, loginResponse{Token: token})
+	app.respondWithLogin(c, user)
 }
 
 // RegisterUser godoc
 //
 //	@Summary		Register user
-//	@Description	Register a new user
+//	@Description	Register a new user. A link to verify the email address is mailed to them.
 //	@Tags			Users
 //	@Accept			json
 //	@Produce		json
@@ -125,6 +147,10 @@ func (app *application) registerUser(c *gin.Context) {
 		return
 	}
 
+	app.cacheUser(c.Request.Context(), user)
+
+	app.verifyEmailInBackground(user)
+
 	response := userResponse{
 		ID:    user.ID,
 		Name:  user.Name,
@@ -137,7 +163,7 @@ func (app *application) registerUser(c *gin.Context) {
 // GetuserById godoc
 //
 //	@Summary		Get User
-//	@Description	Get User by ID
+//	@Description	Get User by ID. The email address is only shown to the user themselves and to owners and co-organizers of events they attend, and users who hide their name on attendee lists are shown anonymously to everyone else.
 //	@Tags			Users
 //	@Accept			json
 //	@Produce		json
@@ -156,15 +182,61 @@ func (app *application) getUserById(c *gin.Context) {
 
 	user, err := app.store.Users.GetUserByID(c.Request.Context(), userId)
 	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve user"})
 		return
 	}
 
-	response := userResponse{
-		ID:    user.ID,
-		Name:  user.Name,
-		Email: user.Email,
+	// the user and the organizers of events they attend see them in full,
+	// everyone else as they appear on attendee lists
+	viewer := app.getUserFromContext(c)
+	full := viewer.ID != 0 && viewer.ID == user.ID
+	if !full && viewer.ID != 0 {
+		if full, err = app.store.Users.IsOrganizerOfAttendee(c.Request.Context(), viewer.ID, user.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve user"})
+			return
+		}
+	}
+
+	response := userResponse{ID: user.ID, Name: user.Name}
+	if full {
+		response.Email = user.Email
+	} else if !user.Privacy.ShowNameOnAttendeeLists {
+		response.Name = anonymousAttendeeName
 	}
 
 	c.JSON(http.StatusOK, response)
 }
+
+// checkLoginThrottle counts the attempt against the account and the client
+// address up front, and writes the error response and returns false while
+// either is locked out after failed attempts. Attempts count as failures
+// until loginSucceeded takes them back.
+func (app *application) checkLoginThrottle(c *gin.Context, email string) bool {
+	retryAfter, err := app.loginThrottle.Attempt(c.Request.Context(), email, c.ClientIP())
+	return allowAttempt(c, retryAfter, err)
+}
+
+// allowAttempt writes the error response and returns false when an attempt
+// could not be counted or has to wait.
+func allowAttempt(c *gin.Context, retryAfter time.Duration, err error) bool {
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check login attempts"})
+		return false
+	}
+	if retryAfter > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many failed login attempts, try again later"})
+		return false
+	}
+	return true
+}
+
+func (app *application) loginSucceeded(c *gin.Context, email string) {
+	if err := app.loginThrottle.Succeeded(c.Request.Context(), email, c.ClientIP()); err != nil {
+		app.logger.Errorw("failed to reset login attempts", "error", err)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+
+	"github.com/puremike/event-mgt-api/internal/storage"
+	"github.com/puremike/event-mgt-api/internal/storage/cache"
+)
+
+// Every change to a user or an event goes through the helpers below, so that
+// the next request sees it instead of the cached copy. Handlers that get the
+// changed row back from the store write it through to the cache; the others
+// drop the cached copy. Changes also drop the cached lists tagged with what
+// they changed.
+
+func (app *application) cacheUser(ctx context.Context, user *storage.User) {
+	if err := app.cacheStorage.Users.Set(ctx, user); err != nil {
+		app.logger.Errorw("failed to set user in cache", "id", user.ID, "error", err)
+		app.invalidateCachedUser(ctx, user.ID)
+	}
+}
+
+func (app *application) invalidateCachedUser(ctx context.Context, userId int) {
+	if err := app.cacheStorage.Users.Delete(ctx, userId); err != nil {
+		app.logger.Errorw("failed to delete user from cache", "id", userId, "error", err)
+	}
+}
+
+func (app *application) cacheEvent(ctx context.Context, event *storage.Event) {
+	if err := app.cacheStorage.Events.Set(ctx, event); err != nil {
+		app.logger.Errorw("failed to set event in cache", "id", event.ID, "error", err)
+		app.invalidateCachedEvent(ctx, event.ID)
+	}
+}
+
+func (app *application) invalidateCachedEvent(ctx context.Context, eventIds ...int) {
+	for _, id := range eventIds {
+		if err := app.cacheStorage.Events.Delete(ctx, id); err != nil {
+			app.logger.Errorw("failed to delete event from cache", "id", id, "error", err)
+		}
+	}
+}
+
+func (app *application) invalidateLists(ctx context.Context, tags ...string) {
+	if err := app.cacheStorage.Lists.Invalidate(ctx, tags...); err != nil {
+		app.logger.Errorw("failed to invalidate cached lists", "tags", tags, "error", err)
+	}
+}
+
+// invalidateEventLists drops the event listings and the lists tagged with
+// any of the events.
+func (app *application) invalidateEventLists(ctx context.Context, eventIds ...int) {
+	app.invalidateLists(ctx, append(eventTags(eventIds...), cache.EventsTag)...)
+}
+
+// invalidateAttendanceLists drops the lists that change when the user joins
+// or leaves the event.
+func (app *application) invalidateAttendanceLists(ctx context.Context, eventId, userId int) {
+	app.invalidateLists(ctx, cache.EventTag(eventId), cache.UserTag(userId))
+}
+
+func eventTags(eventIds ...int) []string {
+	tags := make([]string, 0, len(eventIds))
+	for _, id := range eventIds {
+		tags = append(tags, cache.EventTag(id))
+	}
+	return tags
+}
+
+// attendeeTags tags the lists the user shows up on: their own events and the
+// attendees of the events they attend or are waitlisted for.
+func (app *application) attendeeTags(ctx context.Context, userId int) ([]string, error) {
+	eventIds, err := app.store.Attendees.GetEventIDsOfAttendee(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	return append(eventTags(eventIds...), cache.UserTag(userId)), nil
+}
+
+// invalidateAttendeeLists drops the lists the user shows up on. Without the
+// user's events only their own list is dropped, and the attendee lists are
+// left to expire.
+func (app *application) invalidateAttendeeLists(ctx context.Context, userId int) {
+	tags, err := app.attendeeTags(ctx, userId)
+	if err != nil {
+		app.logger.Errorw("failed to retrieve events of attendee", "id", userId, "error", err)
+		tags = []string{cache.UserTag(userId)}
+	}
+	app.invalidateLists(ctx, tags...)
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/puremike/event-mgt-api/internal/auth"
+	"github.com/puremike/event-mgt-api/internal/ical"
+	"github.com/puremike/event-mgt-api/internal/storage"
+)
+
+const icalProdID = "-//event-mgt-api//Event Management API//EN"
+
+type calendarFeedResponse struct {
+	Token string `json:"token"`
+	URL   string `json:"url"`
+}
+
+// GetEventICS godoc
+//
+//	@Summary		Export event as iCalendar
+//	@Description	Returns the event as an RFC 5545 iCalendar file that can be imported into Google, Apple or Outlook calendars. Recurring events are exported with their RRULE, EXDATEs and changed occurrences.
+//	@Tags			Calendar
+//	@Produce		text/calendar
+//	@Param			id	path		int		true	"Event ID"
+//	@Success		200	{string}	string	"iCalendar document"
+//	@Failure		400	{object}	error
+//	@Failure		404	{object}	error
+//	@Failure		500	{object}	error
+//	@Router			/events/{id}/ics [get]
+func (app *application) getEventICS(c *gin.Context) {
+	event := app.getEventFromContext(c)
+	now := time.Now()
+
+	cal := &ical.Calendar{
+		ProdID: icalProdID,
+		Name:   event.Name,
+		Events: []ical.Event{app.icalEvent(event, ical.StatusConfirmed, now)},
+	}
+
+	if event.Recurring() {
+		overrides, err := app.store.Events.GetOccurrenceOverrides(c.Request.Context(), event.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve event"})
+			return
+		}
+
+		for _, o := range overrides {
+			occurrence := app.icalEvent(event, ical.StatusConfirmed, now)
+			occurrence.RRule, occurrence.ExDates = "", nil
+			occurrence.RecurrenceID = &o.OccurrenceStart
+			occurrence.Start, occurrence.End = o.StartsAt, o.EndsAt
+			occurrence.Summary, occurrence.Description, occurrence.Location = o.Name, o.Description, o.Location
+			cal.Events = append(cal.Events, occurrence)
+		}
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="event-%d.ics"`, event.ID))
+	app.writeCalendar(c, cal)
+}
+
+// GetUserCalendarFeed godoc
+//
+//	@Summary		User calendar feed
+//	@Description	Subscribable iCalendar feed of every event, or occurrence of a recurring event, the user is going to or might attend. Authenticated with the feed token from POST /calendar/feed-token instead of a JWT.
+//	@Tags			Calendar
+//	@Produce		text/calendar
+//	@Param			id		path		int		true	"User ID"
+//	@Param			token	query		string	true	"Calendar feed token"
+//	@Success		200		{string}	string	"iCalendar document"
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Router			/users/{id}/calendar.ics [get]
+func (app *application) getUserCalendarFeed(c *gin.Context) {
+	userId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user ID"})
+		return
+	}
+
+	// an unknown token and a token for another user look the same so that
+	// feed URLs cannot be probed
+	tokenUserId, err := app.store.Calendar.GetFeedTokenUserID(c.Request.Context(), auth.HashToken(c.Query("token")))
+	if err != nil && !errors.Is(err, storage.ErrFeedTokenNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve calendar feed"})
+		return
+	}
+	if err != nil || tokenUserId != userId {
+		c.JSON(http.StatusNotFound, gin.H{"error": "calendar feed not found"})
+		return
+	}
+
+	cal := &ical.Calendar{ProdID: icalProdID, Name: "My events"}
+	now := time.Now()
+
+	page := storage.PageParams{Sort: "date", Limit: storage.MaxPageLimit}
+	for {
+		events, err := app.store.Attendees.GetEventsOfAttendee(c.Request.Context(), userId, storage.EventFilter{ViewerID: userId}, page)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve events"})
+			return
+		}
+
+		for _, e := range events.Data {
+			var status string
+			switch e.Status {
+			case storage.RSVPGoing:
+				status = ical.StatusConfirmed
+			case storage.RSVPMaybe:
+				status = ical.StatusTentative
+			default:
+				continue
+			}
+
+			event := app.icalEvent(&e.Event, status, now)
+			// the feed only holds the occurrences the user attends, so each
+			// is published as an event of its own rather than as part of
+			// the series
+			if e.OccurrenceStart != nil {
+				event.UID = fmt.Sprintf("event-%d-%s@%s", e.ID, e.OccurrenceStart.UTC().Format("20060102T150405Z"), app.config.authConfig.iss)
+			}
+			cal.Events = append(cal.Events, event)
+		}
+
+		if events.NextCursor == "" {
+			break
+		}
+		page.Cursor = events.NextCursor
+	}
+
+	app.writeCalendar(c, cal)
+}
+
+// CreateCalendarFeedToken godoc
+//
+//	@Summary		Create calendar feed token
+//	@Description	Issues a new calendar feed token for the authenticated user and revokes the previous one. The token is only shown once.
+//	@Tags			Calendar
+//	@Produce		json
+//	@Success		201	{object}	calendarFeedResponse
+//	@Failure		500	{object}	error
+//	@Router			/calendar/feed-token [post]
+//	@Security		BearerAuth
+func (app *application) createCalendarFeedToken(c *gin.Context) {
+	user := app.getUserFromContext(c)
+
+	token, hash, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate feed token"})
+		return
+	}
+
+	if err := app.store.Calendar.RotateFeedToken(c.Request.Context(), user.ID, hash); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save feed token"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, calendarFeedResponse{
+		Token: token,
+		URL:   fmt.Sprintf("%s/api/v1/users/%d/calendar.ics?token=%s", app.config.baseURL, user.ID, token),
+	})
+}
+
+// RevokeCalendarFeedToken godoc
+//
+//	@Summary		Revoke calendar feed token
+//	@Description	Revokes the authenticated user's calendar feed token so existing subscriptions stop working.
+//	@Tags			Calendar
+//	@Produce		json
+//	@Success		204	{string}	string	"no content"
+//	@Failure		404	{object}	error
+//	@Failure		500	{object}	error
+//	@Router			/calendar/feed-token [delete]
+//	@Security		BearerAuth
+func (app *application) revokeCalendarFeedToken(c *gin.Context) {
+	user := app.getUserFromContext(c)
+
+	if err := app.store.Calendar.RevokeFeedTokens(c.Request.Context(), user.ID); err != nil {
+		if errors.Is(err, storage.ErrFeedTokenNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "no active feed token"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke feed token"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// icalEvent converts an event into a VEVENT. Times are exported in UTC, which
+// every calendar client converts into the viewer's zone without needing a
+// VTIMEZONE definition. Recurring events are exported in their own zone
+// instead so that occurrences keep their local time across DST changes.
+func (app *application) icalEvent(e *storage.Event, status string, stamp time.Time) ical.Event {
+	var tzid string
+	if e.Recurring() {
+		tzid = e.Timezone
+	}
+
+	return ical.Event{
+		UID:         fmt.Sprintf("event-%d@%s", e.ID, app.config.authConfig.iss),
+		Stamp:       stamp,
+		Start:       e.StartsAt,
+		End:         e.EndsAt,
+		TZID:        tzid,
+		RRule:       e.RRule,
+		ExDates:     e.ExDates,
+		Summary:     e.Name,
+		Description: e.Description,
+		Location:    e.Location,
+		URL:         fmt.Sprintf("%s/api/v1/events/%d", app.config.baseURL, e.ID),
+		Status:      status,
+	}
+}
+
+func (app *application) writeCalendar(c *gin.Context, cal *ical.Calendar) {
+	c.Header("Content-Type", "text/calendar; charset=utf-8")
+	c.Status(http.StatusOK)
+
+	if err := cal.Encode(c.Writer); err != nil {
+		app.logger.Errorw("failed to write calendar", "error", err)
+	}
+}
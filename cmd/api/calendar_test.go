@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/puremike/event-mgt-api/internal/ical"
+	"github.com/puremike/event-mgt-api/internal/storage"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+func TestICalEvent(t *testing.T) {
+	app := &application{config: &config{
+		baseURL:    "https://api.example.com",
+		authConfig: authConfig{iss: "events.example.com"},
+	}}
+	stamp := time.Date(2025, 3, 1, 9, 30, 0, 0, time.UTC)
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		event  storage.Event
+		status string
+	}{
+		{
+			// one-off events are written in UTC whatever their zone
+			name: "event",
+			event: storage.Event{
+				ID:          7,
+				Name:        "Launch party, with friends",
+				Description: "Bring snacks; drinks\nare provided",
+				StartsAt:    time.Date(2025, 6, 20, 19, 0, 0, 0, berlin),
+				EndsAt:      time.Date(2025, 6, 20, 23, 0, 0, 0, berlin),
+				Timezone:    "Europe/Berlin",
+				Location:    "Rooftop",
+			},
+			status: ical.StatusConfirmed,
+		},
+		{
+			// the series crosses the end of DST on 26 October and keeps its
+			// local start time
+			name: "recurring",
+			event: storage.Event{
+				ID:       8,
+				Name:     "Weekly standup",
+				StartsAt: time.Date(2025, 10, 13, 9, 0, 0, 0, berlin),
+				EndsAt:   time.Date(2025, 10, 13, 9, 15, 0, 0, berlin),
+				Timezone: "Europe/Berlin",
+				RRule:    "FREQ=WEEKLY;BYDAY=MO;COUNT=4",
+				ExDates:  []time.Time{time.Date(2025, 10, 27, 9, 0, 0, 0, berlin)},
+			},
+			status: ical.StatusTentative,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cal := &ical.Calendar{
+				ProdID: icalProdID,
+				Events: []ical.Event{app.icalEvent(&tt.event, tt.status, stamp)},
+			}
+			var b bytes.Buffer
+			if err := cal.Encode(&b); err != nil {
+				t.Fatal(err)
+			}
+
+			golden := filepath.Join("testdata", tt.name+".ics")
+			if *update {
+				if err := os.WriteFile(golden, b.Bytes(), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(b.Bytes(), want) {
+				t.Errorf("icalEvent() encodes as\n%s\nwant\n%s", b.Bytes(), want)
+			}
+		})
+	}
+}
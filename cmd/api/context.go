@@ -29,3 +29,25 @@ func (app *application) getEventFromContext(c *gin.Context) *storage.Event {
 	}
 	return event
 }
+
+func (app *application) getAccessTokenFromContext(c *gin.Context) accessToken {
+	contextToken, exists := c.Get("accessToken")
+	if !exists {
+		return accessToken{}
+	}
+
+	token, _ := contextToken.(accessToken)
+	return token
+}
+
+// getAPIKeyFromContext returns the API key the request was authenticated
+// with, or nil when it was not.
+func (app *application) getAPIKeyFromContext(c *gin.Context) *storage.APIKey {
+	contextKey, exists := c.Get("apiKey")
+	if !exists {
+		return nil
+	}
+
+	key, _ := contextKey.(*storage.APIKey)
+	return key
+}
@@ -1,28 +1,87 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"net/http"
 	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/puremike/event-mgt-api/internal/rrule"
 	"github.com/puremike/event-mgt-api/internal/storage"
+	"github.com/puremike/event-mgt-api/internal/storage/cache"
 )
 
+// createEventRequest takes RFC 3339 start and end times. Timezone is the IANA
+// zone the event takes place in and defaults to UTC, and visibility defaults
+// to public. An RRULE makes the event recurring, with starts_at and ends_at
+// describing the first occurrence and exdates listing the start times of
+// skipped occurrences.
 type createEventRequest struct {
-	Name        string `json:"name" binding:"required,min=3"`
-	Description string `json:"description" binding:"required,min=10"`
-	Date        string `json:"date" binding:"required,datetime=2006-01-02"`
-	Location    string `json:"location" binding:"required,min=3"`
+	Name        string      `json:"name" binding:"required,min=3"`
+	Description string      `json:"description" binding:"required,min=10"`
+	StartsAt    time.Time   `json:"starts_at" binding:"required" example:"2025-06-01T19:00:00+01:00"`
+	EndsAt      time.Time   `json:"ends_at" binding:"required,gtfield=StartsAt" example:"2025-06-01T22:00:00+01:00"`
+	Timezone    string      `json:"timezone" binding:"omitempty,timezone" example:"Africa/Lagos"`
+	Location    string      `json:"location" binding:"required,min=3"`
+	Capacity    *int        `json:"capacity" binding:"omitempty,min=1"`
+	Visibility  string      `json:"visibility" binding:"omitempty,oneof=public unlisted private"`
+	RRule       string      `json:"rrule" example:"FREQ=WEEKLY;BYDAY=MO"`
+	ExDates     []time.Time `json:"exdates"`
+}
+
+// validate checks the recurrence rule, which the binding tags cannot.
+func (r *createEventRequest) validate() error {
+	if r.RRule == "" {
+		if len(r.ExDates) > 0 {
+			return errors.New("exdates require an rrule")
+		}
+		return nil
+	}
+
+	_, err := rrule.Parse(r.RRule)
+	return err
+}
+
+func (r *createEventRequest) event(ownerId int) *storage.Event {
+	timezone := r.Timezone
+	if timezone == "" {
+		timezone = "UTC"
+	}
+
+	visibility := r.Visibility
+	if visibility == "" {
+		visibility = storage.VisibilityPublic
+	}
+
+	return &storage.Event{
+		OwnerID:     ownerId,
+		Name:        r.Name,
+		Description: r.Description,
+		StartsAt:    r.StartsAt,
+		EndsAt:      r.EndsAt,
+		Timezone:    timezone,
+		Location:    r.Location,
+		Capacity:    r.Capacity,
+		Visibility:  visibility,
+		RRule:       r.RRule,
+		ExDates:     r.ExDates,
+	}
 }
 
 type eventResponse struct {
-	OwnerID     int    `json:"owner_id"`
-	Name        string `json:"name"`
-	Description string `json:"description"`
-	Date        string `json:"date"`
-	Location    string `json:"location"`
+	OwnerID     int         `json:"owner_id"`
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	StartsAt    time.Time   `json:"starts_at"`
+	EndsAt      time.Time   `json:"ends_at"`
+	Timezone    string      `json:"timezone"`
+	Location    string      `json:"location"`
+	Capacity    *int        `json:"capacity"`
+	Visibility  string      `json:"visibility"`
+	RRule       string      `json:"rrule,omitempty"`
+	ExDates     []time.Time `json:"exdates,omitempty"`
 }
 
 // CreateEvent godoc
@@ -47,37 +106,33 @@ func (app *application) createEvent(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-
-	date, err := time.Parse("2006-01-02", payload.Date)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid date format. expected YYYY-MM-DD"})
+	if err := payload.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	event := &storage.Event{
-		OwnerID:     c.GetInt("userId"),
-		Name:        payload.Name,
-		Description: payload.Description,
-		Date:        date,
-		Location:    payload.Location,
-	}
+	event := payload.event(c.GetInt("userId"))
 
 	if err := app.store.Events.CreateEvent(c.Request.Context(), event); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create event"})
 		return
 	}
 
+	app.cacheEvent(c.Request.Context(), event)
+	app.invalidateEventLists(c.Request.Context())
+
 	c.JSON(http.StatusCreated, event)
 }
 
 // GetEventByID godoc
 //
 //	@Summary		Get Event
-//	@Description	Get Event by ID
+//	@Description	Get Event by ID. Private events are only visible to their owner, invitees and attendees, or with a valid invitation token.
 //	@Tags			Events
 //	@Accept			json
 //	@Produce		json
-//	@Param			id	path		int	true	"Event ID"
+//	@Param			id		path		int		true	"Event ID"
+//	@Param			invite	query		string	false	"Invitation token"
 //	@Success		200	{object}	storage.Event
 //	@Failure		400	{object}	error
 //	@Failure		404	{object}	error
@@ -91,39 +146,145 @@ func (app *application) getEventById(c *gin.Context) {
 // GetEvents godoc
 //
 //	@Summary		Get Events
-//	@Description	Get All Events
+//	@Description	Get public events, filtered, sorted and paginated with a keyset cursor. Unlisted and private events are only listed for their owner. With expand=true recurring events are expanded into their occurrences between from and to, which are then required and may be at most a year apart; expanded listings only sort by date.
 //	@Tags			Events
 //	@Accept			json
 //	@Produce		json
-//	@Success		200	{object}	storage.Event
-//	@Failure		400	{object}	error
-//	@Failure		404	{object}	error
-//	@Failure		500	{object}	error
+//	@Param			expand		query		bool	false	"Expand recurring events into occurrences"
+//	@Param			from		query		string	false	"Only events on or after this date (RFC 3339 or YYYY-MM-DD)"
+//	@Param			to			query		string	false	"Only events on or before this date (RFC 3339 or YYYY-MM-DD)"
+//	@Param			location	query		string	false	"Case-insensitive location substring"
+//	@Param			owner_id	query		int		false	"Only events owned by this user"
+//	@Param			sort		query		string	false	"Sort field"	Enums(date, name, id)
+//	@Param			order		query		string	false	"Sort order"	Enums(asc, desc)
+//	@Param			cursor		query		string	false	"next_cursor from the previous page"
+//	@Param			limit		query		int		false	"Page size (max 100)"
+//	@Success		200			{object}	storage.Page[storage.Event]
+//	@Failure		400			{object}	error
+//	@Failure		404			{object}	error
+//	@Failure		500			{object}	error
 //	@Router			/events [get]
 func (app *application) getAllEvents(c *gin.Context) {
 
-	events, err := app.store.Events.GetAllEvents(c.Request.Context())
+	filter, err := parseEventFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	filter.ListedOnly = true
+
+	page, err := parsePageParams(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if c.Query("expand") == "true" {
+		app.getEventOccurrences(c, filter, page)
+		return
+	}
+
+	events, err := cache.FetchList(c.Request.Context(), &app.cacheStorage.Lists, cache.ListKey("events", filter, page), func(ctx context.Context) (*storage.Page[storage.Event], []string, error) {
+		events, err := app.store.Events.GetAllEvents(ctx, filter, page)
+		return events, []string{cache.EventsTag}, err
+	})
 	if err != nil {
+		if listQueryError(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve events"})
 		return
 	}
 	c.JSON(http.StatusOK, events)
 }
 
+func (app *application) getEventOccurrences(c *gin.Context, filter storage.EventFilter, page storage.PageParams) {
+	if filter.From != nil && filter.To != nil && filter.To.Sub(*filter.From) > maxOccurrenceWindow {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from and to may be at most a year apart when expanding occurrences"})
+		return
+	}
+
+	occurrences, err := cache.FetchList(c.Request.Context(), &app.cacheStorage.Lists, cache.ListKey("occurrences", filter, page), func(ctx context.Context) (*storage.Page[storage.Occurrence], []string, error) {
+		occurrences, err := app.store.Events.GetEventOccurrences(ctx, filter, page)
+		return occurrences, []string{cache.EventsTag}, err
+	})
+	if err != nil {
+		if errors.Is(err, storage.ErrOccurrenceWindowRequired) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from and to are required when expanding occurrences"})
+			return
+		}
+		if listQueryError(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve events"})
+		return
+	}
+	c.JSON(http.StatusOK, occurrences)
+}
+
+// SearchEvents godoc
+//
+//	@Summary		Search events
+//	@Description	Full-text search over public event name, description and location, ranked by relevance. Words are matched as prefixes, so partial input works for autocomplete. Filters combine with the search. name_highlight and snippet are HTML-escaped text with the matched words wrapped in <mark> tags, safe to insert as HTML.
+//	@Tags			Events
+//	@Accept			json
+//	@Produce		json
+//	@Param			q			query		string	true	"Search text"
+//	@Param			from		query		string	false	"Only events on or after this date (RFC 3339 or YYYY-MM-DD)"
+//	@Param			to			query		string	false	"Only events on or before this date (RFC 3339 or YYYY-MM-DD)"
+//	@Param			location	query		string	false	"Case-insensitive location substring"
+//	@Param			owner_id	query		int		false	"Only events owned by this user"
+//	@Param			limit		query		int		false	"Maximum number of results (max 100)"
+//	@Success		200			{object}	storage.Page[storage.EventSearchResult]
+//	@Failure		400			{object}	error
+//	@Failure		500			{object}	error
+//	@Router			/events/search [get]
+func (app *application) searchEvents(c *gin.Context) {
+
+	filter, err := parseEventFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	filter.ListedOnly = true
+
+	page, err := parsePageParams(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	results, err := app.store.Events.SearchEvents(c.Request.Context(), c.Query("q"), filter, page.Limit)
+	if err != nil {
+		if errors.Is(err, storage.ErrEmptySearchQuery) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "search query q is required"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to search events"})
+		return
+	}
+	c.JSON(http.StatusOK, results)
+}
+
 // UpdateEvent godoc
 //
 //	@Summary		Update event
-//	@Description	Update event by ID
+//	@Description	Update event by ID. For recurring events scope selects what is changed: a single occurrence (this), an occurrence and all later ones (following), which continues the series as a new event, or the whole series (all, the default).
 //	@Tags			Events
 //	@Accept			json
 //	@Produce		json
-//	@Param			payload	body		createEventRequest	true	"Event payload"
-//	@Param			id		path		int					true	"Event ID"
+//	@Param			payload		body		createEventRequest	true	"Event payload"
+//	@Param			id			path		int					true	"Event ID"
+//	@Param			scope		query		string				false	"Which occurrences to change"	Enums(this, following, all)
+//	@Param			occurrence	query		string				false	"Original RFC 3339 start time of the occurrence, required for this and following"
 //
-//	@Success		200		{object}	eventResponse	"Event successfully updated"
-//	@Failure		400		{object}	error
-//	@Failure		404		{object}	error
-//	@Failure		500		{object}	error
+//	@Success		200			{object}	eventResponse				"Event successfully updated"
+//	@Success		201			{object}	storage.Event				"Following occurrences split off into a new event"
+//	@Failure		400			{object}	error
+//	@Failure		404			{object}	error
+//	@Failure		500			{object}	error
 //	@Router			/events/{id} [put]
 //	@Security		BearerAuth
 func (app *application) updateEvent(c *gin.Context) {
@@ -133,30 +294,29 @@ func (app *application) updateEvent(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-
-	// parsing the date
-	date, err := time.Parse("2006-01-02", payload.Date)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid date format, expected YYYY-MM-DD"})
+	if err := payload.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	user := app.getUserFromContext(c)
 	existingEvent := app.getEventFromContext(c)
 
-	if existingEvent.OwnerID != user.ID {
-		c.JSON(http.StatusForbidden, gin.H{"error": "you are not authorized to update this event"})
+	scope, occurrence, ok := parseEditScope(c, existingEvent)
+	if !ok {
 		return
 	}
 
-	event := &storage.Event{
-		OwnerID:     user.ID,
-		Name:        payload.Name,
-		Description: payload.Description,
-		Date:        date,
-		Location:    payload.Location,
+	switch scope {
+	case scopeThis:
+		app.updateOccurrence(c, existingEvent, *occurrence, &payload)
+		return
+	case scopeFollowing:
+		app.splitSeries(c, existingEvent, *occurrence, payload.event(existingEvent.OwnerID))
+		return
 	}
 
+	event := payload.event(existingEvent.OwnerID)
+
 	updatedEvent, err := app.store.Events.UpdateEvent(c.Request.Context(), event, existingEvent.ID)
 
 	if err != nil {
@@ -164,75 +324,143 @@ func (app *application) updateEvent(c *gin.Context) {
 		return
 	}
 
+	app.cacheEvent(c.Request.Context(), updatedEvent)
+	app.invalidateEventLists(c.Request.Context(), updatedEvent.ID)
+
 	response := eventResponse{
 		OwnerID:     updatedEvent.OwnerID,
 		Name:        updatedEvent.Name,
 		Description: updatedEvent.Description,
-		Date:        updatedEvent.Date.Format("2006-01-02"),
+		StartsAt:    updatedEvent.StartsAt,
+		EndsAt:      updatedEvent.EndsAt,
+		Timezone:    updatedEvent.Timezone,
 		Location:    updatedEvent.Location,
+		Capacity:    updatedEvent.Capacity,
+		Visibility:  updatedEvent.Visibility,
+		RRule:       updatedEvent.RRule,
+		ExDates:     updatedEvent.ExDates,
 	}
 
 	c.JSON(http.StatusOK, response)
 }
 
+// updateOccurrence changes the details of a single occurrence. Recurrence,
+// time zone and capacity belong to the series and are ignored.
+func (app *application) updateOccurrence(c *gin.Context, event *storage.Event, occurrence time.Time, payload *createEventRequest) {
+	override := &storage.OccurrenceOverride{
+		OccurrenceStart: occurrence,
+		Name:            payload.Name,
+		Description:     payload.Description,
+		StartsAt:        payload.StartsAt,
+		EndsAt:          payload.EndsAt,
+		Location:        payload.Location,
+	}
+
+	if err := app.store.Events.SetOccurrenceOverride(c.Request.Context(), event.ID, override); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update occurrence"})
+		return
+	}
+
+	app.invalidateCachedEvent(c.Request.Context(), event.ID)
+	app.invalidateEventLists(c.Request.Context(), event.ID)
+
+	c.JSON(http.StatusOK, override)
+}
+
+// splitSeries ends the series before the occurrence and continues it as the
+// new event next. Without an RRULE of its own next keeps repeating like the
+// rest of the original series.
+func (app *application) splitSeries(c *gin.Context, event *storage.Event, occurrence time.Time, next *storage.Event) {
+	if next.RRule == "" {
+		rule, err := rrule.Parse(event.RRule)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update event"})
+			return
+		}
+		_, tail := rule.Split(event.StartsAt, occurrence)
+		next.RRule = tail.String()
+	}
+
+	if err := app.store.Events.SplitSeries(c.Request.Context(), event, occurrence, next); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update event"})
+		return
+	}
+
+	app.invalidateCachedEvent(c.Request.Context(), event.ID)
+	app.cacheEvent(c.Request.Context(), next)
+	app.invalidateEventLists(c.Request.Context(), event.ID)
+
+	c.JSON(http.StatusCreated, next)
+}
+
 // DeleteEvent godoc
 //
 //	@Summary		Delete event
-//	@Description	Delete event by ID
+//	@Description	Delete event by ID. For recurring events scope selects what is deleted: a single occurrence (this), an occurrence and all later ones (following) or the whole series (all, the default).
 //	@Tags			Events
 //	@Accept			json
 //	@Produce		json
-//	@Param			id	path		int		true	"Event ID"
+//	@Param			id			path		int		true	"Event ID"
+//	@Param			scope		query		string	false	"Which occurrences to delete"	Enums(this, following, all)
+//	@Param			occurrence	query		string	false	"Original RFC 3339 start time of the occurrence, required for this and following"
 //
-//	@Success		204	{string}	string	"no content"
-//	@Failure		400	{object}	error
-//	@Failure		404	{object}	error
-//	@Failure		500	{object}	error
+//	@Success		204			{string}	string	"no content"
+//	@Failure		400			{object}	error
+//	@Failure		404			{object}	error
+//	@Failure		500			{object}	error
 //	@Router			/events/{id} [delete]
 //	@Security		BearerAuth
 func (app *application) deleteEvent(c *gin.Context) {
 
 	existingEvent := app.getEventFromContext(c)
-	user := app.getUserFromContext(c)
 
-	if existingEvent.OwnerID != user.ID {
-		c.JSON(http.StatusForbidden, gin.H{"error": "you are not authorized to delete this event"})
+	scope, occurrence, ok := parseEditScope(c, existingEvent)
+	if !ok {
 		return
 	}
 
-	if err := app.store.Events.DeleteEvent(c.Request.Context(), existingEvent.ID); err != nil {
+	var err error
+	switch scope {
+	case scopeThis:
+		err = app.store.Events.CancelOccurrence(c.Request.Context(), existingEvent.ID, *occurrence)
+	case scopeFollowing:
+		err = app.store.Events.EndSeries(c.Request.Context(), existingEvent, *occurrence)
+	default:
+		err = app.store.Events.DeleteEvent(c.Request.Context(), existingEvent.ID)
+	}
+
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete event"})
 		return
 	}
 
+	app.invalidateCachedEvent(c.Request.Context(), existingEvent.ID)
+	app.invalidateEventLists(c.Request.Context(), existingEvent.ID)
+
 	c.Status(http.StatusNoContent)
 }
 
-// addAttendeeToEvent adds a user as an attendee to a specific event.
+// addAttendeeToEvent adds a user as an attendee to a specific event, or to its
+// waitlist when the event is full.
 //
 //	@Summary		Add an attendee to an event
-//	@Description	Adds a user to the list of attendees for a given event by event ID and user ID.
+//	@Description	Adds a user to the list of attendees for a given event by event ID and user ID. If the event is at capacity the user is placed on the waitlist and their position is returned.
 //	@Tags			Attendees
 //	@Accept			json
 //	@Produce		json
-//	@Param			id		path		int					true	"Event ID"
-//	@Param			userId	path		int					true	"User ID"
-//	@Success		201		{object}	storage.Attendee	"Attendee successfully added"
-//	@Failure		400		{object}	map[string]string	"Invalid event ID or user ID"
-//	@Failure		404		{object}	map[string]string	"Event or user not found"
-//	@Failure		409		{object}	map[string]string	"Attendee already exists"
+//	@Param			id			path		int					true	"Event ID"
+//	@Param			userId		path		int					true	"User ID"
+//	@Param			occurrence	query		string				false	"Original RFC 3339 start time of the occurrence, required for recurring events"
+//	@Success		201		{object}	storage.Attendee		"Attendee successfully added"
+//	@Success		202		{object}	storage.WaitlistEntry	"Event is full, user added to the waitlist"
+//	@Failure		400		{object}	map[string]string		"Invalid event ID or user ID"
+//	@Failure		404		{object}	map[string]string		"Event or user not found"
+//	@Failure		409		{object}	map[string]string		"Attendee already exists"
 //	@Failure		500		{object}	map[string]string	"Internal server error"
 //	@Router			/events/{id}/attendees/{userId} [post]
 //	@Security		BearerAuth
 func (app *application) addAttendeeToEvent(c *gin.Context) {
 	event := app.getEventFromContext(c)
-	authUser := app.getUserFromContext(c)
-
-	// only authorized event owner can add attendees to the event
-	if event.OwnerID != authUser.ID {
-		c.JSON(http.StatusForbidden, gin.H{"error": "you are not authorized to add attendees to this event"})
-		return
-	}
 
 	userId, err := strconv.Atoi(c.Param("userId"))
 	if err != nil {
@@ -240,7 +468,12 @@ func (app *application) addAttendeeToEvent(c *gin.Context) {
 		return
 	}
 
-	existingAttendee, err := app.store.Attendees.GetByEventAndAttendee(c.Request.Context(), event.ID, userId)
+	occurrence, ok := requireOccurrence(c, event)
+	if !ok {
+		return
+	}
+
+	existingAttendee, err := app.store.Attendees.GetByEventAndAttendee(c.Request.Context(), event.ID, userId, occurrence)
 	if err != nil && !errors.Is(err, storage.ErrAttendeeNotFound) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve attendee"})
 		return
@@ -250,57 +483,110 @@ func (app *application) addAttendeeToEvent(c *gin.Context) {
 		return
 	}
 
+	waitlisted, err := app.store.Waitlist.GetWaitlistEntry(c.Request.Context(), event.ID, userId, occurrence)
+	if err != nil && !errors.Is(err, storage.ErrWaitlistEntryNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve waitlist entry"})
+		return
+	}
+	if waitlisted != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "user is already on the waitlist", "position": waitlisted.Position})
+		return
+	}
+
 	attendee := &storage.Attendee{
-		UserID:  userId,
-		EventID: event.ID,
+		UserID:          userId,
+		EventID:         event.ID,
+		OccurrenceStart: occurrence,
 	}
 
-	if err := app.store.Attendees.CreateAttendee(c.Request.Context(), attendee); err != nil {
+	entry, err := app.store.Attendees.CreateAttendee(c.Request.Context(), attendee)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create attendee"})
 		return
 	}
+
+	app.invalidateAttendanceLists(c.Request.Context(), event.ID, userId)
+
+	if entry != nil {
+		c.JSON(http.StatusAccepted, entry)
+		return
+	}
 	c.JSON(http.StatusCreated, attendee)
 }
 
 // GetEventAttendees get the attendees to a specific event.
 //
 //	@Summary		Get event attendees
-//	@Description	Get the list of attendees for a given event by event ID.
+//	@Description	Get the list of attendees for a given event by event ID, sorted and paginated with a keyset cursor. For recurring events the attendees of every occurrence are listed unless occurrence is given. The attendees of private events are only visible to their owner, invitees and attendees. Emails are only shown to the owner and co-organizers, who also see attendees who hide their name or attendance.
 //	@Tags			Attendees
 //	@Accept			json
 //	@Produce		json
-//	@Param			id	path		int					true	"Event ID"
-//	@Success		200	{object}	storage.Attendee	"Attendees successfully retrieved"
-//	@Failure		400	{object}	map[string]string	"Invalid event ID"
-//	@Failure		404	{object}	error
-//	@Failure		409	{object}	error
-//	@Failure		500	{object}	error
+//	@Param			id			path		int										true	"Event ID"
+//	@Param			occurrence	query		string									false	"Original RFC 3339 start time of an occurrence"
+//	@Param			sort	query		string									false	"Sort field"	Enums(name, id)
+//	@Param			order	query		string									false	"Sort order"	Enums(asc, desc)
+//	@Param			cursor	query		string									false	"next_cursor from the previous page"
+//	@Param			limit	query		int										false	"Page size (max 100)"
+//	@Success		200		{object}	storage.Page[attendeeResponse]	"Attendees successfully retrieved"
+//	@Failure		400		{object}	map[string]string						"Invalid event ID"
+//	@Failure		404		{object}	error
+//	@Failure		409		{object}	error
+//	@Failure		500		{object}	error
 //	@Router			/events/{id}/attendees [get]
 func (app *application) getEventAttendees(c *gin.Context) {
-	eventId, err := strconv.Atoi(c.Param("id"))
+	event := app.getEventFromContext(c)
+
+	page, err := parsePageParams(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	occurrence, err := parseOccurrenceQuery(c)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid event ID"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	event, err := app.store.Attendees.GetAttendeesByEvent(c.Request.Context(), eventId)
+	viewer, err := app.attendeeViewer(c, event)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve event attendees"})
 		return
 	}
 
-	c.JSON(http.StatusOK, event)
+	key := cache.ListKey("attendees", event.ID, occurrence, page, viewer)
+	attendees, err := cache.FetchList(c.Request.Context(), &app.cacheStorage.Lists, key, func(ctx context.Context) (*storage.Page[storage.EventAttendee], []string, error) {
+		attendees, err := app.store.Attendees.GetAttendeesByEvent(ctx, event.ID, occurrence, page, viewer)
+		if err != nil {
+			return nil, nil, err
+		}
+		tags := []string{cache.EventTag(event.ID)}
+		for _, a := range attendees.Data {
+			tags = append(tags, cache.UserTag(a.ID))
+		}
+		return attendees, tags, nil
+	})
+	if err != nil {
+		if listQueryError(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve event attendees"})
+		return
+	}
+
+	c.JSON(http.StatusOK, newAttendeeResponses(attendees, viewer))
 }
 
 // DeleteAttendee godoc
 //
 //	@Summary		Delete attendee
-//	@Description	Delete attendee by event and user ID
+//	@Description	Delete attendee by event and user ID. The first person on the waitlist is promoted into the freed seat. Users who are only on the waitlist are removed from it.
 //	@Tags			Attendees
 //	@Accept			json
 //	@Produce		json
-//	@Param			id		path		int		true	"Event ID"
-//	@Param			userId	path		int		true	"User ID"
+//	@Param			id			path		int		true	"Event ID"
+//	@Param			userId		path		int		true	"User ID"
+//	@Param			occurrence	query		string	false	"Original RFC 3339 start time of the occurrence, required for recurring events"
 //	@Success		204		{string}	string	"no content"
 //	@Failure		400		{object}	error
 //	@Failure		404		{object}	error
@@ -310,13 +596,6 @@ func (app *application) getEventAttendees(c *gin.Context) {
 func (app *application) deleteAttendeeFromEvent(c *gin.Context) {
 
 	event := app.getEventFromContext(c)
-	authUser := app.getUserFromContext(c)
-
-	// only authorized event owner can add attendees to the event
-	if event.OwnerID != authUser.ID {
-		c.JSON(http.StatusForbidden, gin.H{"error": "you are not authorized to delete attendee to this event"})
-		return
-	}
 
 	userId, err := strconv.Atoi(c.Param("userId"))
 	if err != nil {
@@ -324,20 +603,10 @@ func (app *application) deleteAttendeeFromEvent(c *gin.Context) {
 		return
 	}
 
-	attendee, err := app.store.Attendees.GetByEventAndAttendee(c.Request.Context(), event.ID, userId)
-	if err != nil {
-		if errors.Is(err, storage.ErrAttendeeNotFound) {
-			c.JSON(http.StatusNotFound, gin.H{"error": "attendee not found"})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve attendee"})
-		return
-	}
-
-	if err := app.store.Attendees.DeleteAttendee(c.Request.Context(), attendee.EventID, attendee.UserID); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete attendee"})
+	occurrence, ok := requireOccurrence(c, event)
+	if !ok {
 		return
 	}
 
-	c.Status(http.StatusNoContent)
+	app.removeAttendance(c, event.ID, userId, occurrence)
 }
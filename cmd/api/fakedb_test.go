@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeDB is a database/sql driver that answers statements from a script, so
+// that handlers can be tested without Postgres. Each statement has to contain
+// the match of the next step of the script; the statements and their
+// arguments are recorded for the test to check.
+type fakeDB struct {
+	t testing.TB
+
+	mu       sync.Mutex
+	script   []fakeStep
+	executed []fakeCall
+}
+
+// fakeStep answers one statement with rows, or with err.
+type fakeStep struct {
+	match   string
+	columns []string
+	rows    [][]driver.Value
+	err     error
+}
+
+type fakeCall struct {
+	query string
+	args  []driver.Value
+}
+
+// newFakeDB opens a database that runs script, and fails the test if any of
+// it is left over at the end.
+func newFakeDB(t testing.TB, script ...fakeStep) (*sql.DB, *fakeDB) {
+	t.Helper()
+
+	f := &fakeDB{t: t, script: script}
+	db := sql.OpenDB(f)
+	t.Cleanup(func() {
+		db.Close()
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		for _, step := range f.script {
+			t.Errorf("statement matching %q was never run", step.match)
+		}
+	})
+
+	return db, f
+}
+
+// calls returns the recorded statements containing match.
+func (f *fakeDB) calls(match string) []fakeCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var calls []fakeCall
+	for _, call := range f.executed {
+		if strings.Contains(call.query, match) {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+func (f *fakeDB) next(query string, args []driver.NamedValue) (fakeStep, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	call := fakeCall{query: query}
+	for _, arg := range args {
+		call.args = append(call.args, arg.Value)
+	}
+	f.executed = append(f.executed, call)
+
+	if len(f.script) == 0 || !strings.Contains(query, f.script[0].match) {
+		f.t.Errorf("unexpected statement: %s", query)
+		return fakeStep{}, fmt.Errorf("unexpected statement: %s", query)
+	}
+	step := f.script[0]
+	f.script = f.script[1:]
+
+	return step, step.err
+}
+
+func (f *fakeDB) Connect(context.Context) (driver.Conn, error) { return fakeConn{f}, nil }
+func (f *fakeDB) Driver() driver.Driver                        { return nil }
+
+type fakeConn struct{ db *fakeDB }
+
+func (c fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, fmt.Errorf("prepared statements are not supported")
+}
+func (c fakeConn) Close() error              { return nil }
+func (c fakeConn) Begin() (driver.Tx, error) { return fakeTx{}, nil }
+
+func (c fakeConn) BeginTx(context.Context, driver.TxOptions) (driver.Tx, error) {
+	return fakeTx{}, nil
+}
+
+// CheckNamedValue converts arguments like database/sql does, and passes the
+// ones it cannot convert through as they are.
+func (c fakeConn) CheckNamedValue(arg *driver.NamedValue) error {
+	if v, err := driver.DefaultParameterConverter.ConvertValue(arg.Value); err == nil {
+		arg.Value = v
+	}
+	return nil
+}
+
+func (c fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	step, err := c.db.next(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return &fakeRows{columns: step.columns, rows: step.rows}, nil
+}
+
+func (c fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	step, err := c.db.next(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(len(step.rows)), nil
+}
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+type fakeRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
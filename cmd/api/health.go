@@ -10,7 +10,7 @@ import (
 // GetHealth godoc
 //
 //	@Summary		Health Check
-//	@Description	Returns the health status of the application
+//	@Description	Returns the health status of the application. cache.redis is down while Redis is unavailable, during which the API falls back to Postgres.
 //	@Tags			Health
 //	@Accept			json
 //	@Produce		json
@@ -24,5 +24,6 @@ func (app *application) healthCheck(c *gin.Context) {
 		"env":     app.config.env,
 		"message": "Health check successful",
 		"time":    time.Now().Format(time.RFC3339),
+		"cache":   app.cacheStorage.Health(),
 	})
 }
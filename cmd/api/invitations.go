@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/puremike/event-mgt-api/internal/auth"
+	"github.com/puremike/event-mgt-api/internal/storage"
+)
+
+const (
+	invitationPurpose = "event-invitation"
+
+	defaultInvitationTTL = 7 * 24 * time.Hour
+)
+
+// invitationClaims is the signed payload of an invitation token.
+type invitationClaims struct {
+	InvitationID int `json:"inv"`
+	EventID      int `json:"evt"`
+}
+
+// createInvitationRequest creates a single-use invitation with max_uses 1
+// and an unlimited one without max_uses. Invitations expire after a week
+// unless expires_at is given.
+type createInvitationRequest struct {
+	MaxUses   *int       `json:"max_uses" binding:"omitempty,min=1"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type acceptInvitationRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+type invitationResponse struct {
+	storage.Invitation
+	Token string `json:"token"`
+	URL   string `json:"url"`
+}
+
+// invitationResponse signs the invitation's token. Tokens are deterministic,
+// so the same link is returned every time the invitation is listed.
+func (app *application) invitationResponse(invitation storage.Invitation) (invitationResponse, error) {
+	token, err := app.signer.Sign(invitationPurpose, invitationClaims{InvitationID: invitation.ID, EventID: invitation.EventID}, invitation.ExpiresAt)
+	if err != nil {
+		return invitationResponse{}, err
+	}
+
+	return invitationResponse{
+		Invitation: invitation,
+		Token:      token,
+		URL:        fmt.Sprintf("%s/api/v1/events/%d?invite=%s", app.config.baseURL, invitation.EventID, token),
+	}, nil
+}
+
+// verifyInvitation checks an invitation token for the event and returns the
+// invitation when it can still be used.
+func (app *application) verifyInvitation(ctx context.Context, eventId int, token string) (*storage.Invitation, error) {
+	var claims invitationClaims
+	if err := app.signer.Verify(invitationPurpose, token, &claims); err != nil {
+		return nil, err
+	}
+	if claims.EventID != eventId {
+		return nil, storage.ErrInvitationNotFound
+	}
+
+	invitation, err := app.store.Invitations.GetInvitation(ctx, eventId, claims.InvitationID)
+	if err != nil {
+		return nil, err
+	}
+	if !invitation.Usable(time.Now()) {
+		return nil, storage.ErrInvitationUnusable
+	}
+
+	return invitation, nil
+}
+
+// CreateInvitation godoc
+//
+//	@Summary		Create invitation
+//	@Description	Creates a signed invitation link to the event. Invitations can be single use (max_uses 1), limited or unlimited, and expire after a week unless expires_at is given. Requires the owner or a co-organizer.
+//	@Tags			Invitations
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		int						true	"Event ID"
+//	@Param			payload	body		createInvitationRequest	true	"Invitation payload"
+//	@Success		201		{object}	invitationResponse
+//	@Failure		400		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Router			/events/{id}/invitations [post]
+//	@Security		BearerAuth
+func (app *application) createInvitation(c *gin.Context) {
+	var payload createInvitationRequest
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	event := app.getEventFromContext(c)
+	user := app.getUserFromContext(c)
+
+	expiresAt := time.Now().Add(defaultInvitationTTL)
+	if payload.ExpiresAt != nil {
+		if !payload.ExpiresAt.After(time.Now()) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "expires_at must be in the future"})
+			return
+		}
+		expiresAt = *payload.ExpiresAt
+	}
+
+	invitation := &storage.Invitation{
+		EventID:   event.ID,
+		CreatedBy: user.ID,
+		MaxUses:   payload.MaxUses,
+		ExpiresAt: expiresAt,
+	}
+
+	if err := app.store.Invitations.CreateInvitation(c.Request.Context(), invitation); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create invitation"})
+		return
+	}
+
+	response, err := app.invitationResponse(*invitation)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to sign invitation"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, response)
+}
+
+// GetEventInvitations godoc
+//
+//	@Summary		List invitations
+//	@Description	Lists the event's invitations with their links and usage, newest first. Requires the owner or a co-organizer.
+//	@Tags			Invitations
+//	@Produce		json
+//	@Param			id	path		int	true	"Event ID"
+//	@Success		200	{array}		invitationResponse
+//	@Failure		403	{object}	error
+//	@Failure		404	{object}	error
+//	@Failure		500	{object}	error
+//	@Router			/events/{id}/invitations [get]
+//	@Security		BearerAuth
+func (app *application) getEventInvitations(c *gin.Context) {
+	event := app.getEventFromContext(c)
+
+	invitations, err := app.store.Invitations.GetInvitationsByEvent(c.Request.Context(), event.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve invitations"})
+		return
+	}
+
+	response := make([]invitationResponse, 0, len(invitations))
+	for _, invitation := range invitations {
+		r, err := app.invitationResponse(invitation)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to sign invitation"})
+			return
+		}
+		response = append(response, r)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// RevokeInvitation godoc
+//
+//	@Summary		Revoke invitation
+//	@Description	Revokes an invitation so its link can no longer be used. People who already accepted it keep their access. Requires the owner or a co-organizer.
+//	@Tags			Invitations
+//	@Produce		json
+//	@Param			id				path		int		true	"Event ID"
+//	@Param			invitationId	path		int		true	"Invitation ID"
+//	@Success		204				{string}	string	"no content"
+//	@Failure		400				{object}	error
+//	@Failure		403				{object}	error
+//	@Failure		404				{object}	error
+//	@Failure		500				{object}	error
+//	@Router			/events/{id}/invitations/{invitationId} [delete]
+//	@Security		BearerAuth
+func (app *application) revokeInvitation(c *gin.Context) {
+	event := app.getEventFromContext(c)
+
+	invitationId, err := strconv.Atoi(c.Param("invitationId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid invitation ID"})
+		return
+	}
+
+	if err := app.store.Invitations.RevokeInvitation(c.Request.Context(), event.ID, invitationId); err != nil {
+		if errors.Is(err, storage.ErrInvitationNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "invitation not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke invitation"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// AcceptInvitation godoc
+//
+//	@Summary		Accept invitation
+//	@Description	Accepts an invitation token, giving the authenticated user access to the event even when it is private. Accepting uses up one of the invitation's uses.
+//	@Tags			Invitations
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		int						true	"Event ID"
+//	@Param			payload	body		acceptInvitationRequest	true	"Invitation token"
+//	@Success		200		{object}	storage.Event
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		410		{object}	error
+//	@Failure		500		{object}	error
+//	@Router			/events/{id}/invitations/accept [post]
+//	@Security		BearerAuth
+func (app *application) acceptInvitation(c *gin.Context) {
+	var payload acceptInvitationRequest
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	event := app.getEventFromContext(c)
+	user := app.getUserFromContext(c)
+
+	invitation, err := app.verifyInvitation(c.Request.Context(), event.ID, payload.Token)
+	if err != nil {
+		app.invitationError(c, err)
+		return
+	}
+
+	if err := app.store.Invitations.AcceptInvitation(c.Request.Context(), event.ID, invitation.ID, user.ID); err != nil {
+		app.invitationError(c, err)
+		return
+	}
+
+	// the private event now shows up on the invitee's listings and on its
+	// attendees' lists for them
+	app.invalidateEventLists(c.Request.Context(), event.ID)
+
+	c.JSON(http.StatusOK, event)
+}
+
+func (app *application) invitationError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, storage.ErrInvitationUnusable), errors.Is(err, auth.ErrSignedTokenExpired):
+		c.JSON(http.StatusGone, gin.H{"error": "invitation is expired, revoked or used up"})
+	case errors.Is(err, storage.ErrInvitationNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "invitation not found"})
+	case errors.Is(err, auth.ErrInvalidSignedToken):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid invitation token"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to accept invitation"})
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/puremike/event-mgt-api/internal/auth"
+	"go.uber.org/zap"
+)
+
+// newAuthenticator picks how tokens are signed. Keys listed in
+// JWT_SIGNING_KEYS take precedence over the legacy HS256 JWT_SECRET_KEY.
+// Without either, development setups sign with a key that only lives as long
+// as the process.
+func newAuthenticator(cfg *config, logger *zap.SugaredLogger) (auth.Authenticator, error) {
+	authCfg := cfg.authConfig
+
+	switch {
+	case authCfg.signingKeys != "":
+		keys, err := auth.ParseKeySpecs(authCfg.signingKeys)
+		if err != nil {
+			return nil, err
+		}
+		return auth.NewKeySetAuthenticator(keys, authCfg.iss, authCfg.aud)
+	case authCfg.secretKey != "":
+		return auth.NewJWTAuthenticator(authCfg.secretKey, authCfg.iss, authCfg.aud), nil
+	case cfg.env == "development":
+		logger.Warn("JWT_SIGNING_KEYS is not set, signing tokens with an ephemeral key")
+		key, err := auth.GenerateEphemeralKey()
+		if err != nil {
+			return nil, err
+		}
+		return auth.NewKeySetAuthenticator([]*auth.SigningKey{key}, authCfg.iss, authCfg.aud)
+	default:
+		return nil, errors.New("JWT_SIGNING_KEYS or JWT_SECRET_KEY must be set")
+	}
+}
+
+// getJWKS publishes the public keys that verify access tokens, selected by
+// the kid header of a token. It is served outside the API base path, where
+// JWT libraries expect it. Keys scheduled for rotation are listed before
+// they start signing, and the set is empty when tokens are signed with a
+// shared secret.
+func (app *application) getJWKS(c *gin.Context) {
+	set := auth.JWKS{Keys: []auth.JWK{}}
+	if publisher, ok := app.jWTAuthenticator.(auth.KeyPublisher); ok {
+		set = publisher.JWKS()
+	}
+
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, set)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/puremike/event-mgt-api/internal/auth"
+	"github.com/puremike/event-mgt-api/internal/mailer"
+	"github.com/puremike/event-mgt-api/internal/storage"
+)
+
+type magicLinkRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// RequestMagicLink godoc
+//
+//	@Summary		Request magic link
+//	@Description	Emails a single-use link that logs in without a password, if the address belongs to an account. Only one link is sent per account every MAGIC_LINK_INTERVAL. The response is the same either way.
+//	@Tags			Users
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		magicLinkRequest	true	"Email"
+//	@Success		202		{object}	map[string]string
+//	@Failure		400		{object}	error
+//	@Router			/auth/magic-link [post]
+func (app *application) requestMagicLink(c *gin.Context) {
+	var payload magicLinkRequest
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	app.background(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), mailTimeout)
+		defer cancel()
+
+		if err := app.sendMagicLink(ctx, payload.Email); err != nil {
+			app.logger.Errorw("failed to send magic link", "error", err)
+		}
+	})
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "if an account exists for that email, a login link has been sent to it"})
+}
+
+func (app *application) sendMagicLink(ctx context.Context, email string) error {
+	user, err := app.store.Users.GetUserByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	if !user.Active(time.Now()) {
+		return nil
+	}
+
+	token, hash, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		return err
+	}
+
+	ttl := app.config.authConfig.magicLinkExp
+	if err := app.store.UserTokens.CreateTokenUnlessRecent(ctx, user.ID, storage.TokenMagicLink, hash, time.Now().Add(ttl), app.config.authConfig.magicLinkInterval); err != nil {
+		if errors.Is(err, storage.ErrTokenRequestedTooSoon) {
+			return nil
+		}
+		return err
+	}
+
+	link := fmt.Sprintf("%s/api/v1/auth/magic-link/callback?token=%s", app.config.baseURL, url.QueryEscape(token))
+
+	return app.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Your login link",
+		Body: fmt.Sprintf("Hi %s,\n\nOpen this link within %s to log in. It can only be used once:\n\n%s\n\nIf you did not ask for it, you can ignore this email.\n",
+			user.Name, ttl, link),
+	})
+}
+
+// MagicLinkCallback godoc
+//
+//	@Summary		Log in with magic link
+//	@Description	Exchanges the token from a magic link email for the access and refresh tokens, and marks the email address as verified. Responds like /auth/login, including the MFA challenge when two-factor authentication is on.
+//	@Tags			Users
+//	@Produce		json
+//	@Param			token	query		string	true	"Magic link token"
+//	@Success		200		{object}	loginResponse
+//	@Failure		400		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		500		{object}	error
+//	@Router			/auth/magic-link/callback [get]
+func (app *application) magicLinkCallback(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "token is required"})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	userId, err := app.store.UserTokens.RedeemMagicLink(ctx, auth.HashToken(token))
+	if err != nil {
+		if errors.Is(err, storage.ErrUserTokenInvalid) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired token"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to log in"})
+		return
+	}
+
+	app.invalidateCachedUser(ctx, userId)
+
+	user, err := app.store.Users.GetUserByID(ctx, userId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve user"})
+		return
+	}
+
+	if !user.Active(time.Now()) {
+		c.JSON(http.StatusForbidden, gin.H{"error": accountStatusError(user)})
+		return
+	}
+
+	app.respondWithLogin(c, user)
+}
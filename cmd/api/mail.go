@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/puremike/event-mgt-api/internal/mailer"
+)
+
+const mailTimeout = 30 * time.Second
+
+func newMailer(cfg mailerConfig) (mailer.Mailer, error) {
+	switch cfg.kind {
+	case "smtp":
+		return mailer.NewSMTPMailer(cfg.host, cfg.port, cfg.username, cfg.password, cfg.from), nil
+	case "log":
+		if cfg.logFile == "" {
+			return mailer.NewLogMailer(os.Stdout, cfg.from), nil
+		}
+		f, err := os.OpenFile(cfg.logFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+		if err != nil {
+			return nil, err
+		}
+		return mailer.NewLogMailer(f, cfg.from), nil
+	default:
+		return nil, fmt.Errorf("unknown MAILER %q, expected smtp or log", cfg.kind)
+	}
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/puremike/event-mgt-api/internal/auth"
+	"github.com/puremike/event-mgt-api/internal/mailer"
+	"github.com/puremike/event-mgt-api/internal/storage"
+	"github.com/puremike/event-mgt-api/internal/storage/cache"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type meResponse struct {
+	ID    int    `json:"id"`
+	Name  string `json:"name"`
+	Email string `json:"email"`
+	// PendingEmail is the new email address waiting to be confirmed
+	PendingEmail    *string                 `json:"pending_email,omitempty"`
+	EmailVerifiedAt *time.Time              `json:"email_verified_at"`
+	Role            storage.UserRole        `json:"role"`
+	TOTPEnabled     bool                    `json:"totp_enabled"`
+	Privacy         storage.PrivacySettings `json:"privacy"`
+	CreatedAt       time.Time               `json:"created_at"`
+}
+
+// updateMeRequest changes only the fields that are given.
+type updateMeRequest struct {
+	Name  *string `json:"name" binding:"omitempty,min=3"`
+	Email *string `json:"email" binding:"omitempty,email"`
+}
+
+type changePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required,min=8"`
+}
+
+type deleteMeRequest struct {
+	Password string `json:"password" binding:"required"`
+}
+
+func newMeResponse(user *storage.User) meResponse {
+	return meResponse{
+		ID:              user.ID,
+		Name:            user.Name,
+		Email:           user.Email,
+		PendingEmail:    user.PendingEmail,
+		EmailVerifiedAt: user.EmailVerifiedAt,
+		Role:            user.Role,
+		TOTPEnabled:     user.TOTPEnabledAt != nil,
+		Privacy:         user.Privacy,
+		CreatedAt:       user.CreatedAt,
+	}
+}
+
+// GetMe godoc
+//
+//	@Summary		Get profile
+//	@Description	Returns the authenticated user's profile.
+//	@Tags			Profile
+//	@Produce		json
+//	@Success		200	{object}	meResponse
+//	@Failure		401	{object}	error
+//	@Router			/me [get]
+//	@Security		BearerAuth
+func (app *application) getMe(c *gin.Context) {
+	c.JSON(http.StatusOK, newMeResponse(app.getUserFromContext(c)))
+}
+
+// UpdateMe godoc
+//
+//	@Summary		Update profile
+//	@Description	Changes the authenticated user's name and email address. A new email address only replaces the current one after it is confirmed through the link mailed to it.
+//	@Tags			Profile
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		updateMeRequest	true	"Profile changes"
+//	@Success		200		{object}	meResponse
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		409		{object}	error
+//	@Failure		500		{object}	error
+//	@Router			/me [patch]
+//	@Security		BearerAuth
+func (app *application) updateMe(c *gin.Context) {
+	var payload updateMeRequest
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user := app.getUserFromContext(c)
+	ctx := c.Request.Context()
+
+	if payload.Email != nil && *payload.Email == user.Email {
+		payload.Email = nil
+	}
+
+	if payload.Email != nil {
+		_, err := app.store.Users.GetUserByEmail(ctx, *payload.Email)
+		if err == nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "email address is already in use"})
+			return
+		}
+		if !errors.Is(err, storage.ErrUserNotFound) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update profile"})
+			return
+		}
+	}
+
+	updated, err := app.store.Users.UpdateProfile(ctx, user.ID, payload.Name, payload.Email)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update profile"})
+		return
+	}
+
+	app.cacheUser(ctx, updated)
+	if payload.Name != nil {
+		app.invalidateAttendeeLists(ctx, user.ID)
+	}
+
+	if payload.Email != nil {
+		app.background(func() {
+			ctx, cancel := context.WithTimeout(context.Background(), mailTimeout)
+			defer cancel()
+
+			if err := app.sendEmailChangeConfirmation(ctx, updated); err != nil {
+				app.logger.Errorw("failed to send email change confirmation", "userId", updated.ID, "error", err)
+			}
+		})
+	}
+
+	c.JSON(http.StatusOK, newMeResponse(updated))
+}
+
+// sendEmailChangeConfirmation mails the link that confirms the user's
+// pending email address to that address.
+func (app *application) sendEmailChangeConfirmation(ctx context.Context, user *storage.User) error {
+	token, hash, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		return err
+	}
+
+	ttl := app.config.verification.tokenExp
+	if err := app.store.UserTokens.CreateToken(ctx, user.ID, storage.TokenEmailChange, hash, time.Now().Add(ttl)); err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/api/v1/auth/email/confirm?token=%s", app.config.baseURL, url.QueryEscape(token))
+
+	return app.mailer.Send(ctx, mailer.Message{
+		To:      *user.PendingEmail,
+		Subject: "Confirm your new email address",
+		Body: fmt.Sprintf("Hi %s,\n\nPlease confirm that you want to use this email address for your account by opening this link within %s:\n\n%s\n\nIf you did not ask for this, you can ignore this email.\n",
+			user.Name, ttl, link),
+	})
+}
+
+// ConfirmEmailChange godoc
+//
+//	@Summary		Confirm email change
+//	@Description	Replaces the user's email address with the new one they asked for, using the token mailed to the new address.
+//	@Tags			Profile
+//	@Produce		json
+//	@Param			token	query		string	true	"Email change token"
+//	@Success		200		{object}	map[string]string
+//	@Failure		400		{object}	error
+//	@Failure		409		{object}	error
+//	@Failure		500		{object}	error
+//	@Router			/auth/email/confirm [get]
+func (app *application) confirmEmailChange(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "token is required"})
+		return
+	}
+
+	userId, err := app.store.UserTokens.ConfirmEmailChange(c.Request.Context(), auth.HashToken(token))
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrUserTokenInvalid):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired token"})
+		case errors.Is(err, storage.ErrEmailTaken):
+			c.JSON(http.StatusConflict, gin.H{"error": "email address is already in use"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to change email address"})
+		}
+		return
+	}
+
+	app.invalidateCachedUser(c.Request.Context(), userId)
+	app.invalidateLists(c.Request.Context(), cache.UserTag(userId))
+
+	c.JSON(http.StatusOK, gin.H{"message": "email address changed"})
+}
+
+// ChangePassword godoc
+//
+//	@Summary		Change password
+//	@Description	Changes the authenticated user's password given the current one, and logs out every other session. Accounts created through single sign-on set their first password with a password reset.
+//	@Tags			Profile
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		changePasswordRequest	true	"Current and new password"
+//	@Success		204		{string}	string					"no content"
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		429		{object}	error
+//	@Failure		500		{object}	error
+//	@Router			/me/password [post]
+//	@Security		BearerAuth
+func (app *application) changePassword(c *gin.Context) {
+	var payload changePasswordRequest
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user := app.getUserFromContext(c)
+	ctx := c.Request.Context()
+
+	if !app.checkCurrentPassword(c, user.ID, payload.CurrentPassword) {
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(payload.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to hash password"})
+		return
+	}
+
+	if err := app.store.Users.UpdatePassword(ctx, user.ID, string(hashedPassword)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to change password"})
+		return
+	}
+
+	app.invalidateCachedUser(ctx, user.ID)
+
+	refs, err := app.store.RefreshTokens.RevokeOtherUserTokens(ctx, user.ID, app.getAccessTokenFromContext(c).SessionID)
+	if err == nil {
+		err = app.denyAccessTokens(ctx, refs)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "password was changed but other sessions could not be revoked"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// DeleteMe godoc
+//
+//	@Summary		Delete account
+//	@Description	Closes the authenticated user's account after confirming their password. The events they own, their RSVPs and everything else that belongs to the account are deleted, and every session is logged out.
+//	@Tags			Profile
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		deleteMeRequest	true	"Password"
+//	@Success		204		{string}	string			"no content"
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		429		{object}	error
+//	@Failure		500		{object}	error
+//	@Router			/me [delete]
+//	@Security		BearerAuth
+func (app *application) deleteMe(c *gin.Context) {
+	var payload deleteMeRequest
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user := app.getUserFromContext(c)
+	ctx := c.Request.Context()
+
+	if !app.checkCurrentPassword(c, user.ID, payload.Password) {
+		return
+	}
+
+	// the refresh tokens go with the user, so the access tokens issued with
+	// them have to be denied first
+	refs, err := app.store.RefreshTokens.RevokeUserTokens(ctx, user.ID)
+	if err == nil {
+		err = app.denyAccessTokens(ctx, refs)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke sessions"})
+		return
+	}
+
+	// the user's events and attendance are deleted with them
+	eventIds, err := app.store.Events.GetEventIDsByOwner(ctx, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete account"})
+		return
+	}
+	attendeeTags, err := app.attendeeTags(ctx, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete account"})
+		return
+	}
+
+	if err := app.store.Users.DeleteUser(ctx, user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete account"})
+		return
+	}
+
+	app.invalidateCachedUser(ctx, user.ID)
+	app.invalidateCachedEvent(ctx, eventIds...)
+	app.invalidateEventLists(ctx, eventIds...)
+	app.invalidateLists(ctx, attendeeTags...)
+
+	c.Status(http.StatusNoContent)
+}
+
+// checkCurrentPassword confirms the user's password, writing the error
+// response when it is wrong. Wrong passwords count as failed logins.
+func (app *application) checkCurrentPassword(c *gin.Context, userId int, password string) bool {
+	ctx := c.Request.Context()
+
+	user, err := app.store.Users.GetUserByID(ctx, userId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve user"})
+		return false
+	}
+
+	if !app.checkLoginThrottle(c, user.Email) {
+		return false
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "password is incorrect"})
+		return false
+	}
+
+	app.loginSucceeded(c, user.Email)
+	return true
+}
@@ -0,0 +1,431 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/puremike/event-mgt-api/internal/auth"
+	"github.com/puremike/event-mgt-api/internal/storage"
+	"github.com/skip2/go-qrcode"
+)
+
+const (
+	totpIssuer = "Event Management API"
+
+	recoveryCodeCount = 10
+
+	mfaChallengePurpose = "mfa-challenge"
+	mfaChallengeTTL     = 5 * time.Minute
+)
+
+// mfaChallengeClaims is the signed payload of an MFA challenge token, issued
+// by loginUser once the password checks out.
+type mfaChallengeClaims struct {
+	UserID int `json:"uid"`
+}
+
+type mfaChallengeResponse struct {
+	MFARequired bool      `json:"mfa_required"`
+	MFAToken    string    `json:"mfa_token"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+type totpEnrollmentResponse struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+	// QRCode is a PNG of the otpauth URI, base64 encoded
+	QRCode []byte `json:"qr_png" swaggertype:"string" format:"base64"`
+}
+
+type recoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type mfaCodeRequest struct {
+	// Code is a TOTP code or, where accepted, a recovery code
+	Code string `json:"code" binding:"required"`
+}
+
+type loginMFARequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+// EnrollTOTP godoc
+//
+//	@Summary		Start TOTP enrollment
+//	@Description	Generates a TOTP secret for the authenticated user and returns it with an otpauth URI and a QR code PNG to scan with an authenticator app. Two-factor authentication is only turned on once a code is verified. Starting over replaces an unconfirmed secret.
+//	@Tags			MFA
+//	@Produce		json
+//	@Success		201	{object}	totpEnrollmentResponse
+//	@Failure		401	{object}	error
+//	@Failure		409	{object}	error
+//	@Failure		500	{object}	error
+//	@Router			/auth/mfa/totp [post]
+//	@Security		BearerAuth
+func (app *application) enrollTOTP(c *gin.Context) {
+	user := app.getUserFromContext(c)
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate secret"})
+		return
+	}
+
+	sealed, err := app.totpSealer.Seal(secret)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate secret"})
+		return
+	}
+
+	if err := app.store.MFA.StartTOTPEnrollment(c.Request.Context(), user.ID, sealed); err != nil {
+		if errors.Is(err, storage.ErrMFAAlreadyEnabled) {
+			c.JSON(http.StatusConflict, gin.H{"error": "two-factor authentication is already enabled"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start enrollment"})
+		return
+	}
+
+	uri := auth.TOTPURI(secret, totpIssuer, user.Email)
+
+	png, err := qrcode.Encode(uri, qrcode.Medium, 256)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate QR code"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, totpEnrollmentResponse{Secret: secret, OTPAuthURI: uri, QRCode: png})
+}
+
+// VerifyTOTP godoc
+//
+//	@Summary		Confirm TOTP enrollment
+//	@Description	Turns on two-factor authentication once the authenticator app produces a valid code, and returns one-time recovery codes. The recovery codes are only shown once.
+//	@Tags			MFA
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		mfaCodeRequest	true	"TOTP code"
+//	@Success		200		{object}	recoveryCodesResponse
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		409		{object}	error
+//	@Failure		429		{object}	error
+//	@Failure		500		{object}	error
+//	@Router			/auth/mfa/totp/verify [post]
+//	@Security		BearerAuth
+func (app *application) verifyTOTP(c *gin.Context) {
+	var payload mfaCodeRequest
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user := app.getUserFromContext(c)
+	ctx := c.Request.Context()
+
+	enrollment, err := app.store.MFA.GetTOTPEnrollment(ctx, user.ID)
+	if err != nil {
+		if errors.Is(err, storage.ErrMFANotEnrolled) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "start enrollment first"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve enrollment"})
+		return
+	}
+	if enrollment.Enabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "two-factor authentication is already enabled"})
+		return
+	}
+
+	if !app.checkSecondFactor(c, user, enrollment, payload.Code, false) {
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate recovery codes"})
+		return
+	}
+
+	if err := app.store.MFA.EnableTOTP(ctx, user.ID, hashes); err != nil {
+		if errors.Is(err, storage.ErrMFAAlreadyEnabled) {
+			c.JSON(http.StatusConflict, gin.H{"error": "two-factor authentication is already enabled"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to enable two-factor authentication"})
+		return
+	}
+
+	app.invalidateCachedUser(ctx, user.ID)
+
+	c.JSON(http.StatusOK, recoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// DisableTOTP godoc
+//
+//	@Summary		Disable two-factor authentication
+//	@Description	Turns off two-factor authentication and deletes the recovery codes. Requires a current TOTP code or a recovery code.
+//	@Tags			MFA
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		mfaCodeRequest	true	"TOTP or recovery code"
+//	@Success		204		{string}	string			"no content"
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		429		{object}	error
+//	@Failure		500		{object}	error
+//	@Router			/auth/mfa/totp [delete]
+//	@Security		BearerAuth
+func (app *application) disableTOTP(c *gin.Context) {
+	var payload mfaCodeRequest
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user := app.getUserFromContext(c)
+	ctx := c.Request.Context()
+
+	enrollment, ok := app.enabledTOTP(c, user)
+	if !ok {
+		return
+	}
+
+	if !app.checkSecondFactor(c, user, enrollment, payload.Code, true) {
+		return
+	}
+
+	if err := app.store.MFA.DisableTOTP(ctx, user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to disable two-factor authentication"})
+		return
+	}
+
+	app.invalidateCachedUser(ctx, user.ID)
+
+	c.Status(http.StatusNoContent)
+}
+
+// RegenerateRecoveryCodes godoc
+//
+//	@Summary		Regenerate recovery codes
+//	@Description	Replaces all recovery codes, used or not, with new ones. Requires a current TOTP code or a recovery code. The new codes are only shown once.
+//	@Tags			MFA
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		mfaCodeRequest	true	"TOTP or recovery code"
+//	@Success		200		{object}	recoveryCodesResponse
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		429		{object}	error
+//	@Failure		500		{object}	error
+//	@Router			/auth/mfa/recovery-codes [post]
+//	@Security		BearerAuth
+func (app *application) regenerateRecoveryCodes(c *gin.Context) {
+	var payload mfaCodeRequest
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user := app.getUserFromContext(c)
+
+	enrollment, ok := app.enabledTOTP(c, user)
+	if !ok {
+		return
+	}
+
+	if !app.checkSecondFactor(c, user, enrollment, payload.Code, true) {
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate recovery codes"})
+		return
+	}
+
+	if err := app.store.MFA.RegenerateRecoveryCodes(c.Request.Context(), user.ID, hashes); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to regenerate recovery codes"})
+		return
+	}
+
+	c.JSON(http.StatusOK, recoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// LoginMFA godoc
+//
+//	@Summary		Complete MFA login
+//	@Description	Second step of logging in to an account with two-factor authentication: exchanges the MFA token returned by /auth/login and a TOTP or recovery code for the access and refresh tokens. The MFA token is valid for five minutes.
+//	@Tags			Users
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		loginMFARequest	true	"MFA token and code"
+//	@Success		200		{object}	loginResponse
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		429		{object}	error
+//	@Failure		500		{object}	error
+//	@Router			/auth/login/mfa [post]
+func (app *application) loginMFA(c *gin.Context) {
+	var payload loginMFARequest
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var claims mfaChallengeClaims
+	if err := app.signer.Verify(mfaChallengePurpose, payload.MFAToken, &claims); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired MFA token"})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	user, err := app.store.Users.GetUserByID(ctx, claims.UserID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired MFA token"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve user"})
+		return
+	}
+
+	if !user.Active(time.Now()) {
+		c.JSON(http.StatusForbidden, gin.H{"error": accountStatusError(user)})
+		return
+	}
+
+	enrollment, ok := app.enabledTOTP(c, user)
+	if !ok {
+		return
+	}
+
+	if !app.checkSecondFactor(c, user, enrollment, payload.Code, true) {
+		return
+	}
+
+	app.loginSucceeded(c, user.Email)
+
+	response, err := app.startSession(ctx, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// mfaChallenge signs the token for the second step of logging in.
+func (app *application) mfaChallenge(user *storage.User) (*mfaChallengeResponse, error) {
+	expiresAt := time.Now().Add(mfaChallengeTTL)
+
+	token, err := app.signer.Sign(mfaChallengePurpose, mfaChallengeClaims{UserID: user.ID}, expiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &mfaChallengeResponse{MFARequired: true, MFAToken: token, ExpiresAt: expiresAt}, nil
+}
+
+// enabledTOTP loads the user's confirmed TOTP enrollment, writing the error
+// response when there is none.
+func (app *application) enabledTOTP(c *gin.Context, user *storage.User) (*storage.TOTPEnrollment, bool) {
+	enrollment, err := app.store.MFA.GetTOTPEnrollment(c.Request.Context(), user.ID)
+	if err != nil && !errors.Is(err, storage.ErrMFANotEnrolled) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve enrollment"})
+		return nil, false
+	}
+	if enrollment == nil || !enrollment.Enabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "two-factor authentication is not enabled"})
+		return nil, false
+	}
+	return enrollment, true
+}
+
+// checkSecondFactor verifies a TOTP code, or a recovery code when
+// allowRecovery is set, writing the error response when it is wrong. Codes
+// are throttled like passwords but counted apart from them, so that logging
+// in with the password again does not reset guessing of the code.
+func (app *application) checkSecondFactor(c *gin.Context, user *storage.User, enrollment *storage.TOTPEnrollment, code string, allowRecovery bool) bool {
+	retryAfter, err := app.loginThrottle.AttemptSecondFactor(c.Request.Context(), user.ID, c.ClientIP())
+	if !allowAttempt(c, retryAfter, err) {
+		return false
+	}
+
+	ok, err := app.validateSecondFactor(c, user, enrollment, code, allowRecovery)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to verify code"})
+		return false
+	}
+
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid code"})
+		return false
+	}
+
+	if err := app.loginThrottle.SecondFactorSucceeded(c.Request.Context(), user.ID, c.ClientIP()); err != nil {
+		app.logger.Errorw("failed to reset second factor attempts", "error", err)
+	}
+	return true
+}
+
+func (app *application) validateSecondFactor(c *gin.Context, user *storage.User, enrollment *storage.TOTPEnrollment, code string, allowRecovery bool) (bool, error) {
+	ctx := c.Request.Context()
+
+	if isTOTPCode(code) {
+		secret, err := app.totpSealer.Open(enrollment.SealedSecret)
+		if err != nil {
+			return false, err
+		}
+
+		step, ok := auth.ValidateTOTP(secret, code, time.Now())
+		if !ok {
+			return false, nil
+		}
+		return app.store.MFA.UseTOTPStep(ctx, user.ID, step)
+	}
+
+	if !allowRecovery {
+		return false, nil
+	}
+
+	if err := app.store.MFA.UseRecoveryCode(ctx, user.ID, auth.HashRecoveryCode(code)); err != nil {
+		if errors.Is(err, storage.ErrRecoveryCodeInvalid) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func isTOTPCode(code string) bool {
+	code = strings.ReplaceAll(code, " ", "")
+	if len(code) != 6 {
+		return false
+	}
+	for _, r := range code {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func newRecoveryCodes() ([]string, []string, error) {
+	codes, err := auth.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = auth.HashRecoveryCode(code)
+	}
+	return codes, hashes, nil
+}
@@ -2,14 +2,17 @@ package main
 
 import (
 	"context"
+	"crypto/subtle"
 	"encoding/base64"
 	"errors"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/puremike/event-mgt-api/internal/auth"
 	"github.com/puremike/event-mgt-api/internal/storage"
 )
 
@@ -61,76 +64,171 @@ func (app *application) AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		parts := strings.Split(authHeader, " ")
-		if len(parts) != 2 || parts[0] != "Bearer" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "authorization header is deformed"})
-			c.Abort()
+		app.authenticate(c, authHeader)
+	}
+}
+
+// OptionalAuthMiddleware authenticates the request when it carries a bearer
+// token or API key and lets anonymous requests through, for public endpoints
+// that show more to signed in users. Credentials that are present but invalid
+// are rejected.
+func (app *application) OptionalAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authHeader := c.GetHeader("Authorization")
+		if authHeader == "" {
+			c.Next()
 			return
 		}
 
-		token := strings.TrimSpace(parts[1])
+		app.authenticate(c, authHeader)
+	}
+}
 
-		jwtToken, err := app.jWTAuthenticator.ValidateToken(token)
-		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
-			c.Abort()
-			return
-		}
-		if jwtToken == nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
-			c.Abort()
-			return
-		}
+// authenticate accepts either a bearer access token or an API key sent as
+// "ApiKey <key>".
+func (app *application) authenticate(c *gin.Context, authHeader string) {
+	parts := strings.Split(authHeader, " ")
+	if len(parts) != 2 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authorization header is deformed"})
+		c.Abort()
+		return
+	}
 
-		claims, _ := jwtToken.Claims.(jwt.MapClaims)
+	switch parts[0] {
+	case "Bearer":
+		app.authenticateBearer(c, strings.TrimSpace(parts[1]))
+	case auth.APIKeyScheme:
+		app.authenticateAPIKey(c, strings.TrimSpace(parts[1]))
+	default:
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authorization header is deformed"})
+		c.Abort()
+	}
+}
 
-		userId, ok := claims["sub"].(float64)
-		if !ok {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid sub claim type"})
-			c.Abort()
-			return
-		}
+func (app *application) authenticateBearer(c *gin.Context, token string) {
+	jwtToken, err := app.jWTAuthenticator.ValidateToken(token)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+		c.Abort()
+		return
+	}
+	if jwtToken == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+		c.Abort()
+		return
+	}
 
-		user, err := app.getUserFromCache(c.Request.Context(), int(userId))
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve user"})
+	claims, _ := jwtToken.Claims.(jwt.MapClaims)
+
+	userId, ok := claims["sub"].(float64)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid sub claim type"})
+		c.Abort()
+		return
+	}
+
+	jti, _ := claims["jti"].(string)
+	sessionId, _ := claims["sid"].(string)
+	if typ, _ := claims["typ"].(string); typ != accessTokenType || jti == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+		c.Abort()
+		return
+	}
+
+	denied, err := app.denylist.Denied(c.Request.Context(), jti)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to verify token"})
+		c.Abort()
+		return
+	}
+	if denied {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "token has been revoked"})
+		c.Abort()
+		return
+	}
+
+	user, err := app.getUserFromCache(c.Request.Context(), int(userId))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve user"})
+		c.Abort()
+		return
+	}
+
+	if !user.Active(time.Now()) {
+		c.JSON(http.StatusForbidden, gin.H{"error": accountStatusError(user)})
+		c.Abort()
+		return
+	}
+
+	exp, _ := claims.GetExpirationTime()
+
+	c.Set("user", user)
+	c.Set("userId", user.ID)
+	c.Set("accessToken", accessToken{JTI: jti, SessionID: sessionId, ExpiresAt: exp.Time})
+	c.Next()
+}
+
+// authenticateAPIKey authenticates the request as the owner of the key. What
+// the key may do is limited by requireScope and requireSession.
+func (app *application) authenticateAPIKey(c *gin.Context, token string) {
+	prefix, ok := auth.ParseAPIKey(token)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid API key"})
+		c.Abort()
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	key, err := app.store.APIKeys.GetAPIKeyByPrefix(ctx, prefix)
+	if err != nil {
+		if errors.Is(err, storage.ErrAPIKeyNotFound) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid API key"})
 			c.Abort()
 			return
 		}
-
-		c.Set("user", user)
-		c.Set("userId", user.ID)
-		c.Next()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to verify API key"})
+		c.Abort()
+		return
 	}
-}
 
-func (app *application) getUserFromCache(ctx context.Context, id int) (*storage.User, error) {
+	if subtle.ConstantTimeCompare([]byte(key.KeyHash), []byte(auth.HashToken(token))) != 1 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid API key"})
+		c.Abort()
+		return
+	}
 
-	if !app.config.redisClientConfig.enabled {
-		return app.store.Users.GetUserByID(ctx, id)
+	if !key.Usable(time.Now()) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "API key is expired or revoked"})
+		c.Abort()
+		return
 	}
-	app.logger.Infow("cache hit", "key", "id", id)
 
-	user, err := app.cacheStorage.Users.Get(ctx, id)
+	user, err := app.getUserFromCache(ctx, key.UserID)
 	if err != nil {
-		return nil, err
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve user"})
+		c.Abort()
+		return
 	}
 
-	if user == nil {
-		app.logger.Infow("fetching user from DB", "key", "id", id)
-		user, err := app.store.Users.GetUserByID(ctx, id)
-		if err != nil {
-			if errors.Is(err, storage.ErrUserNotFound) {
-				return nil, storage.ErrUserNotFound
-			}
-			return nil, err
-		}
-		if err := app.cacheStorage.Users.Set(ctx, user); err != nil {
-			app.logger.Errorw("failed to set user in cache", "key", "id", id, "error", err)
-		}
-		return user, nil
+	if !user.Active(time.Now()) {
+		c.JSON(http.StatusForbidden, gin.H{"error": accountStatusError(user)})
+		c.Abort()
+		return
+	}
+
+	if err := app.store.APIKeys.TouchAPIKey(ctx, key.ID); err != nil {
+		app.logger.Errorw("failed to record API key use", "key", key.Prefix, "error", err)
 	}
-	return user, nil
+
+	c.Set("user", user)
+	c.Set("userId", user.ID)
+	c.Set("apiKey", key)
+	c.Next()
+}
+
+func (app *application) getUserFromCache(ctx context.Context, id int) (*storage.User, error) {
+	return app.cacheStorage.Users.Fetch(ctx, id, app.store.Users.GetUserByID)
 }
 
 func (app *application) eventContextMiddleWare() gin.HandlerFunc {
@@ -146,6 +244,11 @@ func (app *application) eventContextMiddleWare() gin.HandlerFunc {
 		event, err := app.getEventFromCache(c.Request.Context(), eventId)
 
 		if err != nil {
+			if errors.Is(err, storage.ErrEventNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "event not found"})
+				c.Abort()
+				return
+			}
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve event"})
 			c.Abort()
 			return
@@ -155,31 +258,142 @@ func (app *application) eventContextMiddleWare() gin.HandlerFunc {
 	}
 }
 
-func (app *application) getEventFromCache(ctx context.Context, id int) (*storage.Event, error) {
+// eventAccessMiddleware hides private events from everyone but their owner,
+// invitees and attendees, unless the request carries a valid invitation
+// token in the invite query parameter. Hidden events are reported as not
+// found so that their existence is not revealed. It must run after
+// eventContextMiddleWare.
+func (app *application) eventAccessMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		event := app.getEventFromContext(c)
+		if event.Visibility != storage.VisibilityPrivate {
+			c.Next()
+			return
+		}
+
+		if user := app.getUserFromContext(c); user.ID != 0 {
+			ok, err := app.store.Invitations.HasAccess(c.Request.Context(), event.ID, user.ID)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve event"})
+				c.Abort()
+				return
+			}
+			if ok {
+				c.Next()
+				return
+			}
+		}
+
+		if token := c.Query("invite"); token != "" {
+			if _, err := app.verifyInvitation(c.Request.Context(), event.ID, token); err == nil {
+				c.Next()
+				return
+			}
+		}
 
-	if !app.config.redisClientConfig.enabled {
-		return app.store.Events.GetEventByID(ctx, id)
+		c.JSON(http.StatusNotFound, gin.H{"error": "event not found"})
+		c.Abort()
 	}
-	app.logger.Infow("cache hit", "key", "id", id)
+}
 
-	event, err := app.cacheStorage.Events.Get(ctx, id)
-	if err != nil {
-		return nil, err
+// permissionActions describes each permission for the error returned when it
+// is missing.
+var permissionActions = map[storage.Permission]string{
+	storage.PermView:              "view this event",
+	storage.PermEdit:              "update this event",
+	storage.PermDelete:            "delete this event",
+	storage.PermManageAttendees:   "manage attendees of this event",
+	storage.PermManageInvitations: "manage invitations to this event",
+	storage.PermViewRoles:         "view roles on this event",
+	storage.PermManageRoles:       "manage roles on this event",
+	storage.PermTransferOwnership: "transfer ownership of this event",
+}
+
+// requireEventPermission only lets users whose role on the event grants the
+// permission through. It must run after AuthMiddleware and
+// eventContextMiddleWare, and stores the role in the context.
+func (app *application) requireEventPermission(p storage.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		event := app.getEventFromContext(c)
+		user := app.getUserFromContext(c)
+
+		role, err := app.store.Roles.GetRole(c.Request.Context(), event.ID, user.ID)
+		if err != nil && !errors.Is(err, storage.ErrEventRoleNotFound) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve event role"})
+			c.Abort()
+			return
+		}
+
+		if !role.Can(p) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "you are not authorized to " + permissionActions[p]})
+			c.Abort()
+			return
+		}
+
+		c.Set("eventRole", role)
+		c.Next()
 	}
+}
 
-	if event == nil {
-		app.logger.Infow("fetching event from DB", "key", "id", id)
-		event, err := app.store.Events.GetEventByID(ctx, id)
-		if err != nil {
-			if errors.Is(err, storage.ErrEventNotFound) {
-				return nil, storage.ErrEventNotFound
-			}
-			return nil, err
+// requireUserRole only lets users whose platform role is at least min
+// through. The role is read from the user record rather than the token's
+// role claim so that demotions apply to tokens that are already issued. It
+// must run after AuthMiddleware.
+func (app *application) requireUserRole(min storage.UserRole) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := app.getUserFromContext(c)
+
+		if !user.Role.AtLeast(min) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "you are not authorized to access this resource"})
+			c.Abort()
+			return
 		}
-		if err := app.cacheStorage.Events.Set(ctx, event); err != nil {
-			app.logger.Errorw("failed to set event in cache", "key", "id", id, "error", err)
+
+		c.Next()
+	}
+}
+
+// requireScope turns away requests authenticated with an API key that does
+// not grant the scope. Requests with an access token or without credentials
+// are let through. It must run after AuthMiddleware or
+// OptionalAuthMiddleware.
+func (app *application) requireScope(scope storage.APIKeyScope) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if key := app.getAPIKeyFromContext(c); key != nil && !key.HasScope(scope) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "API key does not have the " + string(scope) + " scope"})
+			c.Abort()
+			return
 		}
-		return event, nil
+
+		c.Next()
 	}
-	return event, nil
+}
+
+// requireSession turns away requests authenticated with an API key, for
+// account management that needs a login. It must run after AuthMiddleware.
+func (app *application) requireSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if app.getAPIKeyFromContext(c) != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": "this endpoint cannot be used with an API key"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// accountStatusError explains why an inactive user was turned away.
+func accountStatusError(user *storage.User) string {
+	if user.Status == storage.UserStatusBanned {
+		return "account is banned"
+	}
+	if user.SuspendedUntil != nil {
+		return "account is suspended until " + user.SuspendedUntil.UTC().Format(time.RFC3339)
+	}
+	return "account is suspended"
+}
+
+func (app *application) getEventFromCache(ctx context.Context, id int) (*storage.Event, error) {
+	return app.cacheStorage.Events.Fetch(ctx, id, app.store.Events.GetEventByID)
 }
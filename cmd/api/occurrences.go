@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/puremike/event-mgt-api/internal/storage"
+)
+
+// maxOccurrenceWindow bounds the from/to range that recurring events are
+// expanded over.
+const maxOccurrenceWindow = 366 * 24 * time.Hour
+
+const (
+	scopeThis      = "this"
+	scopeFollowing = "following"
+	scopeAll       = "all"
+)
+
+// parseOccurrenceQuery reads the optional occurrence query parameter, the
+// original RFC 3339 start time of an occurrence of a recurring event.
+func parseOccurrenceQuery(c *gin.Context) (*time.Time, error) {
+	value := c.Query("occurrence")
+	if value == "" {
+		return nil, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, errors.New("invalid occurrence, expected an RFC 3339 start time")
+	}
+	return &t, nil
+}
+
+// requireOccurrence resolves the occurrence an attendance request refers to.
+// Recurring events need an occurrence that is part of the series; one-off
+// events have none. It writes the error response when it returns false.
+func requireOccurrence(c *gin.Context, event *storage.Event) (*time.Time, bool) {
+	if !event.Recurring() {
+		return nil, true
+	}
+
+	occurrence, err := parseOccurrenceQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	if occurrence == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "occurrence is required for recurring events"})
+		return nil, false
+	}
+	if !event.HasOccurrence(*occurrence) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "occurrence not found"})
+		return nil, false
+	}
+
+	return occurrence, true
+}
+
+// parseEditScope reads the scope of an update or delete: a single occurrence
+// ("this"), an occurrence and every later one ("following") or the whole
+// series ("all", the default). Editing from the first occurrence onwards is
+// the same as editing the whole series. It writes the error response when it
+// returns false.
+func parseEditScope(c *gin.Context, event *storage.Event) (string, *time.Time, bool) {
+	scope := c.DefaultQuery("scope", scopeAll)
+
+	switch scope {
+	case scopeAll:
+		return scope, nil, true
+	case scopeThis, scopeFollowing:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "scope must be this, following or all"})
+		return "", nil, false
+	}
+
+	if !event.Recurring() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "scope only applies to recurring events"})
+		return "", nil, false
+	}
+
+	occurrence, ok := requireOccurrence(c, event)
+	if !ok {
+		return "", nil, false
+	}
+
+	if scope == scopeFollowing && occurrence.Equal(event.StartsAt) {
+		return scopeAll, nil, true
+	}
+	return scope, occurrence, true
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/puremike/event-mgt-api/internal/auth"
+	"github.com/puremike/event-mgt-api/internal/env"
+	"github.com/puremike/event-mgt-api/internal/storage"
+	"golang.org/x/oauth2"
+)
+
+const (
+	oidcFlowPurpose = "oidc-login"
+	oidcFlowTTL     = 10 * time.Minute
+	oidcFlowCookie  = "oidc_flow"
+	oidcCookiePath  = "/api/v1/auth/oidc"
+)
+
+var (
+	errOIDCEmailUnverified   = errors.New("the identity provider has not verified the email address")
+	errOIDCAccountUnverified = errors.New("an account with this email address exists but its email address is not verified")
+)
+
+// oidcFlowClaims is the state of a login in progress, kept in a signed
+// HttpOnly cookie between the redirect to the provider and the callback. The
+// PKCE verifier must not travel in the state parameter, which passes through
+// the provider.
+type oidcFlowClaims struct {
+	Provider string `json:"p"`
+	State    string `json:"s"`
+	Nonce    string `json:"n"`
+	Verifier string `json:"v"`
+}
+
+type oidcProvidersResponse struct {
+	Providers []string `json:"providers"`
+}
+
+// oidcConfigs reads the identity providers named in OIDC_PROVIDERS, each
+// configured through OIDC_<NAME>_ISSUER, OIDC_<NAME>_CLIENT_ID,
+// OIDC_<NAME>_CLIENT_SECRET and optionally OIDC_<NAME>_SCOPES, which
+// defaults to "email profile".
+func oidcConfigs(baseURL string) ([]auth.OIDCConfig, error) {
+	var configs []auth.OIDCConfig
+
+	for _, name := range strings.Split(env.GetEnvString("OIDC_PROVIDERS", ""), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		cfg := auth.OIDCConfig{
+			Name:         name,
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  fmt.Sprintf("%s%s/%s/callback", baseURL, oidcCookiePath, name),
+			Scopes:       strings.Fields(env.GetEnvString(prefix+"SCOPES", "email profile")),
+		}
+		if cfg.Issuer == "" || cfg.ClientID == "" {
+			return nil, fmt.Errorf("OIDC provider %q needs %sISSUER and %sCLIENT_ID", name, prefix, prefix)
+		}
+
+		configs = append(configs, cfg)
+	}
+
+	return configs, nil
+}
+
+func newOIDCProviders(configs []auth.OIDCConfig) map[string]*auth.OIDCProvider {
+	providers := make(map[string]*auth.OIDCProvider, len(configs))
+	for _, cfg := range configs {
+		providers[cfg.Name] = auth.NewOIDCProvider(cfg)
+	}
+	return providers
+}
+
+// GetOIDCProviders godoc
+//
+//	@Summary		List identity providers
+//	@Description	Lists the names of the configured OpenID Connect identity providers that can be used with /auth/oidc/{provider}/login.
+//	@Tags			Users
+//	@Produce		json
+//	@Success		200	{object}	oidcProvidersResponse
+//	@Router			/auth/oidc [get]
+func (app *application) getOIDCProviders(c *gin.Context) {
+	names := make([]string, 0, len(app.oidcProviders))
+	for name := range app.oidcProviders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	c.JSON(http.StatusOK, oidcProvidersResponse{Providers: names})
+}
+
+// OIDCLogin godoc
+//
+//	@Summary		Log in with an identity provider
+//	@Description	Starts an OpenID Connect authorization code login with PKCE by redirecting to the identity provider, which sends the user back to /auth/oidc/{provider}/callback. The login has to finish within ten minutes in the same browser.
+//	@Tags			Users
+//	@Param			provider	path	string	true	"Identity provider"
+//	@Success		302
+//	@Failure		404	{object}	error
+//	@Failure		502	{object}	error
+//	@Router			/auth/oidc/{provider}/login [get]
+func (app *application) oidcLogin(c *gin.Context) {
+	provider, ok := app.oidcProviders[c.Param("provider")]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "identity provider not found"})
+		return
+	}
+
+	state, err := auth.NewTokenID()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start login"})
+		return
+	}
+	nonce, err := auth.NewTokenID()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start login"})
+		return
+	}
+	claims := oidcFlowClaims{Provider: provider.Name(), State: state, Nonce: nonce, Verifier: oauth2.GenerateVerifier()}
+
+	redirectURL, err := provider.AuthCodeURL(c.Request.Context(), claims.State, claims.Nonce, claims.Verifier)
+	if err != nil {
+		app.logger.Errorw("failed to discover identity provider", "provider", provider.Name(), "error", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "identity provider is unavailable"})
+		return
+	}
+
+	flow, err := app.signer.Sign(oidcFlowPurpose, claims, time.Now().Add(oidcFlowTTL))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start login"})
+		return
+	}
+
+	app.setOIDCFlowCookie(c, flow, int(oidcFlowTTL.Seconds()))
+	c.Redirect(http.StatusFound, redirectURL)
+}
+
+// OIDCCallback godoc
+//
+//	@Summary		Identity provider callback
+//	@Description	Finishes an OpenID Connect login: redeems the authorization code, validates the ID token and logs in the user linked to the provider account. Unknown provider accounts are linked to the user with the same email address, or a new user is created, as long as the provider verified the address. Responds like /auth/login, including the MFA challenge when two-factor authentication is on.
+//	@Tags			Users
+//	@Produce		json
+//	@Param			provider	path		string	true	"Identity provider"
+//	@Param			code		query		string	true	"Authorization code"
+//	@Param			state		query		string	true	"State"
+//	@Success		200			{object}	loginResponse
+//	@Failure		400			{object}	error
+//	@Failure		401			{object}	error
+//	@Failure		403			{object}	error
+//	@Failure		404			{object}	error
+//	@Failure		409			{object}	error
+//	@Failure		500			{object}	error
+//	@Router			/auth/oidc/{provider}/callback [get]
+func (app *application) oidcCallback(c *gin.Context) {
+	provider, ok := app.oidcProviders[c.Param("provider")]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "identity provider not found"})
+		return
+	}
+
+	flow, err := c.Cookie(oidcFlowCookie)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "login was not started from this browser or has expired"})
+		return
+	}
+	app.setOIDCFlowCookie(c, "", -1)
+
+	var claims oidcFlowClaims
+	if err := app.signer.Verify(oidcFlowPurpose, flow, &claims); err != nil || claims.Provider != provider.Name() || claims.State != c.Query("state") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "login was not started from this browser or has expired"})
+		return
+	}
+
+	if providerErr := c.Query("error"); providerErr != "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "identity provider refused the login: " + providerErr})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	identity, err := provider.Exchange(ctx, c.Query("code"), claims.Nonce, claims.Verifier)
+	if err != nil {
+		app.logger.Infow("OIDC login failed", "provider", provider.Name(), "error", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "login with the identity provider failed"})
+		return
+	}
+
+	user, err := app.oidcUser(ctx, provider.Name(), identity)
+	if err != nil {
+		switch {
+		case errors.Is(err, errOIDCEmailUnverified):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		case errors.Is(err, errOIDCAccountUnverified):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error() + ", log in with your password and verify it first"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve user"})
+		}
+		return
+	}
+
+	if !user.Active(time.Now()) {
+		c.JSON(http.StatusForbidden, gin.H{"error": accountStatusError(user)})
+		return
+	}
+
+	app.respondWithLogin(c, user)
+}
+
+// oidcUser returns the user linked to the provider account, linking it to the
+// user with the same email address or creating a user the first time. Only
+// addresses verified on both sides are linked, so that nobody can take over
+// an account by registering its address first at either end.
+func (app *application) oidcUser(ctx context.Context, provider string, identity *auth.OIDCIdentity) (*storage.User, error) {
+	user, err := app.store.Identities.GetUserByIdentity(ctx, provider, identity.Subject)
+	if err == nil {
+		return user, nil
+	}
+	if !errors.Is(err, storage.ErrUserNotFound) {
+		return nil, err
+	}
+
+	if identity.Email == "" || !identity.EmailVerified {
+		return nil, errOIDCEmailUnverified
+	}
+
+	link := storage.Identity{Provider: provider, Subject: identity.Subject, Email: identity.Email}
+
+	user, err = app.store.Users.GetUserByEmail(ctx, identity.Email)
+	switch {
+	case err == nil:
+		if user.EmailVerifiedAt == nil {
+			return nil, errOIDCAccountUnverified
+		}
+		if err := app.store.Identities.LinkIdentity(ctx, user.ID, link); err != nil {
+			return nil, err
+		}
+		return user, nil
+	case errors.Is(err, storage.ErrUserNotFound):
+		name := identity.Name
+		if name == "" {
+			name = identity.Email
+		}
+		user = &storage.User{Name: name, Email: identity.Email}
+		if err := app.store.Identities.CreateUserWithIdentity(ctx, user, link); err != nil {
+			return nil, err
+		}
+		app.cacheUser(ctx, user)
+		return user, nil
+	default:
+		return nil, err
+	}
+}
+
+func (app *application) setOIDCFlowCookie(c *gin.Context, value string, maxAge int) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcFlowCookie, value, maxAge, oidcCookiePath, "", strings.HasPrefix(app.config.baseURL, "https://"), true)
+}
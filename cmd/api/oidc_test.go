@@ -0,0 +1,347 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/puremike/event-mgt-api/internal/auth"
+	"github.com/puremike/event-mgt-api/internal/auth/oidctest"
+	"github.com/puremike/event-mgt-api/internal/storage"
+	"github.com/puremike/event-mgt-api/internal/storage/cache"
+	"go.uber.org/zap"
+)
+
+// oidcTest runs logins through the OIDC handlers against a test issuer.
+type oidcTest struct {
+	issuer *oidctest.Issuer
+	db     *fakeDB
+	router *gin.Engine
+}
+
+func newOIDCTest(t *testing.T, script ...fakeStep) *oidcTest {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	issuer := oidctest.NewIssuer(t)
+	db, fake := newFakeDB(t, script...)
+	store := storage.NewStorage(db)
+
+	app := &application{
+		config: &config{
+			baseURL: "http://localhost:3000",
+			authConfig: authConfig{
+				iss:             "events.example.com",
+				aud:             "events.example.com",
+				tokenExp:        15 * time.Minute,
+				refreshTokenExp: 24 * time.Hour,
+			},
+		},
+		store:            store,
+		logger:           zap.NewNop().Sugar(),
+		jWTAuthenticator: auth.NewJWTAuthenticator("jwt-secret", "events.example.com", "events.example.com"),
+		signer:           auth.NewSigner("signing-secret"),
+		cacheStorage:     cache.NewCacheStorage(nil, store, cache.Config{TTL: time.Minute}),
+		oidcProviders: newOIDCProviders([]auth.OIDCConfig{
+			{Name: "test", Issuer: issuer.URL, ClientID: "client", ClientSecret: "secret", RedirectURL: "http://localhost:3000/api/v1/auth/oidc/test/callback"},
+			{Name: "other", Issuer: issuer.URL, ClientID: "other-client", ClientSecret: "secret", RedirectURL: "http://localhost:3000/api/v1/auth/oidc/other/callback"},
+		}),
+	}
+
+	router := gin.New()
+	router.GET(oidcCookiePath+"/:provider/login", app.oidcLogin)
+	router.GET(oidcCookiePath+"/:provider/callback", app.oidcCallback)
+
+	return &oidcTest{issuer: issuer, db: fake, router: router}
+}
+
+// login starts a login with the provider and returns the authorization URL
+// it redirects to along with the flow cookie.
+func (o *oidcTest) login(t *testing.T, provider string) (string, *http.Cookie) {
+	t.Helper()
+
+	w := o.serve(httptest.NewRequest(http.MethodGet, oidcCookiePath+"/"+provider+"/login", nil))
+	if w.Code != http.StatusFound {
+		t.Fatalf("login: status %d, body %s", w.Code, w.Body)
+	}
+
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == oidcFlowCookie {
+			if !cookie.HttpOnly {
+				t.Errorf("flow cookie is not HttpOnly")
+			}
+			return w.Header().Get("Location"), cookie
+		}
+	}
+	t.Fatal("login set no flow cookie")
+	return "", nil
+}
+
+// callback returns to the callback of the provider with query, presenting
+// cookie unless it is nil.
+func (o *oidcTest) callback(provider string, query url.Values, cookie *http.Cookie) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, oidcCookiePath+"/"+provider+"/callback?"+query.Encode(), nil)
+	if cookie != nil {
+		r.AddCookie(cookie)
+	}
+	return o.serve(r)
+}
+
+func (o *oidcTest) serve(r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	o.router.ServeHTTP(w, r)
+	return w
+}
+
+func TestOIDCCallbackFlow(t *testing.T) {
+	claims := jwt.MapClaims{"sub": "alice-sub", "email": "alice@example.com", "email_verified": true}
+
+	tests := []struct {
+		name     string
+		callback func(t *testing.T, o *oidcTest) *httptest.ResponseRecorder
+		want     int
+	}{
+		{
+			name: "mismatched state",
+			callback: func(t *testing.T, o *oidcTest) *httptest.ResponseRecorder {
+				authURL, cookie := o.login(t, "test")
+				code, _ := o.issuer.Authorize(t, authURL, claims)
+				return o.callback("test", url.Values{"code": {code}, "state": {"forged"}}, cookie)
+			},
+			want: http.StatusBadRequest,
+		},
+		{
+			name: "no flow cookie",
+			callback: func(t *testing.T, o *oidcTest) *httptest.ResponseRecorder {
+				authURL, _ := o.login(t, "test")
+				code, state := o.issuer.Authorize(t, authURL, claims)
+				return o.callback("test", url.Values{"code": {code}, "state": {state}}, nil)
+			},
+			want: http.StatusBadRequest,
+		},
+		{
+			name: "tampered flow cookie",
+			callback: func(t *testing.T, o *oidcTest) *httptest.ResponseRecorder {
+				authURL, cookie := o.login(t, "test")
+				code, state := o.issuer.Authorize(t, authURL, claims)
+				cookie.Value = "x" + cookie.Value
+				return o.callback("test", url.Values{"code": {code}, "state": {state}}, cookie)
+			},
+			want: http.StatusBadRequest,
+		},
+		{
+			// the cookie of a login started by the victim's browser does
+			// not fit the code and state of the attacker's login
+			name: "flow cookie of another login",
+			callback: func(t *testing.T, o *oidcTest) *httptest.ResponseRecorder {
+				_, cookie := o.login(t, "test")
+				authURL, _ := o.login(t, "test")
+				code, state := o.issuer.Authorize(t, authURL, claims)
+				return o.callback("test", url.Values{"code": {code}, "state": {state}}, cookie)
+			},
+			want: http.StatusBadRequest,
+		},
+		{
+			name: "flow cookie of another provider",
+			callback: func(t *testing.T, o *oidcTest) *httptest.ResponseRecorder {
+				authURL, cookie := o.login(t, "other")
+				code, state := o.issuer.Authorize(t, authURL, claims)
+				return o.callback("test", url.Values{"code": {code}, "state": {state}}, cookie)
+			},
+			want: http.StatusBadRequest,
+		},
+		{
+			name: "provider refused the login",
+			callback: func(t *testing.T, o *oidcTest) *httptest.ResponseRecorder {
+				authURL, cookie := o.login(t, "test")
+				_, state := o.issuer.Authorize(t, authURL, claims)
+				return o.callback("test", url.Values{"error": {"access_denied"}, "state": {state}}, cookie)
+			},
+			want: http.StatusUnauthorized,
+		},
+		{
+			name: "unknown code",
+			callback: func(t *testing.T, o *oidcTest) *httptest.ResponseRecorder {
+				authURL, cookie := o.login(t, "test")
+				code, state := o.issuer.Authorize(t, authURL, claims)
+				return o.callback("test", url.Values{"code": {code + "x"}, "state": {state}}, cookie)
+			},
+			want: http.StatusUnauthorized,
+		},
+		{
+			name: "unknown provider",
+			callback: func(t *testing.T, o *oidcTest) *httptest.ResponseRecorder {
+				_, cookie := o.login(t, "test")
+				return o.callback("unknown", url.Values{"code": {"code"}, "state": {"state"}}, cookie)
+			},
+			want: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// none of these get as far as looking up a user
+			o := newOIDCTest(t)
+			if w := tt.callback(t, o); w.Code != tt.want {
+				t.Errorf("callback: status %d, want %d, body %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+}
+
+func TestOIDCCallbackUser(t *testing.T) {
+	now := time.Now()
+	verified := &now
+	alice := storage.User{ID: 42, Name: "Alice", Email: "alice@example.com", Role: storage.UserRoleUser, Status: storage.UserStatusActive, EmailVerifiedAt: verified, CreatedAt: now}
+	unverifiedAlice := alice
+	unverifiedAlice.EmailVerifiedAt = nil
+	newUser := storage.User{ID: 43, Name: "Alice", Email: "alice@example.com", Role: storage.UserRoleUser, Status: storage.UserStatusActive, EmailVerifiedAt: verified, CreatedAt: now}
+
+	tests := []struct {
+		name   string
+		claims jwt.MapClaims
+		script []fakeStep
+		want   int
+		check  func(t *testing.T, db *fakeDB)
+	}{
+		{
+			name:   "linked identity",
+			claims: jwt.MapClaims{"sub": "alice-sub"},
+			script: []fakeStep{
+				rowStep("FROM user_identities", userRow(alice)),
+				refreshTokenStep(alice.ID),
+			},
+			want: http.StatusOK,
+		},
+		{
+			name:   "links the account with the verified email",
+			claims: jwt.MapClaims{"sub": "alice-sub", "email": "alice@example.com", "email_verified": true},
+			script: []fakeStep{
+				rowStep("FROM user_identities"),
+				rowStep("FROM users WHERE email", userRow(alice)),
+				{match: "INSERT INTO user_identities"},
+				refreshTokenStep(alice.ID),
+			},
+			want: http.StatusOK,
+			check: func(t *testing.T, db *fakeDB) {
+				checkArgs(t, db, "INSERT INTO user_identities", int64(alice.ID), "test", "alice-sub", "alice@example.com")
+			},
+		},
+		{
+			name:   "creates an account",
+			claims: jwt.MapClaims{"sub": "alice-sub", "email": "alice@example.com", "email_verified": true, "name": "Alice"},
+			script: []fakeStep{
+				rowStep("FROM user_identities"),
+				rowStep("FROM users WHERE email"),
+				rowStep("INSERT INTO users", userRow(newUser)),
+				{match: "INSERT INTO user_identities"},
+				refreshTokenStep(newUser.ID),
+			},
+			want: http.StatusOK,
+			check: func(t *testing.T, db *fakeDB) {
+				checkArgs(t, db, "INSERT INTO users", "Alice", "alice@example.com")
+				checkArgs(t, db, "INSERT INTO user_identities", int64(newUser.ID), "test", "alice-sub", "alice@example.com")
+			},
+		},
+		{
+			name:   "unverified email",
+			claims: jwt.MapClaims{"sub": "alice-sub", "email": "alice@example.com", "email_verified": false},
+			script: []fakeStep{
+				rowStep("FROM user_identities"),
+			},
+			want: http.StatusForbidden,
+		},
+		{
+			name:   "no email",
+			claims: jwt.MapClaims{"sub": "alice-sub", "email_verified": true},
+			script: []fakeStep{
+				rowStep("FROM user_identities"),
+			},
+			want: http.StatusForbidden,
+		},
+		{
+			name:   "account with an unverified email",
+			claims: jwt.MapClaims{"sub": "alice-sub", "email": "alice@example.com", "email_verified": true},
+			script: []fakeStep{
+				rowStep("FROM user_identities"),
+				rowStep("FROM users WHERE email", userRow(unverifiedAlice)),
+			},
+			want: http.StatusConflict,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := newOIDCTest(t, tt.script...)
+
+			authURL, cookie := o.login(t, "test")
+			code, state := o.issuer.Authorize(t, authURL, tt.claims)
+			w := o.callback("test", url.Values{"code": {code}, "state": {state}}, cookie)
+			if w.Code != tt.want {
+				t.Fatalf("callback: status %d, want %d, body %s", w.Code, tt.want, w.Body)
+			}
+
+			if tt.want == http.StatusOK {
+				var response loginResponse
+				if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+					t.Fatal(err)
+				}
+				if response.Token == "" || response.RefreshToken == "" {
+					t.Errorf("callback: response %s has no tokens", w.Body)
+				}
+			}
+			if tt.check != nil {
+				tt.check(t, o.db)
+			}
+		})
+	}
+}
+
+// rowStep answers the statement matching match with rows.
+func rowStep(match string, rows ...[]driver.Value) fakeStep {
+	step := fakeStep{match: match, rows: rows}
+	if len(rows) > 0 {
+		step.columns = make([]string, len(rows[0]))
+	}
+	return step
+}
+
+func refreshTokenStep(userId int) fakeStep {
+	now := time.Now()
+	return rowStep("INSERT INTO refresh_tokens", []driver.Value{int64(1), int64(userId), "family", "hash", "jti", now.Add(15 * time.Minute), now.Add(24 * time.Hour), nil, nil, now})
+}
+
+// userRow lists the user's columns in the order of storage.userColumns.
+func userRow(u storage.User) []driver.Value {
+	var verifiedAt driver.Value
+	if u.EmailVerifiedAt != nil {
+		verifiedAt = *u.EmailVerifiedAt
+	}
+	return []driver.Value{int64(u.ID), u.Name, u.Email, u.Password, string(u.Role), string(u.Status), nil, nil, verifiedAt, nil, nil, u.Privacy.ShowNameOnAttendeeLists, u.Privacy.HideAttendance, u.CreatedAt}
+}
+
+// checkArgs checks that the statement matching match ran once, starting with
+// the arguments want.
+func checkArgs(t *testing.T, db *fakeDB, match string, want ...driver.Value) {
+	t.Helper()
+
+	calls := db.calls(match)
+	if len(calls) != 1 {
+		t.Fatalf("%d statements match %q, want 1", len(calls), match)
+	}
+	if len(calls[0].args) < len(want) {
+		t.Fatalf("%q ran with %v, want %v", match, calls[0].args, want)
+	}
+	for i, arg := range want {
+		if calls[0].args[i] != arg {
+			t.Errorf("%q ran with %v, want %v", match, calls[0].args, want)
+			return
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/puremike/event-mgt-api/internal/storage"
+)
+
+// parsePageParams reads the sort, order, cursor and limit query parameters.
+func parsePageParams(c *gin.Context) (storage.PageParams, error) {
+	page := storage.PageParams{
+		Sort:   c.Query("sort"),
+		Cursor: c.Query("cursor"),
+	}
+
+	switch c.DefaultQuery("order", "asc") {
+	case "asc":
+	case "desc":
+		page.Desc = true
+	default:
+		return page, errors.New("order must be asc or desc")
+	}
+
+	if limit := c.Query("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 {
+			return page, errors.New("limit must be a positive integer")
+		}
+		page.Limit = n
+	}
+
+	return page, nil
+}
+
+// parseEventFilter reads the from, to, location and owner_id query parameters.
+// Dates may be given as RFC 3339 timestamps or as YYYY-MM-DD. The filter is
+// scoped to what the authenticated user, if any, may see.
+func parseEventFilter(c *gin.Context) (storage.EventFilter, error) {
+	filter := storage.EventFilter{Location: c.Query("location"), ViewerID: c.GetInt("userId")}
+
+	for _, bound := range []struct {
+		name string
+		dst  **time.Time
+	}{{"from", &filter.From}, {"to", &filter.To}} {
+		value := c.Query(bound.name)
+		if value == "" {
+			continue
+		}
+		t, err := parseQueryTime(value)
+		if err != nil {
+			return filter, fmt.Errorf("invalid %s date, expected RFC 3339 or YYYY-MM-DD", bound.name)
+		}
+		*bound.dst = &t
+	}
+
+	if ownerId := c.Query("owner_id"); ownerId != "" {
+		id, err := strconv.Atoi(ownerId)
+		if err != nil {
+			return filter, errors.New("invalid owner_id")
+		}
+		filter.OwnerID = id
+	}
+
+	return filter, nil
+}
+
+func parseQueryTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", value)
+}
+
+// listQueryError maps the errors returned by paginated store queries to a
+// response, reporting whether it handled the error.
+func listQueryError(c *gin.Context, err error) bool {
+	switch {
+	case errors.Is(err, storage.ErrInvalidCursor):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid cursor"})
+	case errors.Is(err, storage.ErrInvalidSort):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid sort field"})
+	default:
+		return false
+	}
+	return true
+}
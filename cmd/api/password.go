@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/puremike/event-mgt-api/internal/auth"
+	"github.com/puremike/event-mgt-api/internal/mailer"
+	"github.com/puremike/event-mgt-api/internal/storage"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type forgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type resetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,min=8"`
+}
+
+// ForgotPassword godoc
+//
+//	@Summary		Request password reset
+//	@Description	Emails a single-use password reset link to the address if it belongs to an account. Only one link is sent per account every PASSWORD_RESET_INTERVAL. The response is the same whether or not it does.
+//	@Tags			Users
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		forgotPasswordRequest	true	"Email"
+//	@Success		202		{object}	map[string]string
+//	@Failure		400		{object}	error
+//	@Router			/auth/password/forgot [post]
+func (app *application) forgotPassword(c *gin.Context) {
+	var payload forgotPasswordRequest
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// everything happens in the background so that the response time does
+	// not depend on whether the account exists
+	app.background(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), mailTimeout)
+		defer cancel()
+
+		if err := app.sendPasswordReset(ctx, payload.Email); err != nil {
+			app.logger.Errorw("failed to issue password reset", "error", err)
+		}
+	})
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "if an account exists for that email, a password reset link has been sent to it"})
+}
+
+func (app *application) sendPasswordReset(ctx context.Context, email string) error {
+	user, err := app.store.Users.GetUserByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	token, hash, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		return err
+	}
+
+	ttl := app.config.authConfig.passwordResetExp
+	if err := app.store.UserTokens.CreateTokenUnlessRecent(ctx, user.ID, storage.TokenPasswordReset, hash, time.Now().Add(ttl), app.config.authConfig.passwordResetInterval); err != nil {
+		if errors.Is(err, storage.ErrTokenRequestedTooSoon) {
+			return nil
+		}
+		return err
+	}
+
+	link := fmt.Sprintf("%s/reset-password?token=%s", app.config.frontendURL, url.QueryEscape(token))
+
+	return app.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nSomeone asked to reset the password of your account. To choose a new password, open this link within %s:\n\n%s\n\nIf this wasn't you, you can ignore this email.\n",
+			user.Name, ttl, link),
+	})
+}
+
+// ResetPassword godoc
+//
+//	@Summary		Reset password
+//	@Description	Sets a new password with a token from a password reset email. Tokens can be used once. Resetting the password logs the user out of every session.
+//	@Tags			Users
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		resetPasswordRequest	true	"Token and new password"
+//	@Success		204		{string}	string					"no content"
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Router			/auth/password/reset [post]
+func (app *application) resetPassword(c *gin.Context) {
+	var payload resetPasswordRequest
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(payload.Password), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to hash password"})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	userId, err := app.store.UserTokens.ResetPassword(ctx, auth.HashToken(payload.Token), string(hashedPassword))
+	if err != nil {
+		if errors.Is(err, storage.ErrUserTokenInvalid) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired token"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to reset password"})
+		return
+	}
+
+	app.invalidateCachedUser(ctx, userId)
+
+	refs, err := app.store.RefreshTokens.RevokeUserTokens(ctx, userId)
+	if err == nil {
+		err = app.denyAccessTokens(ctx, refs)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "password was reset but existing sessions could not be revoked"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/puremike/event-mgt-api/internal/storage"
+)
+
+// anonymousAttendeeName stands in for the names of attendees who do not show
+// them on attendee lists.
+const anonymousAttendeeName = "Anonymous attendee"
+
+type privacySettingsRequest struct {
+	ShowNameOnAttendeeLists *bool `json:"show_name_on_attendee_lists" binding:"required"`
+	HideAttendance          *bool `json:"hide_attendance" binding:"required"`
+}
+
+// attendeeResponse is an attendee as the caller may see them. Emails are only
+// shown to the event's owner and co-organizers.
+type attendeeResponse struct {
+	ID              int        `json:"id"`
+	Name            string     `json:"name"`
+	Email           string     `json:"email,omitempty"`
+	OccurrenceStart *time.Time `json:"occurrence_start,omitempty"`
+	Status          string     `json:"status"`
+}
+
+func newAttendeeResponses(page *storage.Page[storage.EventAttendee], viewer storage.AttendeeViewer) *storage.Page[attendeeResponse] {
+	attendees := make([]attendeeResponse, 0, len(page.Data))
+	for _, a := range page.Data {
+		r := attendeeResponse{ID: a.ID, Name: a.Name, OccurrenceStart: a.OccurrenceStart, Status: a.Status}
+		if r.Name == "" {
+			r.Name = anonymousAttendeeName
+		}
+		if viewer.Organizer {
+			r.Email = a.Email
+		}
+		attendees = append(attendees, r)
+	}
+
+	return &storage.Page[attendeeResponse]{Data: attendees, NextCursor: page.NextCursor, Total: page.Total}
+}
+
+// attendeeViewer works out how much of the event's attendees the caller may
+// see.
+func (app *application) attendeeViewer(c *gin.Context, event *storage.Event) (storage.AttendeeViewer, error) {
+	user := app.getUserFromContext(c)
+	if user.ID == 0 {
+		return storage.AttendeeViewer{}, nil
+	}
+
+	role, err := app.store.Roles.GetRole(c.Request.Context(), event.ID, user.ID)
+	if err != nil && !errors.Is(err, storage.ErrEventRoleNotFound) {
+		return storage.AttendeeViewer{}, err
+	}
+
+	return storage.AttendeeViewer{UserID: user.ID, Organizer: isOrganizerRole(role)}, nil
+}
+
+func isOrganizerRole(role storage.EventRole) bool {
+	return role == storage.RoleOwner || role == storage.RoleCoOrganizer
+}
+
+// UpdatePrivacySettings godoc
+//
+//	@Summary		Update privacy settings
+//	@Description	Sets whether other attendees see the authenticated user's name on attendee lists, and whether their attendance is hidden altogether. Owners and co-organizers of the events they attend always see them in full.
+//	@Tags			Profile
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		privacySettingsRequest	true	"Privacy settings"
+//	@Success		200		{object}	storage.PrivacySettings
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		500		{object}	error
+//	@Router			/me/privacy [put]
+//	@Security		BearerAuth
+func (app *application) updatePrivacySettings(c *gin.Context) {
+	var payload privacySettingsRequest
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user := app.getUserFromContext(c)
+	settings := storage.PrivacySettings{
+		ShowNameOnAttendeeLists: *payload.ShowNameOnAttendeeLists,
+		HideAttendance:          *payload.HideAttendance,
+	}
+
+	if err := app.store.Users.UpdatePrivacy(c.Request.Context(), user.ID, settings); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update privacy settings"})
+		return
+	}
+
+	app.invalidateCachedUser(c.Request.Context(), user.ID)
+	app.invalidateAttendeeLists(c.Request.Context(), user.ID)
+
+	c.JSON(http.StatusOK, settings)
+}
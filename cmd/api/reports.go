@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/puremike/event-mgt-api/internal/storage"
+)
+
+type createReportRequest struct {
+	TargetType storage.ReportTarget `json:"target_type" binding:"required,oneof=event user"`
+	TargetID   int                  `json:"target_id" binding:"required,min=1"`
+	Reason     string               `json:"reason" binding:"required,max=1000"`
+}
+
+// CreateReport godoc
+//
+//	@Summary		Report event or user
+//	@Description	Reports an event or another user to the moderators.
+//	@Tags			Reports
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		createReportRequest	true	"Report payload"
+//	@Success		201		{object}	storage.Report
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Router			/reports [post]
+//	@Security		BearerAuth
+func (app *application) createReport(c *gin.Context) {
+	var payload createReportRequest
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user := app.getUserFromContext(c)
+
+	switch payload.TargetType {
+	case storage.ReportTargetEvent:
+		if _, err := app.store.Events.GetEventByID(c.Request.Context(), payload.TargetID); err != nil {
+			if errors.Is(err, storage.ErrEventNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "event not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve event"})
+			return
+		}
+	case storage.ReportTargetUser:
+		if payload.TargetID == user.ID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "you cannot report yourself"})
+			return
+		}
+		if !app.requireUser(c, payload.TargetID) {
+			return
+		}
+	}
+
+	report := &storage.Report{
+		ReporterID: &user.ID,
+		TargetType: payload.TargetType,
+		TargetID:   payload.TargetID,
+		Reason:     payload.Reason,
+	}
+
+	if err := app.store.Reports.CreateReport(c.Request.Context(), report); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create report"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, report)
+}
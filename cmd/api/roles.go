@@ -0,0 +1,196 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/puremike/event-mgt-api/internal/storage"
+)
+
+type grantRoleRequest struct {
+	Role storage.EventRole `json:"role" binding:"required,oneof=co_organizer check_in_staff viewer"`
+}
+
+type transferOwnershipRequest struct {
+	UserID int `json:"user_id" binding:"required,min=1"`
+}
+
+// GetEventRoles godoc
+//
+//	@Summary		List event roles
+//	@Description	Lists everyone with a role on the event: its owner, co-organizers, check-in staff and viewers. Requires the owner or a co-organizer.
+//	@Tags			Roles
+//	@Produce		json
+//	@Param			id	path		int	true	"Event ID"
+//	@Success		200	{array}		storage.EventRoleGrant
+//	@Failure		403	{object}	error
+//	@Failure		404	{object}	error
+//	@Failure		500	{object}	error
+//	@Router			/events/{id}/roles [get]
+//	@Security		BearerAuth
+func (app *application) getEventRoles(c *gin.Context) {
+	event := app.getEventFromContext(c)
+
+	roles, err := app.store.Roles.GetRolesByEvent(c.Request.Context(), event.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve event roles"})
+		return
+	}
+
+	c.JSON(http.StatusOK, roles)
+}
+
+// GrantEventRole godoc
+//
+//	@Summary		Grant event role
+//	@Description	Grants a user a role on the event, replacing the role they had. Co-organizers can edit the event and manage attendees and invitations, check-in staff can manage attendees and viewers can see the event when it is private. Only the owner can grant roles; ownership moves with a transfer instead.
+//	@Tags			Roles
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		int					true	"Event ID"
+//	@Param			userId	path		int					true	"User ID"
+//	@Param			payload	body		grantRoleRequest	true	"Role"
+//	@Success		204		{string}	string				"no content"
+//	@Failure		400		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		409		{object}	error
+//	@Failure		500		{object}	error
+//	@Router			/events/{id}/roles/{userId} [put]
+//	@Security		BearerAuth
+func (app *application) grantEventRole(c *gin.Context) {
+	var payload grantRoleRequest
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	event := app.getEventFromContext(c)
+	authUser := app.getUserFromContext(c)
+
+	userId, err := strconv.Atoi(c.Param("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user ID"})
+		return
+	}
+
+	if !app.requireUser(c, userId) {
+		return
+	}
+
+	if err := app.store.Roles.SetRole(c.Request.Context(), event.ID, userId, payload.Role, authUser.ID); err != nil {
+		if errors.Is(err, storage.ErrOwnerRoleImmutable) {
+			c.JSON(http.StatusConflict, gin.H{"error": "the owner's role can only change through an ownership transfer"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to grant event role"})
+		return
+	}
+
+	// roles give access to private events
+	app.invalidateEventLists(c.Request.Context(), event.ID)
+
+	c.Status(http.StatusNoContent)
+}
+
+// RevokeEventRole godoc
+//
+//	@Summary		Revoke event role
+//	@Description	Removes a user's role on the event. The owner's role cannot be revoked. Only the owner can revoke roles.
+//	@Tags			Roles
+//	@Produce		json
+//	@Param			id		path		int		true	"Event ID"
+//	@Param			userId	path		int		true	"User ID"
+//	@Success		204		{string}	string	"no content"
+//	@Failure		400		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		409		{object}	error
+//	@Failure		500		{object}	error
+//	@Router			/events/{id}/roles/{userId} [delete]
+//	@Security		BearerAuth
+func (app *application) revokeEventRole(c *gin.Context) {
+	event := app.getEventFromContext(c)
+
+	userId, err := strconv.Atoi(c.Param("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user ID"})
+		return
+	}
+
+	if err := app.store.Roles.DeleteRole(c.Request.Context(), event.ID, userId); err != nil {
+		switch {
+		case errors.Is(err, storage.ErrOwnerRoleImmutable):
+			c.JSON(http.StatusConflict, gin.H{"error": "the owner's role can only change through an ownership transfer"})
+		case errors.Is(err, storage.ErrEventRoleNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "event role not found"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke event role"})
+		}
+		return
+	}
+
+	app.invalidateEventLists(c.Request.Context(), event.ID)
+
+	c.Status(http.StatusNoContent)
+}
+
+// TransferEventOwnership godoc
+//
+//	@Summary		Transfer event ownership
+//	@Description	Makes another user the owner of the event. The previous owner stays on as a co-organizer. Only the owner can transfer ownership.
+//	@Tags			Roles
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		int							true	"Event ID"
+//	@Param			payload	body		transferOwnershipRequest	true	"New owner"
+//	@Success		204		{string}	string						"no content"
+//	@Failure		400		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Router			/events/{id}/transfer [post]
+//	@Security		BearerAuth
+func (app *application) transferEventOwnership(c *gin.Context) {
+	var payload transferOwnershipRequest
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	event := app.getEventFromContext(c)
+
+	if !app.requireUser(c, payload.UserID) {
+		return
+	}
+
+	if err := app.store.Roles.TransferOwnership(c.Request.Context(), event.ID, payload.UserID); err != nil {
+		if errors.Is(err, storage.ErrEventNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "event not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to transfer event ownership"})
+		return
+	}
+
+	app.invalidateCachedEvent(c.Request.Context(), event.ID)
+	app.invalidateEventLists(c.Request.Context(), event.ID)
+
+	c.Status(http.StatusNoContent)
+}
+
+// requireUser checks that the user exists, writing the error response when it
+// does not.
+func (app *application) requireUser(c *gin.Context, userId int) bool {
+	if _, err := app.store.Users.GetUserByID(c.Request.Context(), userId); err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			return false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve user"})
+		return false
+	}
+	return true
+}
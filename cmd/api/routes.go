@@ -8,6 +8,7 @@ import (
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/puremike/event-mgt-api/internal/env"
+	"github.com/puremike/event-mgt-api/internal/storage"
 	swaggerfiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
 )
@@ -15,10 +16,16 @@ import (
 func (app *application) routes() http.Handler {
 	g := gin.Default()
 
+	// client addresses key the login throttle, so X-Forwarded-For is only
+	// taken from the configured proxies
+	if err := g.SetTrustedProxies(app.config.trustedProxies); err != nil {
+		app.logger.Fatalw("invalid TRUSTED_PROXIES", "error", err)
+	}
+
 	// Add CORS middleware
 	g.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{env.GetEnvString("CORS_ALLOWED_ORIGIN", "https://yourfrontend.com")},
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 		AllowHeaders:     []string{"Origin", "Authorization", "Content-Type"},
 		ExposeHeaders:    []string{"Content-Length"},
 		AllowCredentials: true,
@@ -26,6 +33,7 @@ func (app *application) routes() http.Handler {
 	}))
 
 	g.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerfiles.Handler))
+	g.GET("/.well-known/jwks.json", app.getJWKS)
 
 	v1 := g.Group("/api/v1")
 	{
@@ -37,32 +45,109 @@ func (app *application) routes() http.Handler {
 		}
 
 		events := v1.Group("/events")
+		events.Use(app.OptionalAuthMiddleware(), app.requireScope(storage.ScopeEventsRead))
 		{
 			events.GET("/", app.getAllEvents)
-			events.GET("/:id", app.getEventById)
-			events.GET("/:id/attendees", app.getEventAttendees)
+			events.GET("/search", app.searchEvents)
+
+			event := events.Group("/:id")
+			event.Use(app.eventContextMiddleWare(), app.eventAccessMiddleware())
+			{
+				event.GET("", app.getEventById)
+				event.GET("/attendees", app.getEventAttendees)
+				event.GET("/ics", app.getEventICS)
+			}
 		}
 
 		users := v1.Group("/auth")
 		{
 			users.POST("/register", app.registerUser)
-			users.GET("/:id", app.getUserById)
+			users.GET("/:id", app.OptionalAuthMiddleware(), app.getUserById)
 			users.POST("/login", app.loginUser)
+			users.POST("/login/mfa", app.loginMFA)
+			users.POST("/refresh", app.refreshToken)
+			users.POST("/password/forgot", app.forgotPassword)
+			users.POST("/password/reset", app.resetPassword)
+			users.GET("/verify", app.verifyEmail)
+			users.POST("/verify/resend", app.resendVerification)
+			users.POST("/magic-link", app.requestMagicLink)
+			users.GET("/magic-link/callback", app.magicLinkCallback)
+			users.GET("/email/confirm", app.confirmEmailChange)
+			users.GET("/oidc", app.getOIDCProviders)
+			users.GET("/oidc/:provider/login", app.oidcLogin)
+			users.GET("/oidc/:provider/callback", app.oidcCallback)
 		}
 
 		attendees := v1.Group("/attendees")
+		attendees.Use(app.OptionalAuthMiddleware(), app.requireScope(storage.ScopeEventsRead))
 		{
 			attendees.GET("/:userId/events", app.getEventsOfAttendee)
 		}
 
+		calendars := v1.Group("/users")
+		{
+			calendars.GET("/:id/calendar.ics", app.getUserCalendarFeed)
+		}
+
 		authGroup := v1.Group("/")
 		authGroup.Use(app.AuthMiddleware())
 		{
-			authGroup.POST("/events", app.createEvent)
-			authGroup.Use(app.eventContextMiddleWare()).PUT("/events/:id", app.updateEvent)
-			authGroup.Use(app.eventContextMiddleWare()).DELETE("/events/:id", app.deleteEvent)
-			authGroup.Use(app.eventContextMiddleWare()).POST("/events/:id/attendees/:userId", app.addAttendeeToEvent)
-			authGroup.Use(app.eventContextMiddleWare()).DELETE("/events/:id/attendees/:userId", app.deleteAttendeeFromEvent)
+			authGroup.POST("/events", app.requireScope(storage.ScopeEventsWrite), app.requireVerifiedEmail(app.config.verification.allowCreateEvents, "create events"), app.createEvent)
+
+			// account management needs a login, not an API key
+			account := authGroup.Group("/")
+			account.Use(app.requireSession())
+			{
+				account.GET("/me", app.getMe)
+				account.PATCH("/me", app.updateMe)
+				account.DELETE("/me", app.deleteMe)
+				account.POST("/me/password", app.changePassword)
+				account.PUT("/me/privacy", app.updatePrivacySettings)
+				account.POST("/auth/logout", app.logout)
+				account.POST("/auth/logout-all", app.logoutAll)
+				account.POST("/auth/mfa/totp", app.enrollTOTP)
+				account.POST("/auth/mfa/totp/verify", app.verifyTOTP)
+				account.DELETE("/auth/mfa/totp", app.disableTOTP)
+				account.POST("/auth/mfa/recovery-codes", app.regenerateRecoveryCodes)
+				account.POST("/calendar/feed-token", app.createCalendarFeedToken)
+				account.DELETE("/calendar/feed-token", app.revokeCalendarFeedToken)
+				account.POST("/reports", app.createReport)
+				account.POST("/api-keys", app.createAPIKey)
+				account.GET("/api-keys", app.getAPIKeys)
+				account.DELETE("/api-keys/:keyId", app.revokeAPIKey)
+			}
+
+			eventGroup := authGroup.Group("/events/:id")
+			eventGroup.Use(app.eventContextMiddleWare())
+			{
+				eventGroup.PUT("", app.requireScope(storage.ScopeEventsWrite), app.requireEventPermission(storage.PermEdit), app.updateEvent)
+				eventGroup.DELETE("", app.requireScope(storage.ScopeEventsWrite), app.requireEventPermission(storage.PermDelete), app.deleteEvent)
+				eventGroup.POST("/attendees/:userId", app.requireScope(storage.ScopeAttendeesWrite), app.requireEventPermission(storage.PermManageAttendees), app.addAttendeeToEvent)
+				eventGroup.DELETE("/attendees/:userId", app.requireScope(storage.ScopeAttendeesWrite), app.requireEventPermission(storage.PermManageAttendees), app.deleteAttendeeFromEvent)
+				eventGroup.GET("/waitlist", app.requireScope(storage.ScopeEventsRead), app.requireEventPermission(storage.PermManageAttendees), app.getEventWaitlist)
+				eventGroup.POST("/rsvp", app.requireScope(storage.ScopeAttendeesWrite), app.requireVerifiedEmail(app.config.verification.allowRSVP, "RSVP to events"), app.eventAccessMiddleware(), app.rsvpToEvent)
+				eventGroup.DELETE("/rsvp", app.requireScope(storage.ScopeAttendeesWrite), app.cancelRSVP)
+				eventGroup.POST("/invitations", app.requireScope(storage.ScopeEventsWrite), app.requireEventPermission(storage.PermManageInvitations), app.createInvitation)
+				eventGroup.GET("/invitations", app.requireScope(storage.ScopeEventsWrite), app.requireEventPermission(storage.PermManageInvitations), app.getEventInvitations)
+				eventGroup.DELETE("/invitations/:invitationId", app.requireScope(storage.ScopeEventsWrite), app.requireEventPermission(storage.PermManageInvitations), app.revokeInvitation)
+				eventGroup.POST("/invitations/accept", app.requireScope(storage.ScopeAttendeesWrite), app.acceptInvitation)
+				eventGroup.GET("/roles", app.requireScope(storage.ScopeEventsRead), app.requireEventPermission(storage.PermViewRoles), app.getEventRoles)
+				eventGroup.PUT("/roles/:userId", app.requireScope(storage.ScopeEventsWrite), app.requireEventPermission(storage.PermManageRoles), app.grantEventRole)
+				eventGroup.DELETE("/roles/:userId", app.requireScope(storage.ScopeEventsWrite), app.requireEventPermission(storage.PermManageRoles), app.revokeEventRole)
+				eventGroup.POST("/transfer", app.requireScope(storage.ScopeEventsWrite), app.requireEventPermission(storage.PermTransferOwnership), app.transferEventOwnership)
+			}
+
+			admin := authGroup.Group("/admin")
+			admin.Use(app.requireSession(), app.requireUserRole(storage.UserRoleModerator))
+			{
+				admin.GET("/users", app.getUsers)
+				admin.PUT("/users/:id/status", app.setUserStatus)
+				admin.PUT("/users/:id/role", app.requireUserRole(storage.UserRoleAdmin), app.setUserRole)
+				admin.DELETE("/users/:id/lockout", app.unlockUser)
+				admin.DELETE("/events/:id", app.forceDeleteEvent)
+				admin.GET("/reports", app.getReports)
+				admin.PUT("/reports/:id", app.updateReport)
+			}
 		}
 	}
 
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/puremike/event-mgt-api/internal/storage"
+)
+
+type rsvpRequest struct {
+	Status string `json:"status" binding:"required,oneof=going maybe declined"`
+}
+
+// RSVPToEvent godoc
+//
+//	@Summary		RSVP to an event
+//	@Description	Creates or updates the authenticated user's RSVP for an event, or for one occurrence of a recurring event. Going to a full event places the user on the waitlist.
+//	@Tags			Attendees
+//	@Accept			json
+//	@Produce		json
+//	@Param			id			path		int						true	"Event ID"
+//	@Param			occurrence	query		string					false	"Original RFC 3339 start time of the occurrence, required for recurring events"
+//	@Param			payload		body		rsvpRequest				true	"RSVP payload"
+//	@Success		200		{object}	storage.Attendee		"RSVP saved"
+//	@Success		202		{object}	storage.WaitlistEntry	"Event is full, user added to the waitlist"
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Router			/events/{id}/rsvp [post]
+//	@Security		BearerAuth
+func (app *application) rsvpToEvent(c *gin.Context) {
+	var payload rsvpRequest
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	event := app.getEventFromContext(c)
+	user := app.getUserFromContext(c)
+
+	occurrence, ok := requireOccurrence(c, event)
+	if !ok {
+		return
+	}
+
+	attendee := &storage.Attendee{
+		UserID:          user.ID,
+		EventID:         event.ID,
+		OccurrenceStart: occurrence,
+		Status:          payload.Status,
+	}
+
+	entry, err := app.store.Attendees.SetRSVP(c.Request.Context(), attendee)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save rsvp"})
+		return
+	}
+
+	app.invalidateAttendanceLists(c.Request.Context(), event.ID, user.ID)
+
+	if entry != nil {
+		c.JSON(http.StatusAccepted, entry)
+		return
+	}
+	c.JSON(http.StatusOK, attendee)
+}
+
+// CancelRSVP godoc
+//
+//	@Summary		Cancel RSVP
+//	@Description	Removes the authenticated user from an event's attendees or waitlist.
+//	@Tags			Attendees
+//	@Accept			json
+//	@Produce		json
+//	@Param			id			path		int		true	"Event ID"
+//	@Param			occurrence	query		string	false	"Original RFC 3339 start time of the occurrence, required for recurring events"
+//	@Success		204	{string}	string	"no content"
+//	@Failure		400	{object}	error
+//	@Failure		404	{object}	error
+//	@Failure		500	{object}	error
+//	@Router			/events/{id}/rsvp [delete]
+//	@Security		BearerAuth
+func (app *application) cancelRSVP(c *gin.Context) {
+	event := app.getEventFromContext(c)
+	user := app.getUserFromContext(c)
+
+	occurrence, ok := requireOccurrence(c, event)
+	if !ok {
+		return
+	}
+
+	app.removeAttendance(c, event.ID, user.ID, occurrence)
+}
+
+// removeAttendance removes the user from the event, falling back to the
+// waitlist when they hold no seat.
+func (app *application) removeAttendance(c *gin.Context, eventId, userId int, occurrence *time.Time) {
+	if err := app.store.Attendees.DeleteAttendee(c.Request.Context(), eventId, userId, occurrence); err != nil {
+		if errors.Is(err, storage.ErrAttendeeNotFound) {
+			app.deleteFromWaitlist(c, eventId, userId, occurrence)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete attendee"})
+		return
+	}
+
+	// the user promoted from the waitlist shows up on the event's lists too
+	app.invalidateAttendanceLists(c.Request.Context(), eventId, userId)
+
+	c.Status(http.StatusNoContent)
+}
@@ -32,7 +32,13 @@ func (app *application) server(mux http.Handler) error {
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 
-		shutdown <- server.Shutdown(ctx)
+		err := server.Shutdown(ctx)
+		if err == nil {
+			app.logger.Infow("waiting for background tasks")
+			app.wg.Wait()
+		}
+
+		shutdown <- err
 	}()
 
 	app.logger.Infow("starting server on port", "port", app.config.port, "environment", app.config.env)
@@ -48,3 +54,20 @@ func (app *application) server(mux http.Handler) error {
 
 	return nil
 }
+
+// background runs fn outside the request, such as sending mail, and lets a
+// graceful shutdown wait for it to finish.
+func (app *application) background(fn func()) {
+	app.wg.Add(1)
+
+	go func() {
+		defer app.wg.Done()
+		defer func() {
+			if err := recover(); err != nil {
+				app.logger.Errorw("background task panicked", "error", err)
+			}
+		}()
+
+		fn()
+	}()
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/puremike/event-mgt-api/internal/auth"
+	"github.com/puremike/event-mgt-api/internal/storage"
+)
+
+// accessTokenType is the typ claim of access tokens, which are the only
+// tokens AuthMiddleware accepts.
+const accessTokenType = "access"
+
+// accessToken is the authenticated request's token, stored in the context
+// by AuthMiddleware.
+type accessToken struct {
+	JTI       string
+	SessionID string
+	ExpiresAt time.Time
+}
+
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// signAccessToken signs a short-lived access token for the user. The sid
+// claim ties it to the refresh token family it was issued with so that it
+// can be revoked together with it.
+func (app *application) signAccessToken(user *storage.User, sessionId, jti string, expiresAt time.Time) (string, error) {
+	now := time.Now()
+
+	claims := jwt.MapClaims{
+		"sub": user.ID,
+		"exp": expiresAt.Unix(),
+		"iat": now.Unix(),
+		"nbf": now.Unix(),
+		"iss": app.config.authConfig.iss,
+		"aud": app.config.authConfig.aud,
+		"jti": jti,
+		"typ": accessTokenType,
+		"sid": sessionId,
+		// informational for clients; authorization checks the stored role
+		"role": user.Role,
+	}
+
+	return app.jWTAuthenticator.GenerateToken(claims)
+}
+
+// startSession issues the access and refresh tokens of a new login, which
+// starts a new refresh token family.
+func (app *application) startSession(ctx context.Context, user *storage.User) (*loginResponse, error) {
+	sessionId, err := auth.NewTokenID()
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken := &storage.RefreshToken{UserID: user.ID, FamilyID: sessionId}
+	response, err := app.prepareTokens(refreshToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := app.store.RefreshTokens.CreateRefreshToken(ctx, refreshToken); err != nil {
+		return nil, err
+	}
+
+	if response.Token, err = app.signAccessToken(user, sessionId, refreshToken.AccessJTI, refreshToken.AccessExpiresAt); err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+// respondWithLogin answers a login that passed the first factor: with an MFA
+// challenge when two-factor authentication is on and with the tokens of a new
+// session otherwise.
+func (app *application) respondWithLogin(c *gin.Context, user *storage.User) {
+	if user.TOTPEnabledAt != nil {
+		challenge, err := app.mfaChallenge(user)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate token"})
+			return
+		}
+		c.JSON(http.StatusOK, challenge)
+		return
+	}
+
+	response, err := app.startSession(c.Request.Context(), user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// prepareTokens generates the next refresh token and the jti of the access
+// token issued with it, returning the response without the signed access
+// token.
+func (app *application) prepareTokens(refreshToken *storage.RefreshToken) (*loginResponse, error) {
+	token, hash, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+
+	jti, err := auth.NewTokenID()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	refreshToken.TokenHash = hash
+	refreshToken.AccessJTI = jti
+	refreshToken.AccessExpiresAt = now.Add(app.config.authConfig.tokenExp)
+	refreshToken.ExpiresAt = now.Add(app.config.authConfig.refreshTokenExp)
+
+	return &loginResponse{RefreshToken: token, ExpiresAt: refreshToken.AccessExpiresAt}, nil
+}
+
+// denyAccessTokens adds access tokens that may still be in use to the
+// denylist.
+func (app *application) denyAccessTokens(ctx context.Context, refs []storage.AccessTokenRef) error {
+	for _, ref := range refs {
+		if err := app.denylist.Deny(ctx, ref.JTI, ref.ExpiresAt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// revokeSession revokes a refresh token family and the access tokens issued
+// with it.
+func (app *application) revokeSession(ctx context.Context, sessionId string) error {
+	refs, err := app.store.RefreshTokens.RevokeFamily(ctx, sessionId)
+	if err != nil {
+		return err
+	}
+	return app.denyAccessTokens(ctx, refs)
+}
+
+// RefreshToken godoc
+//
+//	@Summary		Refresh tokens
+//	@Description	Exchanges a refresh token for a new access token and refresh token. Refresh tokens can only be used once; presenting one that was already used revokes every token issued since the login it came from.
+//	@Tags			Users
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		refreshRequest	true	"Refresh token"
+//	@Success		200		{object}	loginResponse
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		500		{object}	error
+//	@Router			/auth/refresh [post]
+func (app *application) refreshToken(c *gin.Context) {
+	var payload refreshRequest
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	next := &storage.RefreshToken{}
+	response, err := app.prepareTokens(next)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate token"})
+		return
+	}
+
+	if err := app.store.RefreshTokens.RotateRefreshToken(ctx, auth.HashToken(payload.RefreshToken), next); err != nil {
+		switch {
+		case errors.Is(err, storage.ErrRefreshTokenReused):
+			app.logger.Warnw("refresh token reuse detected, revoking session", "userId", next.UserID)
+			if err := app.revokeSession(ctx, next.FamilyID); err != nil {
+				app.logger.Errorw("failed to revoke session", "userId", next.UserID, "error", err)
+			}
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid refresh token"})
+		case errors.Is(err, storage.ErrRefreshTokenNotFound):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid refresh token"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to refresh token"})
+		}
+		return
+	}
+
+	user, err := app.store.Users.GetUserByID(ctx, next.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve user"})
+		return
+	}
+
+	if !user.Active(time.Now()) {
+		if err := app.revokeSession(ctx, next.FamilyID); err != nil {
+			app.logger.Errorw("failed to revoke session", "userId", user.ID, "error", err)
+		}
+		c.JSON(http.StatusForbidden, gin.H{"error": accountStatusError(user)})
+		return
+	}
+
+	if response.Token, err = app.signAccessToken(user, next.FamilyID, next.AccessJTI, next.AccessExpiresAt); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// Logout godoc
+//
+//	@Summary		Logout
+//	@Description	Revokes the current access token and the refresh tokens of the login it belongs to.
+//	@Tags			Users
+//	@Produce		json
+//	@Success		204	{string}	string	"no content"
+//	@Failure		401	{object}	error
+//	@Failure		500	{object}	error
+//	@Router			/auth/logout [post]
+//	@Security		BearerAuth
+func (app *application) logout(c *gin.Context) {
+	ctx := c.Request.Context()
+	token := app.getAccessTokenFromContext(c)
+
+	if err := app.revokeSession(ctx, token.SessionID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to log out"})
+		return
+	}
+
+	if err := app.denylist.Deny(ctx, token.JTI, token.ExpiresAt); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to log out"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// LogoutAll godoc
+//
+//	@Summary		Logout all sessions
+//	@Description	Revokes every access and refresh token of the authenticated user, logging them out everywhere.
+//	@Tags			Users
+//	@Produce		json
+//	@Success		204	{string}	string	"no content"
+//	@Failure		401	{object}	error
+//	@Failure		500	{object}	error
+//	@Router			/auth/logout-all [post]
+//	@Security		BearerAuth
+func (app *application) logoutAll(c *gin.Context) {
+	ctx := c.Request.Context()
+	user := app.getUserFromContext(c)
+	token := app.getAccessTokenFromContext(c)
+
+	refs, err := app.store.RefreshTokens.RevokeUserTokens(ctx, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to log out"})
+		return
+	}
+
+	refs = append(refs, storage.AccessTokenRef{JTI: token.JTI, ExpiresAt: token.ExpiresAt})
+	if err := app.denyAccessTokens(ctx, refs); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to log out"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/puremike/event-mgt-api/internal/auth"
+	"github.com/puremike/event-mgt-api/internal/mailer"
+	"github.com/puremike/event-mgt-api/internal/storage"
+)
+
+type resendVerificationRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// sendVerificationEmail issues a new email verification token to the user
+// and mails them the link that redeems it, unless they were issued one less
+// than interval ago.
+func (app *application) sendVerificationEmail(ctx context.Context, user *storage.User, interval time.Duration) error {
+	token, hash, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		return err
+	}
+
+	ttl := app.config.verification.tokenExp
+	if err := app.store.UserTokens.CreateTokenUnlessRecent(ctx, user.ID, storage.TokenEmailVerification, hash, time.Now().Add(ttl), interval); err != nil {
+		if errors.Is(err, storage.ErrTokenRequestedTooSoon) {
+			return nil
+		}
+		return err
+	}
+
+	link := fmt.Sprintf("%s/api/v1/auth/verify?token=%s", app.config.baseURL, url.QueryEscape(token))
+
+	return app.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Hi %s,\n\nPlease confirm that this is your email address by opening this link within %s:\n\n%s\n\nIf you did not sign up, you can ignore this email.\n",
+			user.Name, ttl, link),
+	})
+}
+
+// verifyEmailInBackground sends the verification email without holding up
+// the request.
+func (app *application) verifyEmailInBackground(user *storage.User) {
+	app.background(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), mailTimeout)
+		defer cancel()
+
+		if err := app.sendVerificationEmail(ctx, user, 0); err != nil {
+			app.logger.Errorw("failed to send verification email", "userId", user.ID, "error", err)
+		}
+	})
+}
+
+// VerifyEmail godoc
+//
+//	@Summary		Verify email
+//	@Description	Confirms the user's email address with the token from a verification email.
+//	@Tags			Users
+//	@Produce		json
+//	@Param			token	query		string	true	"Verification token"
+//	@Success		200		{object}	map[string]string
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Router			/auth/verify [get]
+func (app *application) verifyEmail(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "token is required"})
+		return
+	}
+
+	userId, err := app.store.UserTokens.VerifyEmail(c.Request.Context(), auth.HashToken(token))
+	if err != nil {
+		if errors.Is(err, storage.ErrUserTokenInvalid) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired token"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to verify email"})
+		return
+	}
+
+	app.invalidateCachedUser(c.Request.Context(), userId)
+
+	c.JSON(http.StatusOK, gin.H{"message": "email address verified"})
+}
+
+// ResendVerification godoc
+//
+//	@Summary		Resend verification email
+//	@Description	Sends a new verification link to the address if it belongs to an account that is not verified yet. Only one email is sent per account every few minutes. The response is the same either way.
+//	@Tags			Users
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		resendVerificationRequest	true	"Email"
+//	@Success		202		{object}	map[string]string
+//	@Failure		400		{object}	error
+//	@Router			/auth/verify/resend [post]
+func (app *application) resendVerification(c *gin.Context) {
+	var payload resendVerificationRequest
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	app.background(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), mailTimeout)
+		defer cancel()
+
+		if err := app.resendVerificationEmail(ctx, payload.Email); err != nil {
+			app.logger.Errorw("failed to resend verification email", "error", err)
+		}
+	})
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "if an unverified account exists for that email, a verification link has been sent to it"})
+}
+
+func (app *application) resendVerificationEmail(ctx context.Context, email string) error {
+	user, err := app.store.Users.GetUserByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	if user.EmailVerifiedAt != nil {
+		return nil
+	}
+
+	return app.sendVerificationEmail(ctx, user, app.config.verification.resendInterval)
+}
+
+// requireVerifiedEmail turns away users who have not verified their email
+// address unless allowed is set. It must run after AuthMiddleware.
+func (app *application) requireVerifiedEmail(allowed bool, action string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !allowed && app.getUserFromContext(c).EmailVerifiedAt == nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": "verify your email address to " + action})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/puremike/event-mgt-api/internal/storage"
+)
+
+// GetEventWaitlist godoc
+//
+//	@Summary		Get event waitlist
+//	@Description	Get the waitlist for a given event, ordered by position. Each occurrence of a recurring event has its own waitlist; all of them are listed unless occurrence is given. Only users who may manage the event's attendees can see it.
+//	@Tags			Attendees
+//	@Accept			json
+//	@Produce		json
+//	@Param			id			path		int						true	"Event ID"
+//	@Param			occurrence	query		string					false	"Original RFC 3339 start time of an occurrence"
+//	@Success		200	{object}	storage.WaitlistEntry	"Waitlist successfully retrieved"
+//	@Failure		400	{object}	map[string]string		"Invalid event ID"
+//	@Failure		403	{object}	error
+//	@Failure		404	{object}	error
+//	@Failure		500	{object}	error
+//	@Router			/events/{id}/waitlist [get]
+//	@Security		BearerAuth
+func (app *application) getEventWaitlist(c *gin.Context) {
+	eventId := app.getEventFromContext(c).ID
+
+	occurrence, err := parseOccurrenceQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	entries, err := app.store.Waitlist.GetWaitlistByEvent(c.Request.Context(), eventId, occurrence)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve event waitlist"})
+		return
+	}
+
+	c.JSON(http.StatusOK, entries)
+}
+
+func (app *application) deleteFromWaitlist(c *gin.Context, eventId, userId int, occurrence *time.Time) {
+	if err := app.store.Waitlist.DeleteFromWaitlist(c.Request.Context(), eventId, userId, occurrence); err != nil {
+		if errors.Is(err, storage.ErrWaitlistEntryNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "attendee not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete waitlist entry"})
+		return
+	}
+
+	app.invalidateAttendanceLists(c.Request.Context(), eventId, userId)
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_attendees_event_user;
+ALTER TABLE attendees DROP COLUMN IF EXISTS status;
\ No newline at end of file
@@ -0,0 +1,7 @@
+-- keep the earliest row for any duplicated (event, user) pair before enforcing uniqueness
+DELETE FROM attendees a USING attendees b
+WHERE a.event_id = b.event_id AND a.user_id = b.user_id AND a.id > b.id;
+
+ALTER TABLE attendees ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'going' CHECK (status IN ('going', 'maybe', 'declined'));
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_attendees_event_user ON attendees (event_id, user_id);
\ No newline at end of file
@@ -0,0 +1,11 @@
+ALTER TABLE events ADD COLUMN IF NOT EXISTS date TIMESTAMP;
+
+UPDATE events SET date = (starts_at AT TIME ZONE timezone)::date;
+
+ALTER TABLE events ALTER COLUMN date SET NOT NULL;
+
+DROP INDEX IF EXISTS idx_events_starts_at;
+ALTER TABLE events DROP CONSTRAINT IF EXISTS events_ends_after_starts;
+ALTER TABLE events DROP COLUMN IF EXISTS starts_at;
+ALTER TABLE events DROP COLUMN IF EXISTS ends_at;
+ALTER TABLE events DROP COLUMN IF EXISTS timezone;
\ No newline at end of file
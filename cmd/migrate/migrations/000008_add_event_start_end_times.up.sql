@@ -0,0 +1,13 @@
+ALTER TABLE events ADD COLUMN IF NOT EXISTS starts_at TIMESTAMPTZ;
+ALTER TABLE events ADD COLUMN IF NOT EXISTS ends_at TIMESTAMPTZ;
+ALTER TABLE events ADD COLUMN IF NOT EXISTS timezone TEXT NOT NULL DEFAULT 'UTC';
+
+-- existing events only carry a date, so they become all-day events in UTC
+UPDATE events SET starts_at = date AT TIME ZONE 'UTC', ends_at = (date + INTERVAL '1 day') AT TIME ZONE 'UTC';
+
+ALTER TABLE events ALTER COLUMN starts_at SET NOT NULL;
+ALTER TABLE events ALTER COLUMN ends_at SET NOT NULL;
+ALTER TABLE events ADD CONSTRAINT events_ends_after_starts CHECK (ends_at > starts_at);
+ALTER TABLE events DROP COLUMN IF EXISTS date;
+
+CREATE INDEX IF NOT EXISTS idx_events_starts_at ON events (starts_at, id);
\ No newline at end of file
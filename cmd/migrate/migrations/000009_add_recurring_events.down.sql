@@ -0,0 +1,16 @@
+DELETE FROM attendees WHERE occurrence_start IS NOT NULL;
+DELETE FROM waitlist WHERE occurrence_start IS NOT NULL;
+
+DROP INDEX IF EXISTS idx_waitlist_event_user_occurrence;
+ALTER TABLE waitlist DROP COLUMN IF EXISTS occurrence_start;
+ALTER TABLE waitlist ADD CONSTRAINT waitlist_user_id_event_id_key UNIQUE (user_id, event_id);
+
+DROP INDEX IF EXISTS idx_attendees_event_user_occurrence;
+ALTER TABLE attendees DROP COLUMN IF EXISTS occurrence_start;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_attendees_event_user ON attendees (event_id, user_id);
+
+DROP TABLE IF EXISTS event_occurrence_overrides;
+
+ALTER TABLE events DROP COLUMN IF EXISTS series_ends_at;
+ALTER TABLE events DROP COLUMN IF EXISTS exdates;
+ALTER TABLE events DROP COLUMN IF EXISTS rrule;
\ No newline at end of file
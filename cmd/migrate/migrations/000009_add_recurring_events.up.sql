@@ -0,0 +1,29 @@
+ALTER TABLE events ADD COLUMN IF NOT EXISTS rrule TEXT;
+ALTER TABLE events ADD COLUMN IF NOT EXISTS exdates TIMESTAMPTZ[] NOT NULL DEFAULT '{}';
+-- end of the last occurrence, NULL while the series repeats forever
+ALTER TABLE events ADD COLUMN IF NOT EXISTS series_ends_at TIMESTAMPTZ;
+
+CREATE TABLE IF NOT EXISTS event_occurrence_overrides (
+    id BIGSERIAL PRIMARY KEY,
+    event_id INTEGER NOT NULL,
+    occurrence_start TIMESTAMPTZ NOT NULL,
+    name TEXT NOT NULL,
+    description TEXT NOT NULL,
+    starts_at TIMESTAMPTZ NOT NULL,
+    ends_at TIMESTAMPTZ NOT NULL,
+    location TEXT NOT NULL,
+    UNIQUE (event_id, occurrence_start),
+    CHECK (ends_at > starts_at),
+    FOREIGN KEY (event_id) REFERENCES events (id) ON DELETE CASCADE
+);
+
+-- attendance and waitlists are tracked per occurrence of a recurring event,
+-- identified by the occurrence's original start time
+ALTER TABLE attendees ADD COLUMN IF NOT EXISTS occurrence_start TIMESTAMPTZ;
+ALTER TABLE waitlist ADD COLUMN IF NOT EXISTS occurrence_start TIMESTAMPTZ;
+
+DROP INDEX IF EXISTS idx_attendees_event_user;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_attendees_event_user_occurrence ON attendees (event_id, user_id, (COALESCE(occurrence_start, '-infinity'::timestamptz)));
+
+ALTER TABLE waitlist DROP CONSTRAINT IF EXISTS waitlist_user_id_event_id_key;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_waitlist_event_user_occurrence ON waitlist (event_id, user_id, (COALESCE(occurrence_start, '-infinity'::timestamptz)));
\ No newline at end of file
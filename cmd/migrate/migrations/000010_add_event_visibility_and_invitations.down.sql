@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS event_invitees;
+DROP TABLE IF EXISTS event_invitations;
+
+DROP INDEX IF EXISTS idx_events_visibility;
+ALTER TABLE events DROP COLUMN IF EXISTS visibility;
\ No newline at end of file
@@ -0,0 +1,32 @@
+ALTER TABLE events ADD COLUMN IF NOT EXISTS visibility TEXT NOT NULL DEFAULT 'public'
+    CHECK (visibility IN ('public', 'unlisted', 'private'));
+
+CREATE INDEX IF NOT EXISTS idx_events_visibility ON events (visibility);
+
+-- invitation tokens are HMAC-signed and not stored; this table tracks their
+-- usage and revocation. max_uses is NULL for unlimited invitations
+CREATE TABLE IF NOT EXISTS event_invitations (
+    id BIGSERIAL PRIMARY KEY,
+    event_id INTEGER NOT NULL,
+    created_by INTEGER NOT NULL,
+    max_uses INTEGER CHECK (max_uses > 0),
+    uses INTEGER NOT NULL DEFAULT 0,
+    expires_at TIMESTAMPTZ NOT NULL,
+    revoked_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (event_id) REFERENCES events (id) ON DELETE CASCADE,
+    FOREIGN KEY (created_by) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_event_invitations_event_id ON event_invitations (event_id);
+
+CREATE TABLE IF NOT EXISTS event_invitees (
+    event_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    invitation_id BIGINT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (event_id, user_id),
+    FOREIGN KEY (event_id) REFERENCES events (id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    FOREIGN KEY (invitation_id) REFERENCES event_invitations (id) ON DELETE SET NULL
+);
\ No newline at end of file
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS event_roles;
\ No newline at end of file
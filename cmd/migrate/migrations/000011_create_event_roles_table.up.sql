@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS event_roles (
+    event_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    role TEXT NOT NULL CHECK (role IN ('owner', 'co_organizer', 'check_in_staff', 'viewer')),
+    granted_by INTEGER,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (event_id, user_id),
+    FOREIGN KEY (event_id) REFERENCES events (id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    FOREIGN KEY (granted_by) REFERENCES users (id) ON DELETE SET NULL
+);
+
+-- an event has exactly one owner, who is also recorded in events.owner_id
+CREATE UNIQUE INDEX IF NOT EXISTS idx_event_roles_owner ON event_roles (event_id) WHERE role = 'owner';
+CREATE INDEX IF NOT EXISTS idx_event_roles_user_id ON event_roles (user_id);
+
+INSERT INTO event_roles (event_id, user_id, role)
+SELECT id, owner_id, 'owner' FROM events
+ON CONFLICT DO NOTHING;
\ No newline at end of file
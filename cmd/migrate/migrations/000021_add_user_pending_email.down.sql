@@ -0,0 +1,6 @@
+DELETE FROM user_tokens WHERE purpose = 'email_change';
+
+ALTER TABLE user_tokens DROP CONSTRAINT IF EXISTS user_tokens_purpose_check;
+ALTER TABLE user_tokens ADD CONSTRAINT user_tokens_purpose_check CHECK (purpose IN ('password_reset', 'email_verification', 'magic_link'));
+
+ALTER TABLE users DROP COLUMN IF EXISTS pending_email;
\ No newline at end of file
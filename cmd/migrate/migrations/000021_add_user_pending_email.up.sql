@@ -0,0 +1,5 @@
+-- a changed email address only replaces email once it is verified
+ALTER TABLE users ADD COLUMN IF NOT EXISTS pending_email TEXT;
+
+ALTER TABLE user_tokens DROP CONSTRAINT IF EXISTS user_tokens_purpose_check;
+ALTER TABLE user_tokens ADD CONSTRAINT user_tokens_purpose_check CHECK (purpose IN ('password_reset', 'email_verification', 'magic_link', 'email_change'));
\ No newline at end of file
@@ -0,0 +1,2 @@
+ALTER TABLE users DROP COLUMN IF EXISTS hide_attendance;
+ALTER TABLE users DROP COLUMN IF EXISTS show_name_on_attendee_lists;
\ No newline at end of file
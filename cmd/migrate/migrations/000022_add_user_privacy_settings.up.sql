@@ -0,0 +1,2 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS show_name_on_attendee_lists BOOLEAN NOT NULL DEFAULT TRUE;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS hide_attendance BOOLEAN NOT NULL DEFAULT FALSE;
\ No newline at end of file
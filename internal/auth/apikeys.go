@@ -0,0 +1,40 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+)
+
+// APIKeyScheme is the Authorization scheme API keys are sent with.
+const APIKeyScheme = "ApiKey"
+
+const apiKeyTag = "emk"
+
+// GenerateAPIKey returns a new API key of the form emk_<prefix>_<secret>,
+// its prefix and the hash that should be stored in its place. The prefix is
+// not secret; it identifies the key in listings and lookups.
+func GenerateAPIKey() (key, prefix, hash string, err error) {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", "", err
+	}
+	prefix = hex.EncodeToString(b)
+
+	secret, _, err := GenerateOpaqueToken()
+	if err != nil {
+		return "", "", "", err
+	}
+
+	key = apiKeyTag + "_" + prefix + "_" + secret
+	return key, prefix, HashToken(key), nil
+}
+
+// ParseAPIKey returns the prefix of a key in the format of GenerateAPIKey.
+func ParseAPIKey(key string) (prefix string, ok bool) {
+	parts := strings.SplitN(key, "_", 3)
+	if len(parts) != 3 || parts[0] != apiKeyTag || parts[1] == "" || parts[2] == "" {
+		return "", false
+	}
+	return parts[1], true
+}
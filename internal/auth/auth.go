@@ -6,3 +6,9 @@ type Authenticator interface {
 	GenerateToken(claims jwt.Claims) (string, error)
 	ValidateToken(token string) (*jwt.Token, error)
 }
+
+// KeyPublisher is implemented by authenticators whose tokens can be verified
+// with published public keys.
+type KeyPublisher interface {
+	JWKS() JWKS
+}
@@ -0,0 +1,13 @@
+package auth
+
+import (
+	"context"
+	"time"
+)
+
+// Denylist records access tokens that were revoked before they expired, by
+// their jti claim. Entries only need to be kept until the token expires.
+type Denylist interface {
+	Deny(ctx context.Context, jti string, expiresAt time.Time) error
+	Denied(ctx context.Context, jti string) (bool, error)
+}
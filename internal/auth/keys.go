@@ -0,0 +1,20 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// deriveKey derives a 256-bit key for purpose from secret with HKDF, so that
+// one configured secret can key several uses without any two of them sharing
+// a key.
+func deriveKey(secret, purpose string) []byte {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, []byte(secret), nil, []byte(purpose)), key); err != nil {
+		// HKDF-SHA256 only runs out after 8160 bytes
+		panic(err)
+	}
+	return key
+}
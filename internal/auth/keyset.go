@@ -0,0 +1,246 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var ErrNoSigningKey = errors.New("no signing key is active")
+
+// SigningKey is one key of a KeySetAuthenticator. Private is nil for keys
+// that are only kept to verify tokens signed before they were rotated out.
+type SigningKey struct {
+	ID         string
+	ActiveFrom time.Time
+	Method     jwt.SigningMethod
+	Private    crypto.Signer
+	Public     crypto.PublicKey
+}
+
+// KeySetAuthenticator signs tokens with RS256 or EdDSA keys identified by the
+// kid header. Tokens are signed with the most recently activated key, so
+// scheduling a rotation is a matter of adding a key with a future
+// ActiveFrom; older keys keep verifying the tokens they signed until they
+// are removed from the set.
+type KeySetAuthenticator struct {
+	keys     []*SigningKey
+	iss, aud string
+}
+
+func NewKeySetAuthenticator(keys []*SigningKey, iss, aud string) (*KeySetAuthenticator, error) {
+	if len(keys) == 0 {
+		return nil, ErrNoSigningKey
+	}
+
+	seen := map[string]bool{}
+	for _, key := range keys {
+		if seen[key.ID] {
+			return nil, fmt.Errorf("duplicate key id %q", key.ID)
+		}
+		seen[key.ID] = true
+	}
+
+	sorted := append([]*SigningKey(nil), keys...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].ActiveFrom.After(sorted[j].ActiveFrom) })
+
+	return &KeySetAuthenticator{keys: sorted, iss: iss, aud: aud}, nil
+}
+
+// signingKey returns the key that signs new tokens: the most recently
+// activated key that has a private part.
+func (k *KeySetAuthenticator) signingKey(now time.Time) (*SigningKey, error) {
+	for _, key := range k.keys {
+		if key.Private != nil && !key.ActiveFrom.After(now) {
+			return key, nil
+		}
+	}
+	return nil, ErrNoSigningKey
+}
+
+func (k *KeySetAuthenticator) GenerateToken(claims jwt.Claims) (string, error) {
+	key, err := k.signingKey(time.Now())
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+
+	return token.SignedString(key.Private)
+}
+
+func (k *KeySetAuthenticator) ValidateToken(token string) (*jwt.Token, error) {
+	return jwt.Parse(token, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		for _, key := range k.keys {
+			if key.ID != kid {
+				continue
+			}
+			if t.Method.Alg() != key.Method.Alg() {
+				return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+			}
+			return key.Public, nil
+		}
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	},
+		jwt.WithAudience(k.aud),
+		jwt.WithIssuer(k.iss),
+		jwt.WithExpirationRequired(),
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}))
+}
+
+// JWK is a public key in JSON Web Key format.
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS publishes the public half of every key, including keys scheduled for
+// the future so that verifiers have them before the first token they sign.
+func (k *KeySetAuthenticator) JWKS() JWKS {
+	set := JWKS{Keys: make([]JWK, 0, len(k.keys))}
+	for _, key := range k.keys {
+		jwk := JWK{KeyID: key.ID, Use: "sig", Algorithm: key.Method.Alg()}
+		switch pub := key.Public.(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
+
+// ParseKeySpecs loads the keys listed in spec, a comma separated list of
+// kid=path entries with an optional @RFC3339 activation time, for example
+// "2025-01=/keys/jan.pem,2025-07=/keys/jul.pem@2025-07-01T00:00:00Z".
+// Entries without an activation time are active immediately.
+func ParseKeySpecs(spec string) ([]*SigningKey, error) {
+	var keys []*SigningKey
+
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		kid, path, ok := strings.Cut(entry, "=")
+		if !ok || kid == "" || path == "" {
+			return nil, fmt.Errorf("invalid key entry %q, expected kid=path[@active-from]", entry)
+		}
+
+		var activeFrom time.Time
+		if p, from, ok := strings.Cut(path, "@"); ok {
+			t, err := time.Parse(time.RFC3339, from)
+			if err != nil {
+				return nil, fmt.Errorf("invalid activation time for key %q: %w", kid, err)
+			}
+			path, activeFrom = p, t
+		}
+
+		key, err := LoadSigningKey(kid, path)
+		if err != nil {
+			return nil, err
+		}
+		key.ActiveFrom = activeFrom
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+// LoadSigningKey reads an RSA or Ed25519 key from a PEM file. Private keys
+// may be PKCS #8 or PKCS #1; a public key loads a verification-only key.
+func LoadSigningKey(kid, path string) (*SigningKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("key %q: no PEM data in %s", kid, path)
+	}
+
+	var parsed any
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		parsed, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("key %q: unsupported PEM block %q", kid, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("key %q: %w", kid, err)
+	}
+
+	key := &SigningKey{ID: kid}
+	if signer, ok := parsed.(crypto.Signer); ok {
+		key.Private = signer
+		parsed = signer.Public()
+	}
+
+	switch pub := parsed.(type) {
+	case *rsa.PublicKey:
+		if pub.N.BitLen() < 2048 {
+			return nil, fmt.Errorf("key %q: RSA keys must be at least 2048 bits", kid)
+		}
+		key.Method = jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		key.Method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("key %q: only RSA and Ed25519 keys are supported", kid)
+	}
+	key.Public = parsed
+
+	return key, nil
+}
+
+// GenerateEphemeralKey returns a random Ed25519 key that only lives as long
+// as the process, for development setups without configured keys.
+func GenerateEphemeralKey() (*SigningKey, error) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	kid, err := NewTokenID()
+	if err != nil {
+		return nil, err
+	}
+
+	return &SigningKey{ID: kid, Method: jwt.SigningMethodEdDSA, Private: priv, Public: pub}, nil
+}
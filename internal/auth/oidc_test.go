@@ -0,0 +1,161 @@
+package auth_test
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/puremike/event-mgt-api/internal/auth"
+	"github.com/puremike/event-mgt-api/internal/auth/oidctest"
+	"golang.org/x/oauth2"
+)
+
+func TestOIDCProviderAuthCodeURL(t *testing.T) {
+	issuer := oidctest.NewIssuer(t)
+	provider := auth.NewOIDCProvider(auth.OIDCConfig{Name: "test", Issuer: issuer.URL, ClientID: "client", RedirectURL: "https://app.example.com/callback", Scopes: []string{"email"}})
+
+	verifier := oauth2.GenerateVerifier()
+	authURL, err := provider.AuthCodeURL(context.Background(), "the-state", "the-nonce", verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+
+	want := map[string]string{
+		"client_id":             "client",
+		"redirect_uri":          "https://app.example.com/callback",
+		"response_type":         "code",
+		"scope":                 "openid email",
+		"state":                 "the-state",
+		"nonce":                 "the-nonce",
+		"code_challenge":        oauth2.S256ChallengeFromVerifier(verifier),
+		"code_challenge_method": "S256",
+	}
+	for param, value := range want {
+		if got := q.Get(param); got != value {
+			t.Errorf("%s = %q, want %q", param, got, value)
+		}
+	}
+	if strings.Contains(authURL, verifier) {
+		t.Errorf("authorization URL leaks the PKCE verifier: %s", authURL)
+	}
+}
+
+func TestOIDCProviderExchange(t *testing.T) {
+	tests := []struct {
+		name   string
+		claims jwt.MapClaims
+		// wrongVerifier and wrongNonce redeem the code with another PKCE
+		// verifier or nonce than the login was started with
+		wrongVerifier  bool
+		wrongNonce     bool
+		withoutIDToken bool
+		want           *auth.OIDCIdentity
+		wantErr        error
+	}{
+		{
+			name:   "verified email",
+			claims: jwt.MapClaims{"sub": "alice", "email": " alice@example.com ", "email_verified": true, "name": "Alice"},
+			want:   &auth.OIDCIdentity{Subject: "alice", Email: "alice@example.com", EmailVerified: true, Name: "Alice"},
+		},
+		{
+			name:   "email_verified as a string",
+			claims: jwt.MapClaims{"sub": "alice", "email": "alice@example.com", "email_verified": "true"},
+			want:   &auth.OIDCIdentity{Subject: "alice", Email: "alice@example.com", EmailVerified: true},
+		},
+		{
+			name:   "unverified email",
+			claims: jwt.MapClaims{"sub": "alice", "email": "alice@example.com", "email_verified": false},
+			want:   &auth.OIDCIdentity{Subject: "alice", Email: "alice@example.com"},
+		},
+		{
+			name:   "email_verified missing",
+			claims: jwt.MapClaims{"sub": "alice", "email": "alice@example.com"},
+			want:   &auth.OIDCIdentity{Subject: "alice", Email: "alice@example.com"},
+		},
+		{
+			name:          "wrong PKCE verifier",
+			claims:        jwt.MapClaims{"sub": "alice"},
+			wrongVerifier: true,
+			wantErr:       errAny,
+		},
+		{
+			name:       "wrong nonce",
+			claims:     jwt.MapClaims{"sub": "alice"},
+			wrongNonce: true,
+			wantErr:    auth.ErrOIDCNonceMismatch,
+		},
+		{
+			name:    "token for another client",
+			claims:  jwt.MapClaims{"sub": "alice", "aud": "other-client"},
+			wantErr: errAny,
+		},
+		{
+			name:    "token from another issuer",
+			claims:  jwt.MapClaims{"sub": "alice", "iss": "https://evil.example.com"},
+			wantErr: errAny,
+		},
+		{
+			name:    "expired token",
+			claims:  jwt.MapClaims{"sub": "alice", "exp": time.Now().Add(-time.Hour).Unix()},
+			wantErr: errAny,
+		},
+		{
+			name:           "no ID token",
+			claims:         jwt.MapClaims{"sub": "alice"},
+			withoutIDToken: true,
+			wantErr:        auth.ErrOIDCMissingIDToken,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			issuer := oidctest.NewIssuer(t)
+			issuer.WithoutIDToken = tt.withoutIDToken
+			provider := auth.NewOIDCProvider(auth.OIDCConfig{Name: "test", Issuer: issuer.URL, ClientID: "client", ClientSecret: "secret", RedirectURL: "https://app.example.com/callback"})
+
+			verifier, nonce := oauth2.GenerateVerifier(), "the-nonce"
+			authURL, err := provider.AuthCodeURL(ctx, "the-state", nonce, verifier)
+			if err != nil {
+				t.Fatal(err)
+			}
+			code, _ := issuer.Authorize(t, authURL, tt.claims)
+
+			if tt.wrongVerifier {
+				verifier = oauth2.GenerateVerifier()
+			}
+			if tt.wrongNonce {
+				nonce = "another-nonce"
+			}
+
+			identity, err := provider.Exchange(ctx, code, nonce, verifier)
+			switch {
+			case tt.wantErr == errAny:
+				if err == nil {
+					t.Fatalf("Exchange() = %+v, want an error", identity)
+				}
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Exchange() error = %v, want %v", err, tt.wantErr)
+				}
+			case err != nil:
+				t.Fatalf("Exchange() error = %v", err)
+			case *identity != *tt.want:
+				t.Errorf("Exchange() = %+v, want %+v", identity, tt.want)
+			}
+		})
+	}
+}
+
+// errAny stands for any error in test tables.
+var errAny = errors.New("any error")
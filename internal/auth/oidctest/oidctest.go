@@ -0,0 +1,169 @@
+// Package oidctest provides an OpenID Connect identity provider for tests.
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/puremike/event-mgt-api/internal/auth"
+)
+
+// Issuer serves discovery, a JWKS and a token endpoint that redeems the
+// codes handed out by Authorize. The token endpoint enforces PKCE, and the ID
+// tokens it returns are signed with a key published in the JWKS.
+type Issuer struct {
+	*httptest.Server
+
+	// WithoutIDToken leaves the ID token out of token responses, as plain
+	// OAuth 2.0 servers do.
+	WithoutIDToken bool
+
+	keys *auth.KeySetAuthenticator
+
+	mu     sync.Mutex
+	grants map[string]grant
+}
+
+// grant is what the issuer remembers about a code until it is redeemed.
+type grant struct {
+	clientID  string
+	challenge string
+	claims    jwt.MapClaims
+}
+
+// NewIssuer starts an issuer that is shut down at the end of the test.
+func NewIssuer(t testing.TB) *Issuer {
+	t.Helper()
+
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := &auth.SigningKey{ID: "test", Method: jwt.SigningMethodRS256, Private: private, Public: &private.PublicKey}
+	keys, err := auth.NewKeySetAuthenticator([]*auth.SigningKey{key}, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	i := &Issuer{keys: keys, grants: map[string]grant{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", i.discovery)
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, i.keys.JWKS())
+	})
+	mux.HandleFunc("/token", i.token)
+
+	i.Server = httptest.NewServer(mux)
+	t.Cleanup(i.Close)
+
+	return i
+}
+
+func (i *Issuer) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"issuer":                                i.URL,
+		"authorization_endpoint":                i.URL + "/authorize",
+		"token_endpoint":                        i.URL + "/token",
+		"jwks_uri":                              i.URL + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+	})
+}
+
+// Authorize logs a user in at authURL, the authorization URL a client sent
+// them to, and returns the code and state the provider redirects back with.
+// The ID token of the code carries claims on top of the issuer, audience,
+// expiry and the nonce of authURL; claims may override any of them.
+func (i *Issuer) Authorize(t testing.TB, authURL string, claims jwt.MapClaims) (code, state string) {
+	t.Helper()
+
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("code_challenge_method") != "S256" {
+		t.Fatalf("authorization URL has no S256 PKCE challenge: %s", authURL)
+	}
+
+	now := time.Now()
+	idClaims := jwt.MapClaims{
+		"iss":   i.URL,
+		"aud":   q.Get("client_id"),
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+		"nonce": q.Get("nonce"),
+	}
+	for k, v := range claims {
+		idClaims[k] = v
+	}
+
+	code, err = auth.NewTokenID()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	i.mu.Lock()
+	i.grants[code] = grant{clientID: q.Get("client_id"), challenge: q.Get("code_challenge"), claims: idClaims}
+	i.mu.Unlock()
+
+	return code, q.Get("state")
+}
+
+func (i *Issuer) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	clientID, _, ok := r.BasicAuth()
+	if !ok {
+		clientID = r.PostForm.Get("client_id")
+	}
+
+	i.mu.Lock()
+	g, ok := i.grants[r.PostForm.Get("code")]
+	delete(i.grants, r.PostForm.Get("code"))
+	i.mu.Unlock()
+
+	if !ok || g.clientID != clientID || r.PostForm.Get("grant_type") != "authorization_code" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != g.challenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "PKCE verification failed"})
+		return
+	}
+
+	response := map[string]any{"access_token": "access-token", "token_type": "Bearer", "expires_in": 3600}
+	if !i.WithoutIDToken {
+		idToken, err := i.keys.GenerateToken(g.claims)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+			return
+		}
+		response["id_token"] = idToken
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,179 @@
+package auth
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AttemptStore counts consecutive failed attempts per key. Failures older
+// than window are forgotten.
+type AttemptStore interface {
+	// Attempt records an attempt as a failure up front, unless the key still
+	// has to wait after its last failure, in one atomic step so that
+	// concurrent attempts each see the others. delays[n] is the wait once n
+	// failures are recorded, and the last delay also covers any more. It
+	// returns when the wait ends for an attempt that was turned away without
+	// being recorded, and the zero time for one that was recorded.
+	Attempt(ctx context.Context, key string, window time.Duration, delays []time.Duration) (time.Time, error)
+	// Forgive takes back an attempt that turned out to succeed.
+	Forgive(ctx context.Context, key string) error
+	Reset(ctx context.Context, key string) error
+}
+
+// ThrottlePolicy allows FreeAttempts failures, then makes each further
+// attempt wait twice as long as the previous one starting at BaseDelay, and
+// locks the key out for Lockout once MaxAttempts failures are reached.
+type ThrottlePolicy struct {
+	FreeAttempts int
+	MaxAttempts  int
+	BaseDelay    time.Duration
+	Lockout      time.Duration
+	Window       time.Duration
+}
+
+// wait is how long after the last failure the next attempt is allowed.
+func (p ThrottlePolicy) wait(failures int) time.Duration {
+	switch {
+	case failures < p.FreeAttempts:
+		return 0
+	case failures >= p.MaxAttempts:
+		return p.Lockout
+	}
+
+	d := p.BaseDelay << (failures - p.FreeAttempts)
+	if d <= 0 || d > p.Lockout {
+		return p.Lockout
+	}
+	return d
+}
+
+// delays lists the wait after each number of failures up to MaxAttempts, for
+// AttemptStore.Attempt.
+func (p ThrottlePolicy) delays() []time.Duration {
+	delays := make([]time.Duration, p.MaxAttempts+1)
+	for failures := range delays {
+		delays[failures] = p.wait(failures)
+	}
+	return delays
+}
+
+// LoginThrottle slows down password guessing against a single account and
+// from a single client. Accounts are keyed by email so that unknown emails
+// are throttled exactly like real ones. Second factor codes are counted per
+// user apart from passwords, so that knowing the password does not reset
+// guessing of the code.
+type LoginThrottle struct {
+	store   AttemptStore
+	Account ThrottlePolicy
+	IP      ThrottlePolicy
+	MFA     ThrottlePolicy
+}
+
+func NewLoginThrottle(store AttemptStore) *LoginThrottle {
+	return &LoginThrottle{
+		store: store,
+		Account: ThrottlePolicy{
+			FreeAttempts: 5,
+			MaxAttempts:  10,
+			BaseDelay:    time.Second,
+			Lockout:      15 * time.Minute,
+			Window:       time.Hour,
+		},
+		// clients behind a shared address get more room
+		IP: ThrottlePolicy{
+			FreeAttempts: 20,
+			MaxAttempts:  100,
+			BaseDelay:    time.Second,
+			Lockout:      15 * time.Minute,
+			Window:       time.Hour,
+		},
+		MFA: ThrottlePolicy{
+			FreeAttempts: 5,
+			MaxAttempts:  10,
+			BaseDelay:    time.Second,
+			Lockout:      15 * time.Minute,
+			Window:       time.Hour,
+		},
+	}
+}
+
+func accountKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+func mfaKey(userId int) string {
+	return "mfa:" + strconv.Itoa(userId)
+}
+
+type throttleCheck struct {
+	key    string
+	policy ThrottlePolicy
+}
+
+// attempt makes the attempt against each key in turn and returns how long
+// the client has to wait when one of them turns it away. Turned away
+// attempts are not counted against that key or the ones after it, so that
+// they cannot push a lockout further out.
+func (t *LoginThrottle) attempt(ctx context.Context, checks ...throttleCheck) (time.Duration, error) {
+	for _, check := range checks {
+		until, err := t.store.Attempt(ctx, check.key, check.policy.Window, check.policy.delays())
+		if err != nil {
+			return 0, err
+		}
+		if wait := time.Until(until); wait > 0 {
+			return wait, nil
+		}
+	}
+
+	return 0, nil
+}
+
+// Attempt records a login attempt against both the client and the account
+// before the password is checked, and returns how long the client has to
+// wait before it may try again, or zero if it may try now. Attempts count as
+// failures until they succeed, except the ones turned away. The client is
+// checked first, so that a client that has to wait cannot add to the
+// failures of the accounts it tries.
+func (t *LoginThrottle) Attempt(ctx context.Context, email, ip string) (time.Duration, error) {
+	return t.attempt(ctx, throttleCheck{ipKey(ip), t.IP}, throttleCheck{accountKey(email), t.Account})
+}
+
+// Succeeded clears the account's failures and takes back the client's
+// attempt once the login is complete, after the second factor when the
+// account has one. The client's earlier failures are kept so that a valid
+// login to one account does not reset guessing against others.
+func (t *LoginThrottle) Succeeded(ctx context.Context, email, ip string) error {
+	if err := t.store.Reset(ctx, accountKey(email)); err != nil {
+		return err
+	}
+	return t.store.Forgive(ctx, ipKey(ip))
+}
+
+// AttemptSecondFactor is Attempt for a second factor code of the user.
+func (t *LoginThrottle) AttemptSecondFactor(ctx context.Context, userId int, ip string) (time.Duration, error) {
+	return t.attempt(ctx, throttleCheck{ipKey(ip), t.IP}, throttleCheck{mfaKey(userId), t.MFA})
+}
+
+// SecondFactorSucceeded clears the user's second factor failures and takes
+// back the client's attempt.
+func (t *LoginThrottle) SecondFactorSucceeded(ctx context.Context, userId int, ip string) error {
+	if err := t.store.Reset(ctx, mfaKey(userId)); err != nil {
+		return err
+	}
+	return t.store.Forgive(ctx, ipKey(ip))
+}
+
+// Unlock lifts a lockout of the account, of its password and its second
+// factor alike.
+func (t *LoginThrottle) Unlock(ctx context.Context, userId int, email string) error {
+	if err := t.store.Reset(ctx, accountKey(email)); err != nil {
+		return err
+	}
+	return t.store.Reset(ctx, mfaKey(userId))
+}
@@ -0,0 +1,316 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryAttempts is an AttemptStore kept in memory.
+type memoryAttempts struct {
+	mu       sync.Mutex
+	failures map[string]int
+	last     map[string]time.Time
+	err      error
+}
+
+func newMemoryAttempts() *memoryAttempts {
+	return &memoryAttempts{failures: map[string]int{}, last: map[string]time.Time{}}
+}
+
+func (m *memoryAttempts) Attempt(ctx context.Context, key string, window time.Duration, delays []time.Duration) (time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.err != nil {
+		return time.Time{}, m.err
+	}
+
+	failures, last := m.failures[key], m.last[key]
+	if time.Since(last) >= window {
+		failures = 0
+	}
+	if until := last.Add(delays[min(failures, len(delays)-1)]); time.Now().Before(until) {
+		return until, nil
+	}
+	m.failures[key], m.last[key] = failures+1, time.Now()
+
+	return time.Time{}, nil
+}
+
+func (m *memoryAttempts) Forgive(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.failures[key] > 0 {
+		m.failures[key]--
+	}
+	return m.err
+}
+
+func (m *memoryAttempts) Reset(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.failures, key)
+	delete(m.last, key)
+	return m.err
+}
+
+// elapse moves every failure d into the past, as if d had passed.
+func (m *memoryAttempts) elapse(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key, last := range m.last {
+		m.last[key] = last.Add(-d)
+	}
+}
+
+func (m *memoryAttempts) count(key string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.failures[key]
+}
+
+func TestThrottlePolicyWait(t *testing.T) {
+	policy := ThrottlePolicy{FreeAttempts: 5, MaxAttempts: 10, BaseDelay: time.Second, Lockout: 15 * time.Minute}
+
+	tests := []struct {
+		policy   ThrottlePolicy
+		failures int
+		want     time.Duration
+	}{
+		{policy, 0, 0},
+		{policy, 4, 0},
+		{policy, 5, time.Second},
+		{policy, 6, 2 * time.Second},
+		{policy, 9, 16 * time.Second},
+		{policy, 10, 15 * time.Minute},
+		{policy, 1000, 15 * time.Minute},
+		// the doubled delay is capped at the lockout
+		{ThrottlePolicy{FreeAttempts: 0, MaxAttempts: 100, BaseDelay: time.Minute, Lockout: 15 * time.Minute}, 4, 15 * time.Minute},
+		// and so is a delay that overflows
+		{ThrottlePolicy{FreeAttempts: 0, MaxAttempts: 100, BaseDelay: time.Second, Lockout: 15 * time.Minute}, 70, 15 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		if got := tt.policy.wait(tt.failures); got != tt.want {
+			t.Errorf("%+v wait(%d) = %v, want %v", tt.policy, tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestLoginThrottleAttempt(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		// attempts are made from distinct emails when spread is set, so
+		// that only the client's address adds up
+		spread bool
+		// want is the wait of each attempt in turn. The wait of an attempt
+		// that is turned away passes before the next one.
+		want []time.Duration
+	}{
+		{
+			name: "one account",
+			want: []time.Duration{0, 0, 0, 0, 0, time.Second, 0, 2 * time.Second, 0, 4 * time.Second, 0, 8 * time.Second, 0, 16 * time.Second, 0, 15 * time.Minute, 0, 15 * time.Minute},
+		},
+		{
+			name:   "one client",
+			spread: true,
+			want:   append(make([]time.Duration, 20), time.Second, 0, 2*time.Second),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newMemoryAttempts()
+			throttle := NewLoginThrottle(store)
+
+			for i, want := range tt.want {
+				email := "alice@example.com"
+				if tt.spread {
+					email = string(rune('a'+i%26)) + string(rune('a'+i/26)) + "@example.com"
+				}
+
+				got, err := throttle.Attempt(ctx, email, "192.0.2.1")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !about(got, want) {
+					t.Errorf("attempt %d: wait %v, want %v", i+1, got, want)
+				}
+				store.elapse(want)
+			}
+		})
+	}
+}
+
+func TestLoginThrottleTurnedAway(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryAttempts()
+	throttle := NewLoginThrottle(store)
+	const email = "alice@example.com"
+
+	// lock the account out, letting each delay pass
+	for i := 0; i < throttle.Account.MaxAttempts; i++ {
+		store.elapse(throttle.Account.Lockout)
+		if wait, err := throttle.Attempt(ctx, email, "192.0.2.1"); err != nil || wait != 0 {
+			t.Fatalf("attempt %d: wait %v, %v, want none", i+1, wait, err)
+		}
+	}
+
+	// attempts during the lockout do not push its end further out
+	store.elapse(10 * time.Minute)
+	for i := 0; i < 5; i++ {
+		if wait, err := throttle.Attempt(ctx, email, "198.51.100.1"); err != nil || !about(wait, 5*time.Minute) {
+			t.Fatalf("attempt during the lockout: wait %v, %v, want %v", wait, err, 5*time.Minute)
+		}
+	}
+	if got := store.count(accountKey(email)); got != throttle.Account.MaxAttempts {
+		t.Errorf("account failures = %d, want %d", got, throttle.Account.MaxAttempts)
+	}
+
+	store.elapse(5 * time.Minute)
+	if wait, err := throttle.Attempt(ctx, email, "198.51.100.1"); err != nil || wait != 0 {
+		t.Errorf("attempt after the lockout: wait %v, %v, want none", wait, err)
+	}
+}
+
+func TestLoginThrottleClientFirst(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryAttempts()
+	throttle := NewLoginThrottle(store)
+	throttle.IP = ThrottlePolicy{FreeAttempts: 1, MaxAttempts: 1, BaseDelay: time.Second, Lockout: time.Minute, Window: time.Hour}
+
+	if _, err := throttle.Attempt(ctx, "alice@example.com", "192.0.2.1"); err != nil {
+		t.Fatal(err)
+	}
+	if wait, err := throttle.Attempt(ctx, "bob@example.com", "192.0.2.1"); err != nil || !about(wait, time.Minute) {
+		t.Fatalf("wait %v, %v, want %v", wait, err, time.Minute)
+	}
+
+	// a client that has to wait does not add to the failures of the
+	// accounts it tries
+	if got := store.count(accountKey("bob@example.com")); got != 0 {
+		t.Errorf("account failures = %d, want 0", got)
+	}
+}
+
+func TestLoginThrottleKeys(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryAttempts()
+	throttle := NewLoginThrottle(store)
+
+	for _, email := range []string{"alice@example.com", " Alice@Example.com", "ALICE@EXAMPLE.COM "} {
+		if _, err := throttle.Attempt(ctx, email, "192.0.2.1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := store.count(accountKey("alice@example.com")); got != 3 {
+		t.Errorf("account failures = %d, want 3 for one account however its email is written", got)
+	}
+}
+
+func TestLoginThrottleSecondFactor(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryAttempts()
+	throttle := NewLoginThrottle(store)
+	const email, ip, userId = "alice@example.com", "192.0.2.1", 7
+
+	// four wrong passwords, then the right one
+	for i := 0; i < 5; i++ {
+		if _, err := throttle.Attempt(ctx, email, ip); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the code has its own free attempts, however many passwords failed
+	for i := 0; i < throttle.MFA.FreeAttempts; i++ {
+		wait, err := throttle.AttemptSecondFactor(ctx, userId, ip)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if wait != 0 {
+			t.Fatalf("code attempt %d: wait %v, want none", i+1, wait)
+		}
+	}
+	if wait, err := throttle.AttemptSecondFactor(ctx, userId, ip); err != nil || !about(wait, time.Second) {
+		t.Fatalf("code attempt %d: wait %v, %v, want %v", throttle.MFA.FreeAttempts+1, wait, err, time.Second)
+	}
+
+	// the right password alone does not reset the account
+	if got := store.count(accountKey(email)); got != 5 {
+		t.Errorf("account failures before the second factor = %d, want 5", got)
+	}
+
+	if err := throttle.SecondFactorSucceeded(ctx, userId, ip); err != nil {
+		t.Fatal(err)
+	}
+	if err := throttle.Succeeded(ctx, email, ip); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := store.count(mfaKey(userId)); got != 0 {
+		t.Errorf("code failures after the login = %d, want 0", got)
+	}
+	if got := store.count(accountKey(email)); got != 0 {
+		t.Errorf("account failures after the login = %d, want 0", got)
+	}
+	// the client keeps its failures but not the two successful attempts
+	if got, want := store.count(ipKey(ip)), 5+throttle.MFA.FreeAttempts+1-2; got != want {
+		t.Errorf("client failures after the login = %d, want %d", got, want)
+	}
+}
+
+func TestLoginThrottleUnlock(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryAttempts()
+	throttle := NewLoginThrottle(store)
+	const email, ip, userId = "alice@example.com", "192.0.2.1", 7
+
+	for i := 0; i < throttle.Account.MaxAttempts; i++ {
+		store.elapse(throttle.Account.Lockout)
+		throttle.Attempt(ctx, email, ip)
+		throttle.AttemptSecondFactor(ctx, userId, ip)
+	}
+	// from another client, since this one has used up its free attempts
+	if wait, _ := throttle.Attempt(ctx, email, "198.51.100.1"); !about(wait, throttle.Account.Lockout) {
+		t.Fatalf("wait %v, want a lockout", wait)
+	}
+
+	if err := throttle.Unlock(ctx, userId, email); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := store.count(accountKey(email)) + store.count(mfaKey(userId)); got != 0 {
+		t.Errorf("failures after unlocking = %d, want 0", got)
+	}
+	if got := store.count(ipKey(ip)); got == 0 {
+		t.Errorf("unlocking the account cleared the client's failures")
+	}
+}
+
+func TestLoginThrottleStoreError(t *testing.T) {
+	store := newMemoryAttempts()
+	store.err = errors.New("store is down")
+	throttle := NewLoginThrottle(store)
+
+	if _, err := throttle.Attempt(context.Background(), "alice@example.com", "192.0.2.1"); !errors.Is(err, store.err) {
+		t.Errorf("Attempt() error = %v, want %v", err, store.err)
+	}
+	if _, err := throttle.AttemptSecondFactor(context.Background(), 7, "192.0.2.1"); !errors.Is(err, store.err) {
+		t.Errorf("AttemptSecondFactor() error = %v, want %v", err, store.err)
+	}
+}
+
+// about reports whether the wait got is want, give or take the time the test
+// took to get there.
+func about(got, want time.Duration) bool {
+	return got <= want && got > want-time.Second
+}
@@ -0,0 +1,158 @@
+// Package ical renders events as iCalendar (RFC 5545) documents.
+package ical
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	dateFormat      = "20060102"
+	dateTimeFormat  = "20060102T150405Z"
+	localTimeFormat = "20060102T150405"
+
+	// maxLineOctets is the longest a content line may be before it has to be
+	// folded, excluding the CRLF.
+	maxLineOctets = 75
+)
+
+type Calendar struct {
+	ProdID string
+	Name   string
+	Events []Event
+}
+
+// Event is a single VEVENT. When AllDay is set only the dates of Start and End
+// are used and End is exclusive, as RFC 5545 requires for DATE values.
+//
+// Times are written in UTC unless TZID names an IANA zone, in which case they
+// are written as local times in that zone. Recurring events need a TZID so
+// that clients keep occurrences at the same local time across DST changes.
+// RecurrenceID marks the event as a changed occurrence of the recurring event
+// sharing its UID.
+type Event struct {
+	UID          string
+	Stamp        time.Time
+	Start        time.Time
+	End          time.Time
+	AllDay       bool
+	TZID         string
+	RRule        string
+	ExDates      []time.Time
+	RecurrenceID *time.Time
+	Summary      string
+	Description  string
+	Location     string
+	URL          string
+	Status       string
+}
+
+const (
+	StatusConfirmed = "CONFIRMED"
+	StatusTentative = "TENTATIVE"
+	StatusCancelled = "CANCELLED"
+)
+
+// Encode writes the calendar to w with CRLF line endings and long lines
+// folded.
+func (c *Calendar) Encode(w io.Writer) error {
+	var b bytes.Buffer
+
+	writeLine(&b, "BEGIN:VCALENDAR")
+	writeLine(&b, "VERSION:2.0")
+	writeLine(&b, "PRODID:"+c.ProdID)
+	writeLine(&b, "CALSCALE:GREGORIAN")
+	writeLine(&b, "METHOD:PUBLISH")
+	if c.Name != "" {
+		writeLine(&b, "X-WR-CALNAME:"+escapeText(c.Name))
+	}
+
+	for _, e := range c.Events {
+		e.encode(&b)
+	}
+
+	writeLine(&b, "END:VCALENDAR")
+
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+func (e *Event) encode(b *bytes.Buffer) {
+	writeLine(b, "BEGIN:VEVENT")
+	writeLine(b, "UID:"+e.UID)
+	writeLine(b, "DTSTAMP:"+e.Stamp.UTC().Format(dateTimeFormat))
+
+	if e.AllDay {
+		writeLine(b, "DTSTART;VALUE=DATE:"+e.Start.Format(dateFormat))
+		writeLine(b, "DTEND;VALUE=DATE:"+e.End.Format(dateFormat))
+	} else {
+		writeLine(b, "DTSTART"+e.formatTime(e.Start))
+		writeLine(b, "DTEND"+e.formatTime(e.End))
+	}
+
+	if e.RecurrenceID != nil {
+		writeLine(b, "RECURRENCE-ID"+e.formatTime(*e.RecurrenceID))
+	}
+	if e.RRule != "" {
+		writeLine(b, "RRULE:"+e.RRule)
+	}
+	for _, t := range e.ExDates {
+		writeLine(b, "EXDATE"+e.formatTime(t))
+	}
+
+	writeLine(b, "SUMMARY:"+escapeText(e.Summary))
+	if e.Description != "" {
+		writeLine(b, "DESCRIPTION:"+escapeText(e.Description))
+	}
+	if e.Location != "" {
+		writeLine(b, "LOCATION:"+escapeText(e.Location))
+	}
+	if e.URL != "" {
+		writeLine(b, "URL:"+e.URL)
+	}
+	if e.Status != "" {
+		writeLine(b, "STATUS:"+e.Status)
+	}
+
+	writeLine(b, "END:VEVENT")
+}
+
+// formatTime renders a DATE-TIME value along with its TZID parameter, starting
+// at the separator that follows the property name.
+func (e *Event) formatTime(t time.Time) string {
+	if e.TZID != "" {
+		if loc, err := time.LoadLocation(e.TZID); err == nil {
+			return ";TZID=" + e.TZID + ":" + t.In(loc).Format(localTimeFormat)
+		}
+	}
+	return ":" + t.UTC().Format(dateTimeFormat)
+}
+
+// escapeText escapes a TEXT property value (RFC 5545 section 3.3.11).
+func escapeText(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`, "\r", `\n`).Replace(s)
+}
+
+// writeLine writes a content line, folding it onto continuation lines that
+// start with a single space whenever it exceeds 75 octets. Folds never split a
+// multi-byte UTF-8 sequence.
+func writeLine(b *bytes.Buffer, line string) {
+	limit := maxLineOctets
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		b.WriteString(line[:cut])
+		b.WriteString("\r\n ")
+		line = line[cut:]
+		// continuation lines lose one octet to the leading space
+		limit = maxLineOctets - 1
+	}
+	b.WriteString(line)
+	b.WriteString("\r\n")
+}
@@ -0,0 +1,191 @@
+package ical
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+func TestEncode(t *testing.T) {
+	stamp := time.Date(2025, 3, 1, 9, 30, 0, 0, time.UTC)
+	start := time.Date(2025, 3, 10, 18, 0, 0, 0, time.UTC)
+	end := start.Add(2 * time.Hour)
+
+	tests := []struct {
+		name string
+		cal  Calendar
+	}{
+		{
+			name: "utc",
+			cal: Calendar{
+				ProdID: "-//test//EN",
+				Name:   "Meetups",
+				Events: []Event{{
+					UID:     "event-1@example.com",
+					Stamp:   stamp.In(time.FixedZone("", 2*60*60)),
+					Start:   start,
+					End:     end,
+					Summary: "Go meetup",
+					URL:     "https://example.com/events/1",
+					Status:  StatusConfirmed,
+				}},
+			},
+		},
+		{
+			name: "tzid",
+			cal: Calendar{
+				ProdID: "-//test//EN",
+				Events: []Event{
+					{
+						UID:     "event-2@example.com",
+						Stamp:   stamp,
+						Start:   start,
+						End:     end,
+						TZID:    "America/New_York",
+						RRule:   "FREQ=WEEKLY;COUNT=4",
+						ExDates: []time.Time{start.AddDate(0, 0, 7)},
+						Summary: "Weekly sync",
+					},
+					{
+						UID:          "event-2@example.com",
+						Stamp:        stamp,
+						Start:        start.AddDate(0, 0, 14).Add(time.Hour),
+						End:          end.AddDate(0, 0, 14).Add(time.Hour),
+						TZID:         "America/New_York",
+						RecurrenceID: ptr(start.AddDate(0, 0, 14)),
+						Summary:      "Weekly sync (moved)",
+						Status:       StatusTentative,
+					},
+				},
+			},
+		},
+		{
+			name: "all_day",
+			cal: Calendar{
+				ProdID: "-//test//EN",
+				Events: []Event{{
+					UID:     "event-3@example.com",
+					Stamp:   stamp,
+					Start:   time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC),
+					End:     time.Date(2025, 4, 3, 0, 0, 0, 0, time.UTC),
+					AllDay:  true,
+					Summary: "Conference",
+				}},
+			},
+		},
+		{
+			name: "escaping",
+			cal: Calendar{
+				ProdID: "-//test//EN",
+				Name:   "Talks, workshops; more",
+				Events: []Event{{
+					UID:         "event-4@example.com",
+					Stamp:       stamp,
+					Start:       start,
+					End:         end,
+					Summary:     `Paths: C:\Go; D:\Go, and more`,
+					Description: "First line\r\nSecond line\nThird, last line",
+					Location:    "Room 1; Building A, Campus",
+					Status:      StatusCancelled,
+				}},
+			},
+		},
+		{
+			name: "folding",
+			cal: Calendar{
+				ProdID: "-//test//EN",
+				Events: []Event{{
+					UID:         "event-5@example.com",
+					Stamp:       stamp,
+					Start:       start,
+					End:         end,
+					Summary:     strings.Repeat("Rendez-vous à la café ", 5),
+					Description: strings.Repeat("日本語のイベント説明", 12),
+					Location:    "x" + strings.Repeat("😀", 40),
+				}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b bytes.Buffer
+			if err := tt.cal.Encode(&b); err != nil {
+				t.Fatal(err)
+			}
+			checkLines(t, b.Bytes())
+
+			golden := filepath.Join("testdata", tt.name+".ics")
+			if *update {
+				if err := os.WriteFile(golden, b.Bytes(), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(b.Bytes(), want) {
+				t.Errorf("Encode() =\n%s\nwant\n%s", b.Bytes(), want)
+			}
+		})
+	}
+}
+
+func TestWriteLine(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want string
+	}{
+		{"short", "SUMMARY:hi", "SUMMARY:hi\r\n"},
+		{"exactly 75", strings.Repeat("a", 75), strings.Repeat("a", 75) + "\r\n"},
+		{"76", strings.Repeat("a", 76), strings.Repeat("a", 75) + "\r\n a\r\n"},
+		{"continuations hold 74", strings.Repeat("a", 75+74+1), strings.Repeat("a", 75) + "\r\n " + strings.Repeat("a", 74) + "\r\n a\r\n"},
+		// the three octets of 語 would straddle octet 75, so it moves to the
+		// next line whole
+		{"multi-byte at the fold", strings.Repeat("a", 73) + "語", strings.Repeat("a", 73) + "\r\n 語\r\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b bytes.Buffer
+			writeLine(&b, tt.line)
+			if got := b.String(); got != tt.want {
+				t.Errorf("writeLine(%q) = %q, want %q", tt.line, got, tt.want)
+			}
+		})
+	}
+}
+
+// checkLines checks that every line of an encoded calendar ends in CRLF, is
+// at most 75 octets and is valid UTF-8 on its own.
+func checkLines(t *testing.T, data []byte) {
+	t.Helper()
+
+	if !bytes.HasSuffix(data, []byte("\r\n")) {
+		t.Fatalf("calendar does not end in CRLF")
+	}
+	for i, line := range strings.Split(strings.TrimSuffix(string(data), "\r\n"), "\r\n") {
+		if strings.ContainsAny(line, "\r\n") {
+			t.Errorf("line %d has a bare CR or LF: %q", i+1, line)
+		}
+		if len(line) > maxLineOctets {
+			t.Errorf("line %d is %d octets long: %q", i+1, len(line), line)
+		}
+		if !utf8.ValidString(line) {
+			t.Errorf("line %d splits a multi-byte character: %q", i+1, line)
+		}
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,467 @@
+// Package rrule parses and expands the subset of RFC 5545 recurrence rules
+// used for recurring events: FREQ, INTERVAL, COUNT, UNTIL, BYDAY, BYMONTHDAY
+// and BYMONTH.
+package rrule
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Frequency string
+
+const (
+	Daily   Frequency = "DAILY"
+	Weekly  Frequency = "WEEKLY"
+	Monthly Frequency = "MONTHLY"
+	Yearly  Frequency = "YEARLY"
+)
+
+// maxPeriods bounds how many periods are walked while expanding, so that
+// rules which can never match (e.g. BYMONTHDAY=30;BYMONTH=2) terminate.
+const maxPeriods = 100000
+
+const untilFormat = "20060102T150405Z"
+
+var ErrInvalidRule = errors.New("invalid recurrence rule")
+
+// WeekdayNum is a BYDAY entry. N selects the nth occurrence of the weekday
+// within the month or year, counting from the end when negative; zero means
+// every occurrence.
+type WeekdayNum struct {
+	Day time.Weekday
+	N   int
+}
+
+type Rule struct {
+	Freq       Frequency
+	Interval   int
+	Count      int
+	Until      time.Time
+	ByDay      []WeekdayNum
+	ByMonthDay []int
+	ByMonth    []time.Month
+}
+
+var weekdays = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+// Parse parses an RRULE value such as "FREQ=WEEKLY;BYDAY=MO,WE;COUNT=10". A
+// leading "RRULE:" is accepted.
+func Parse(s string) (*Rule, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "RRULE:")
+	if s == "" {
+		return nil, ErrInvalidRule
+	}
+
+	r := &Rule{Interval: 1}
+
+	for _, part := range strings.Split(s, ";") {
+		key, value, ok := strings.Cut(part, "=")
+		if !ok || value == "" {
+			return nil, fmt.Errorf("%w: malformed part %q", ErrInvalidRule, part)
+		}
+
+		switch strings.ToUpper(key) {
+		case "FREQ":
+			r.Freq = Frequency(strings.ToUpper(value))
+			switch r.Freq {
+			case Daily, Weekly, Monthly, Yearly:
+			default:
+				return nil, fmt.Errorf("%w: unsupported FREQ %q", ErrInvalidRule, value)
+			}
+		case "INTERVAL":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("%w: INTERVAL must be a positive integer", ErrInvalidRule)
+			}
+			r.Interval = n
+		case "COUNT":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("%w: COUNT must be a positive integer", ErrInvalidRule)
+			}
+			r.Count = n
+		case "UNTIL":
+			t, err := parseUntil(value)
+			if err != nil {
+				return nil, fmt.Errorf("%w: UNTIL must be a UTC date-time like 20250131T000000Z", ErrInvalidRule)
+			}
+			r.Until = t
+		case "BYDAY":
+			for _, v := range strings.Split(value, ",") {
+				wd, err := parseWeekdayNum(v)
+				if err != nil {
+					return nil, err
+				}
+				r.ByDay = append(r.ByDay, wd)
+			}
+		case "BYMONTHDAY":
+			for _, v := range strings.Split(value, ",") {
+				n, err := strconv.Atoi(v)
+				if err != nil || n == 0 || n < -31 || n > 31 {
+					return nil, fmt.Errorf("%w: invalid BYMONTHDAY %q", ErrInvalidRule, v)
+				}
+				r.ByMonthDay = append(r.ByMonthDay, n)
+			}
+		case "BYMONTH":
+			for _, v := range strings.Split(value, ",") {
+				n, err := strconv.Atoi(v)
+				if err != nil || n < 1 || n > 12 {
+					return nil, fmt.Errorf("%w: invalid BYMONTH %q", ErrInvalidRule, v)
+				}
+				r.ByMonth = append(r.ByMonth, time.Month(n))
+			}
+		case "WKST":
+			// weeks always start on Monday, which is the RFC 5545 default
+		default:
+			return nil, fmt.Errorf("%w: unsupported part %q", ErrInvalidRule, key)
+		}
+	}
+
+	if r.Freq == "" {
+		return nil, fmt.Errorf("%w: FREQ is required", ErrInvalidRule)
+	}
+	if r.Count > 0 && !r.Until.IsZero() {
+		return nil, fmt.Errorf("%w: COUNT and UNTIL are mutually exclusive", ErrInvalidRule)
+	}
+
+	return r, nil
+}
+
+func parseUntil(value string) (time.Time, error) {
+	if t, err := time.Parse(untilFormat, value); err == nil {
+		return t, nil
+	}
+	// a date-only UNTIL includes the whole day
+	t, err := time.Parse("20060102", value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return t.Add(24*time.Hour - time.Second), nil
+}
+
+func parseWeekdayNum(v string) (WeekdayNum, error) {
+	v = strings.ToUpper(strings.TrimSpace(v))
+	if len(v) < 2 {
+		return WeekdayNum{}, fmt.Errorf("%w: invalid BYDAY %q", ErrInvalidRule, v)
+	}
+
+	day, ok := weekdays[v[len(v)-2:]]
+	if !ok {
+		return WeekdayNum{}, fmt.Errorf("%w: invalid BYDAY %q", ErrInvalidRule, v)
+	}
+
+	wd := WeekdayNum{Day: day}
+	if prefix := v[:len(v)-2]; prefix != "" {
+		n, err := strconv.Atoi(prefix)
+		if err != nil || n == 0 || n < -53 || n > 53 {
+			return WeekdayNum{}, fmt.Errorf("%w: invalid BYDAY %q", ErrInvalidRule, v)
+		}
+		wd.N = n
+	}
+
+	return wd, nil
+}
+
+// String renders the rule in RRULE value syntax.
+func (r *Rule) String() string {
+	parts := []string{"FREQ=" + string(r.Freq)}
+
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	if !r.Until.IsZero() {
+		parts = append(parts, "UNTIL="+r.Until.UTC().Format(untilFormat))
+	}
+	if len(r.ByDay) > 0 {
+		days := make([]string, len(r.ByDay))
+		for i, wd := range r.ByDay {
+			days[i] = strings.ToUpper(wd.Day.String()[:2])
+			if wd.N != 0 {
+				days[i] = strconv.Itoa(wd.N) + days[i]
+			}
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if len(r.ByMonthDay) > 0 {
+		days := make([]string, len(r.ByMonthDay))
+		for i, d := range r.ByMonthDay {
+			days[i] = strconv.Itoa(d)
+		}
+		parts = append(parts, "BYMONTHDAY="+strings.Join(days, ","))
+	}
+	if len(r.ByMonth) > 0 {
+		months := make([]string, len(r.ByMonth))
+		for i, m := range r.ByMonth {
+			months[i] = strconv.Itoa(int(m))
+		}
+		parts = append(parts, "BYMONTH="+strings.Join(months, ","))
+	}
+
+	return strings.Join(parts, ";")
+}
+
+// Between returns the start times of the occurrences that begin within
+// [from, to], in order. dtstart is the start of the first occurrence and its
+// location is used for the expansion, so a 09:00 meeting stays at 09:00 local
+// time across DST changes. Occurrences listed in exdates are skipped but still
+// count towards COUNT, as RFC 5545 specifies.
+func (r *Rule) Between(dtstart, from, to time.Time, exdates []time.Time) []time.Time {
+	var out []time.Time
+
+	r.each(dtstart, func(t time.Time) bool {
+		if t.After(to) {
+			return false
+		}
+		if !t.Before(from) && !excluded(t, exdates) {
+			out = append(out, t)
+		}
+		return true
+	})
+
+	return out
+}
+
+// Last returns the start of the final occurrence, or false when the rule
+// repeats forever.
+func (r *Rule) Last(dtstart time.Time) (time.Time, bool) {
+	if r.Count == 0 && r.Until.IsZero() {
+		return time.Time{}, false
+	}
+
+	last := dtstart
+	r.each(dtstart, func(t time.Time) bool {
+		last = t
+		return true
+	})
+
+	return last, true
+}
+
+// Split divides the series at the occurrence starting at "at". The returned
+// head covers the occurrences before it and tail the ones from it onwards,
+// with COUNT distributed between the two.
+func (r *Rule) Split(dtstart, at time.Time) (head, tail *Rule) {
+	h, t := *r, *r
+
+	if r.Count > 0 {
+		before := 0
+		r.each(dtstart, func(o time.Time) bool {
+			if !o.Before(at) {
+				return false
+			}
+			before++
+			return true
+		})
+		h.Count = before
+		t.Count = r.Count - before
+	} else {
+		h.Until = at.Add(-time.Second).UTC()
+	}
+
+	return &h, &t
+}
+
+// each calls fn with every occurrence in order until fn returns false or the
+// rule is exhausted.
+func (r *Rule) each(dtstart time.Time, fn func(time.Time) bool) {
+	emitted := 0
+	interval := r.Interval
+	if interval < 1 {
+		interval = 1
+	}
+
+	for period := 0; period < maxPeriods; period++ {
+		for _, t := range r.candidates(dtstart, period*interval) {
+			if t.Before(dtstart) {
+				continue
+			}
+			if !r.Until.IsZero() && t.After(r.Until) {
+				return
+			}
+			if r.Count > 0 && emitted >= r.Count {
+				return
+			}
+			emitted++
+			if !fn(t) {
+				return
+			}
+		}
+	}
+}
+
+// candidates returns the sorted occurrences inside the nth period after the
+// one containing dtstart.
+func (r *Rule) candidates(dtstart time.Time, n int) []time.Time {
+	loc := dtstart.Location()
+	h, m, s := dtstart.Clock()
+	at := func(y int, mo time.Month, d int) time.Time {
+		return time.Date(y, mo, d, h, m, s, dtstart.Nanosecond(), loc)
+	}
+
+	var days []time.Time
+
+	switch r.Freq {
+	case Daily:
+		d := at(dtstart.Year(), dtstart.Month(), dtstart.Day()+n)
+		if r.matchesDay(d) {
+			days = append(days, d)
+		}
+
+	case Weekly:
+		// weeks start on Monday
+		offset := (int(dtstart.Weekday()) + 6) % 7
+		monday := at(dtstart.Year(), dtstart.Month(), dtstart.Day()-offset+7*n)
+		for i := 0; i < 7; i++ {
+			d := at(monday.Year(), monday.Month(), monday.Day()+i)
+			if len(r.ByDay) == 0 && d.Weekday() != dtstart.Weekday() {
+				continue
+			}
+			if r.monthAllowed(d.Month()) && r.weekdayListed(d.Weekday()) {
+				days = append(days, d)
+			}
+		}
+
+	case Monthly:
+		first := at(dtstart.Year(), dtstart.Month()+time.Month(n), 1)
+		if r.monthAllowed(first.Month()) {
+			days = r.expandMonth(first, dtstart.Day(), at)
+		}
+
+	case Yearly:
+		year := dtstart.Year() + n
+		if len(r.ByDay) > 0 && len(r.ByMonth) == 0 && len(r.ByMonthDay) == 0 {
+			days = expandByDay(at(year, time.January, 1), at(year+1, time.January, 1), r.ByDay, at)
+			break
+		}
+		months := r.ByMonth
+		if len(months) == 0 {
+			months = []time.Month{dtstart.Month()}
+		}
+		for _, mo := range months {
+			days = append(days, r.expandMonth(at(year, mo, 1), dtstart.Day(), at)...)
+		}
+	}
+
+	sort.Slice(days, func(i, j int) bool { return days[i].Before(days[j]) })
+	return days
+}
+
+// expandMonth returns the matching days of the month starting at first.
+// Without BYMONTHDAY or BYDAY the day of month of dtstart is used, and months
+// that are too short for it are skipped.
+func (r *Rule) expandMonth(first time.Time, defaultDay int, at func(int, time.Month, int) time.Time) []time.Time {
+	next := at(first.Year(), first.Month()+1, 1)
+	length := next.AddDate(0, 0, -1).Day()
+
+	var days []time.Time
+
+	switch {
+	case len(r.ByMonthDay) > 0:
+		for _, md := range r.ByMonthDay {
+			day := md
+			if md < 0 {
+				day = length + md + 1
+			}
+			if day < 1 || day > length {
+				continue
+			}
+			d := at(first.Year(), first.Month(), day)
+			if r.weekdayListed(d.Weekday()) {
+				days = append(days, d)
+			}
+		}
+	case len(r.ByDay) > 0:
+		days = expandByDay(first, next, r.ByDay, at)
+	default:
+		if defaultDay <= length {
+			days = append(days, at(first.Year(), first.Month(), defaultDay))
+		}
+	}
+
+	return days
+}
+
+// expandByDay returns the days in [start, end) matching the BYDAY entries,
+// honouring ordinals relative to that span.
+func expandByDay(start, end time.Time, byDay []WeekdayNum, at func(int, time.Month, int) time.Time) []time.Time {
+	matches := map[time.Weekday][]time.Time{}
+	for d := start; d.Before(end); d = at(d.Year(), d.Month(), d.Day()+1) {
+		matches[d.Weekday()] = append(matches[d.Weekday()], d)
+	}
+
+	var days []time.Time
+	for _, wd := range byDay {
+		list := matches[wd.Day]
+		switch {
+		case wd.N == 0:
+			days = append(days, list...)
+		case wd.N > 0 && wd.N <= len(list):
+			days = append(days, list[wd.N-1])
+		case wd.N < 0 && -wd.N <= len(list):
+			days = append(days, list[len(list)+wd.N])
+		}
+	}
+
+	return days
+}
+
+func (r *Rule) matchesDay(d time.Time) bool {
+	if !r.monthAllowed(d.Month()) || !r.weekdayListed(d.Weekday()) {
+		return false
+	}
+	if len(r.ByMonthDay) == 0 {
+		return true
+	}
+
+	length := time.Date(d.Year(), d.Month()+1, 0, 0, 0, 0, 0, d.Location()).Day()
+	for _, md := range r.ByMonthDay {
+		if md == d.Day() || (md < 0 && length+md+1 == d.Day()) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Rule) monthAllowed(m time.Month) bool {
+	if len(r.ByMonth) == 0 {
+		return true
+	}
+	for _, bm := range r.ByMonth {
+		if bm == m {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Rule) weekdayListed(wd time.Weekday) bool {
+	if len(r.ByDay) == 0 {
+		return true
+	}
+	for _, bd := range r.ByDay {
+		if bd.Day == wd {
+			return true
+		}
+	}
+	return false
+}
+
+func excluded(t time.Time, exdates []time.Time) bool {
+	for _, ex := range exdates {
+		if ex.Equal(t) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,308 @@
+package rrule
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const layout = "2006-01-02 15:04 -0700"
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Rule
+		// str is what String renders, when it differs from in
+		str string
+	}{
+		{in: "FREQ=DAILY", want: Rule{Freq: Daily, Interval: 1}},
+		{in: "RRULE:FREQ=WEEKLY;BYDAY=MO,WE;COUNT=10", want: Rule{Freq: Weekly, Interval: 1, Count: 10, ByDay: []WeekdayNum{{Day: time.Monday}, {Day: time.Wednesday}}}, str: "FREQ=WEEKLY;COUNT=10;BYDAY=MO,WE"},
+		{in: "FREQ=MONTHLY;INTERVAL=2;BYDAY=-1FR", want: Rule{Freq: Monthly, Interval: 2, ByDay: []WeekdayNum{{Day: time.Friday, N: -1}}}},
+		{in: "FREQ=MONTHLY;BYMONTHDAY=1,-1", want: Rule{Freq: Monthly, Interval: 1, ByMonthDay: []int{1, -1}}},
+		{in: "FREQ=YEARLY;UNTIL=20301231T235959Z;BYMONTH=2,8", want: Rule{Freq: Yearly, Interval: 1, Until: time.Date(2030, 12, 31, 23, 59, 59, 0, time.UTC), ByMonth: []time.Month{time.February, time.August}}},
+		// a date-only UNTIL includes the whole day
+		{in: "FREQ=DAILY;UNTIL=20300101", want: Rule{Freq: Daily, Interval: 1, Until: time.Date(2030, 1, 1, 23, 59, 59, 0, time.UTC)}, str: "FREQ=DAILY;UNTIL=20300101T235959Z"},
+		{in: "freq=weekly;byday=2tu", want: Rule{Freq: Weekly, Interval: 1, ByDay: []WeekdayNum{{Day: time.Tuesday, N: 2}}}, str: "FREQ=WEEKLY;BYDAY=2TU"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := Parse(tt.in)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if !reflect.DeepEqual(*got, tt.want) {
+				t.Errorf("Parse() = %+v, want %+v", *got, tt.want)
+			}
+
+			str := tt.str
+			if str == "" {
+				str = tt.in
+			}
+			if got.String() != str {
+				t.Errorf("String() = %q, want %q", got.String(), str)
+			}
+		})
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := []string{
+		"",
+		"RRULE:",
+		"INTERVAL=2",
+		"FREQ=HOURLY",
+		"FREQ=DAILY;INTERVAL=0",
+		"FREQ=DAILY;COUNT=-1",
+		"FREQ=DAILY;COUNT=2;UNTIL=20300101T000000Z",
+		"FREQ=DAILY;UNTIL=2030-01-01",
+		"FREQ=WEEKLY;BYDAY=XX",
+		"FREQ=MONTHLY;BYMONTHDAY=32",
+		"FREQ=YEARLY;BYMONTH=13",
+		"FREQ=DAILY;BYSETPOS=1",
+		"FREQ=DAILY;COUNT",
+	}
+
+	for _, in := range tests {
+		t.Run(in, func(t *testing.T) {
+			if rule, err := Parse(in); !errors.Is(err, ErrInvalidRule) {
+				t.Errorf("Parse() = %+v, %v, want ErrInvalidRule", rule, err)
+			}
+		})
+	}
+}
+
+func TestBetween(t *testing.T) {
+	berlin := mustLoad(t, "Europe/Berlin")
+	newYork := mustLoad(t, "America/New_York")
+
+	tests := []struct {
+		name     string
+		rule     string
+		dtstart  time.Time
+		from, to time.Time
+		exdates  []time.Time
+		want     []string
+	}{
+		{
+			name:    "daily count",
+			rule:    "FREQ=DAILY;COUNT=3",
+			dtstart: time.Date(2025, 1, 30, 18, 0, 0, 0, time.UTC),
+			from:    time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+			to:      time.Date(2025, 12, 31, 0, 0, 0, 0, time.UTC),
+			want:    []string{"2025-01-30 18:00 +0000", "2025-01-31 18:00 +0000", "2025-02-01 18:00 +0000"},
+		},
+		{
+			name:    "weekly keeps local time when DST ends",
+			rule:    "FREQ=WEEKLY;BYDAY=MO;COUNT=3",
+			dtstart: time.Date(2025, 10, 20, 9, 0, 0, 0, berlin),
+			from:    time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC),
+			to:      time.Date(2025, 12, 1, 0, 0, 0, 0, time.UTC),
+			want:    []string{"2025-10-20 09:00 +0200", "2025-10-27 09:00 +0100", "2025-11-03 09:00 +0100"},
+		},
+		{
+			name:    "daily keeps local time when DST starts",
+			rule:    "FREQ=DAILY;COUNT=3",
+			dtstart: time.Date(2025, 3, 8, 9, 0, 0, 0, newYork),
+			from:    time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC),
+			to:      time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC),
+			want:    []string{"2025-03-08 09:00 -0500", "2025-03-09 09:00 -0400", "2025-03-10 09:00 -0400"},
+		},
+		{
+			name:    "until is inclusive",
+			rule:    "FREQ=DAILY;UNTIL=20250103T180000Z",
+			dtstart: time.Date(2025, 1, 1, 18, 0, 0, 0, time.UTC),
+			from:    time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+			to:      time.Date(2025, 12, 31, 0, 0, 0, 0, time.UTC),
+			want:    []string{"2025-01-01 18:00 +0000", "2025-01-02 18:00 +0000", "2025-01-03 18:00 +0000"},
+		},
+		{
+			// UNTIL is in UTC, and the 09:00 occurrence of 30 October is
+			// 08:00 UTC once DST has ended
+			name:    "until across DST",
+			rule:    "FREQ=DAILY;UNTIL=20251030T073000Z",
+			dtstart: time.Date(2025, 10, 25, 9, 0, 0, 0, berlin),
+			from:    time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC),
+			to:      time.Date(2025, 12, 1, 0, 0, 0, 0, time.UTC),
+			want:    []string{"2025-10-25 09:00 +0200", "2025-10-26 09:00 +0100", "2025-10-27 09:00 +0100", "2025-10-28 09:00 +0100", "2025-10-29 09:00 +0100"},
+		},
+		{
+			name:    "exdates count towards count",
+			rule:    "FREQ=DAILY;COUNT=3",
+			dtstart: time.Date(2025, 1, 1, 18, 0, 0, 0, time.UTC),
+			from:    time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+			to:      time.Date(2025, 12, 31, 0, 0, 0, 0, time.UTC),
+			exdates: []time.Time{time.Date(2025, 1, 2, 18, 0, 0, 0, time.UTC)},
+			want:    []string{"2025-01-01 18:00 +0000", "2025-01-03 18:00 +0000"},
+		},
+		{
+			// exdates name an instant, whatever zone they are given in
+			name:    "exdate in another zone",
+			rule:    "FREQ=WEEKLY;COUNT=3",
+			dtstart: time.Date(2025, 10, 20, 9, 0, 0, 0, berlin),
+			from:    time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC),
+			to:      time.Date(2025, 12, 1, 0, 0, 0, 0, time.UTC),
+			exdates: []time.Time{time.Date(2025, 10, 27, 8, 0, 0, 0, time.UTC)},
+			want:    []string{"2025-10-20 09:00 +0200", "2025-11-03 09:00 +0100"},
+		},
+		{
+			name:    "window",
+			rule:    "FREQ=WEEKLY;INTERVAL=2;BYDAY=TU,TH",
+			dtstart: time.Date(2025, 1, 7, 12, 0, 0, 0, time.UTC),
+			from:    time.Date(2025, 1, 15, 0, 0, 0, 0, time.UTC),
+			to:      time.Date(2025, 2, 4, 12, 0, 0, 0, time.UTC),
+			want:    []string{"2025-01-21 12:00 +0000", "2025-01-23 12:00 +0000", "2025-02-04 12:00 +0000"},
+		},
+		{
+			name:    "monthly skips months without the day",
+			rule:    "FREQ=MONTHLY;COUNT=3",
+			dtstart: time.Date(2025, 1, 31, 10, 0, 0, 0, time.UTC),
+			from:    time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+			to:      time.Date(2025, 12, 31, 0, 0, 0, 0, time.UTC),
+			want:    []string{"2025-01-31 10:00 +0000", "2025-03-31 10:00 +0000", "2025-05-31 10:00 +0000"},
+		},
+		{
+			name:    "last friday of the month",
+			rule:    "FREQ=MONTHLY;BYDAY=-1FR;COUNT=3",
+			dtstart: time.Date(2025, 1, 31, 17, 0, 0, 0, berlin),
+			from:    time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+			to:      time.Date(2025, 12, 31, 0, 0, 0, 0, time.UTC),
+			want:    []string{"2025-01-31 17:00 +0100", "2025-02-28 17:00 +0100", "2025-03-28 17:00 +0100"},
+		},
+		{
+			name:    "last day of the month",
+			rule:    "FREQ=MONTHLY;BYMONTHDAY=-1;COUNT=3",
+			dtstart: time.Date(2024, 1, 31, 10, 0, 0, 0, time.UTC),
+			from:    time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			to:      time.Date(2024, 12, 31, 0, 0, 0, 0, time.UTC),
+			want:    []string{"2024-01-31 10:00 +0000", "2024-02-29 10:00 +0000", "2024-03-31 10:00 +0000"},
+		},
+		{
+			name:    "yearly on leap days",
+			rule:    "FREQ=YEARLY;COUNT=2",
+			dtstart: time.Date(2024, 2, 29, 10, 0, 0, 0, time.UTC),
+			from:    time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			to:      time.Date(2040, 1, 1, 0, 0, 0, 0, time.UTC),
+			want:    []string{"2024-02-29 10:00 +0000", "2028-02-29 10:00 +0000"},
+		},
+		{
+			name:    "rule that never matches",
+			rule:    "FREQ=YEARLY;BYMONTH=2;BYMONTHDAY=30",
+			dtstart: time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC),
+			from:    time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+			to:      time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := Parse(tt.rule)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := format(rule.Between(tt.dtstart, tt.from, tt.to, tt.exdates)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Between() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLast(t *testing.T) {
+	berlin := mustLoad(t, "Europe/Berlin")
+
+	tests := []struct {
+		name    string
+		rule    string
+		dtstart time.Time
+		want    string
+		wantOK  bool
+	}{
+		{
+			name:    "count",
+			rule:    "FREQ=WEEKLY;BYDAY=MO;COUNT=3",
+			dtstart: time.Date(2025, 10, 20, 9, 0, 0, 0, berlin),
+			want:    "2025-11-03 09:00 +0100",
+			wantOK:  true,
+		},
+		{
+			name:    "until",
+			rule:    "FREQ=DAILY;UNTIL=20251030T073000Z",
+			dtstart: time.Date(2025, 10, 25, 9, 0, 0, 0, berlin),
+			want:    "2025-10-29 09:00 +0100",
+			wantOK:  true,
+		},
+		{
+			name:    "until before the first occurrence",
+			rule:    "FREQ=DAILY;UNTIL=20250101T000000Z",
+			dtstart: time.Date(2025, 10, 25, 9, 0, 0, 0, berlin),
+			want:    "2025-10-25 09:00 +0200",
+			wantOK:  true,
+		},
+		{
+			name:    "forever",
+			rule:    "FREQ=DAILY",
+			dtstart: time.Date(2025, 10, 25, 9, 0, 0, 0, berlin),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := Parse(tt.rule)
+			if err != nil {
+				t.Fatal(err)
+			}
+			last, ok := rule.Last(tt.dtstart)
+			if ok != tt.wantOK {
+				t.Fatalf("Last() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if ok && last.Format(layout) != tt.want {
+				t.Errorf("Last() = %s, want %s", last.Format(layout), tt.want)
+			}
+		})
+	}
+}
+
+func TestSplit(t *testing.T) {
+	dtstart := time.Date(2025, 1, 1, 18, 0, 0, 0, time.UTC)
+	at := time.Date(2025, 1, 4, 18, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		rule, head, tail string
+	}{
+		{rule: "FREQ=DAILY;COUNT=10", head: "FREQ=DAILY;COUNT=3", tail: "FREQ=DAILY;COUNT=7"},
+		{rule: "FREQ=DAILY", head: "FREQ=DAILY;UNTIL=20250104T175959Z", tail: "FREQ=DAILY"},
+		{rule: "FREQ=DAILY;UNTIL=20250110T180000Z", head: "FREQ=DAILY;UNTIL=20250104T175959Z", tail: "FREQ=DAILY;UNTIL=20250110T180000Z"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.rule, func(t *testing.T) {
+			rule, err := Parse(tt.rule)
+			if err != nil {
+				t.Fatal(err)
+			}
+			head, tail := rule.Split(dtstart, at)
+			if head.String() != tt.head || tail.String() != tt.tail {
+				t.Errorf("Split() = %q, %q, want %q, %q", head, tail, tt.head, tt.tail)
+			}
+		})
+	}
+}
+
+func mustLoad(t *testing.T, name string) *time.Location {
+	t.Helper()
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loc
+}
+
+func format(times []time.Time) []string {
+	var out []string
+	for _, t := range times {
+		out = append(out, t.Format(layout))
+	}
+	return out
+}
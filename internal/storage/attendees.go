@@ -2,6 +2,9 @@ package storage
 
 import (
 	"database/sql"
+	"errors"
+	"fmt"
+	"time"
 
 	"golang.org/x/net/context"
 )
@@ -10,42 +13,172 @@ type AttendeeStore struct {
 	db *sql.DB
 }
 
+// Attendee is a user's RSVP for an event. For recurring events attendance is
+// tracked per occurrence, identified by the occurrence's original start time.
 type Attendee struct {
-	ID      int `json:"id"`
-	UserID  int `json:"user_id"`
-	EventID int `json:"event_id"`
+	ID              int        `json:"id"`
+	UserID          int        `json:"user_id"`
+	EventID         int        `json:"event_id"`
+	OccurrenceStart *time.Time `json:"occurrence_start,omitempty"`
+	Status          string     `json:"status"`
 }
 
-func (a *AttendeeStore) CreateAttendee(ctx context.Context, attendee *Attendee) error {
+// EventAttendee is a user attending an event along with their RSVP status.
+type EventAttendee struct {
+	ID              int        `json:"id"`
+	Name            string     `json:"name"`
+	Email           string     `json:"email"`
+	OccurrenceStart *time.Time `json:"occurrence_start,omitempty"`
+	Status          string     `json:"status"`
+
+	attendanceID int
+}
+
+// AttendingEvent is an event a user is attending along with their RSVP status.
+// For an occurrence of a recurring event the times and details are those of
+// the occurrence.
+type AttendingEvent struct {
+	Event
+	OccurrenceStart *time.Time `json:"occurrence_start,omitempty"`
+	Status          string     `json:"status"`
+
+	attendanceID int
+}
+
+const (
+	RSVPGoing    = "going"
+	RSVPMaybe    = "maybe"
+	RSVPDeclined = "declined"
+)
+
+// CreateAttendee adds the user to the event. If the attendee is going and the
+// event is already at capacity the user is put on the waitlist instead and the
+// resulting entry is returned; a nil entry means the attendee was created.
+func (a *AttendeeStore) CreateAttendee(ctx context.Context, attendee *Attendee) (*WaitlistEntry, error) {
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
 	defer cancel()
 
-	query := `INSERT INTO attendees (user_id, event_id) VALUES ($1, $2) RETURNING id, user_id, event_id`
+	query := `INSERT INTO attendees (user_id, event_id, occurrence_start, status) VALUES ($1, $2, $3, $4) RETURNING id, user_id, event_id, occurrence_start, status`
+
+	if attendee.Status == "" {
+		attendee.Status = RSVPGoing
+	}
 
 	tx, err := a.db.BeginTx(ctx, nil)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	if err = tx.QueryRowContext(ctx, query, attendee.UserID, attendee.EventID).Scan(&attendee.ID, &attendee.UserID, &attendee.EventID); err != nil {
+	full, err := lockEventForAttendance(ctx, tx, attendee.EventID, attendee.OccurrenceStart)
+	if err != nil {
 		tx.Rollback()
-		return err
+		return nil, err
+	}
+
+	if full && attendee.Status == RSVPGoing {
+		entry, err := addToWaitlist(ctx, tx, attendee.EventID, attendee.UserID, attendee.OccurrenceStart)
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		if err = tx.Commit(); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		return entry, nil
+	}
+
+	if err = tx.QueryRowContext(ctx, query, attendee.UserID, attendee.EventID, attendee.OccurrenceStart, attendee.Status).Scan(attendee.fields()...); err != nil {
+		tx.Rollback()
+		return nil, err
 	}
 	if err = tx.Commit(); err != nil {
 		tx.Rollback()
-		return err
+		return nil, err
 	}
-	return nil
+	return nil, nil
 }
 
-func (a *AttendeeStore) GetByEventAndAttendee(ctx context.Context, eventId, userId int) (*Attendee, error) {
+// SetRSVP creates or updates the user's RSVP for the event. Switching to going
+// while the event is full keeps any previous RSVP and places the user on the
+// waitlist, whose entry is returned. Switching away from going releases the
+// seat to the waitlist.
+func (a *AttendeeStore) SetRSVP(ctx context.Context, attendee *Attendee) (*WaitlistEntry, error) {
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
 	defer cancel()
 
-	query := `SELECT id, user_id, event_id FROM attendees WHERE event_id = $1 AND user_id = $2`
+	tx, err := a.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	full, err := lockEventForAttendance(ctx, tx, attendee.EventID, attendee.OccurrenceStart)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	var current string
+	query := `SELECT status FROM attendees WHERE event_id = $1 AND user_id = $2 AND occurrence_start IS NOT DISTINCT FROM $3`
+	err = tx.QueryRowContext(ctx, query, attendee.EventID, attendee.UserID, attendee.OccurrenceStart).Scan(&current)
+	if err != nil && err != sql.ErrNoRows {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if attendee.Status == RSVPGoing && current != RSVPGoing && full {
+		entry, err := getWaitlistEntry(ctx, tx, attendee.EventID, attendee.UserID, attendee.OccurrenceStart)
+		if errors.Is(err, ErrWaitlistEntryNotFound) {
+			entry, err = addToWaitlist(ctx, tx, attendee.EventID, attendee.UserID, attendee.OccurrenceStart)
+		}
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		if err = tx.Commit(); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		return entry, nil
+	}
+
+	query = `INSERT INTO attendees (user_id, event_id, occurrence_start, status) VALUES ($1, $2, $3, $4)
+				ON CONFLICT ` + occurrenceConflictTarget + ` DO UPDATE SET status = EXCLUDED.status
+				RETURNING id, user_id, event_id, occurrence_start, status`
+
+	if err = tx.QueryRowContext(ctx, query, attendee.UserID, attendee.EventID, attendee.OccurrenceStart, attendee.Status).Scan(attendee.fields()...); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	query = `DELETE FROM waitlist WHERE event_id = $1 AND user_id = $2 AND occurrence_start IS NOT DISTINCT FROM $3`
+	if _, err = tx.ExecContext(ctx, query, attendee.EventID, attendee.UserID, attendee.OccurrenceStart); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if current == RSVPGoing && attendee.Status != RSVPGoing {
+		if err = promoteFromWaitlist(ctx, tx, attendee.EventID, attendee.OccurrenceStart); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return nil, nil
+}
+
+func (a *AttendeeStore) GetByEventAndAttendee(ctx context.Context, eventId, userId int, occurrence *time.Time) (*Attendee, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	query := `SELECT id, user_id, event_id, occurrence_start, status FROM attendees WHERE event_id = $1 AND user_id = $2 AND occurrence_start IS NOT DISTINCT FROM $3`
 
 	attendee := &Attendee{}
-	err := a.db.QueryRowContext(ctx, query, eventId, userId).Scan(&attendee.ID, &attendee.UserID, &attendee.EventID)
+	err := a.db.QueryRowContext(ctx, query, eventId, userId, occurrence).Scan(attendee.fields()...)
 	if err != nil {
 		if err == sql.ErrNoRows {
 
@@ -57,24 +190,78 @@ func (a *AttendeeStore) GetByEventAndAttendee(ctx context.Context, eventId, user
 	return attendee, nil
 }
 
-func (a *AttendeeStore) GetAttendeesByEvent(ctx context.Context, eventId int) (*[]User, error) {
+func (a *Attendee) fields() []any {
+	return []any{&a.ID, &a.UserID, &a.EventID, &a.OccurrenceStart, &a.Status}
+}
+
+// attendeeSortColumns sorts attendee lists. "id" is the order in which people
+// signed up; the attendees row id also breaks ties, since the same user may
+// attend several occurrences of a recurring event.
+var attendeeSortColumns = map[string]sortColumn{
+	"name": {expr: "u.name"},
+	"id":   {expr: "a.id"},
+}
+
+// AttendeeViewer is the user listing an event's attendees, 0 when anonymous.
+// Organizers are the event's owner and co-organizers, who see every attendee
+// regardless of their privacy settings.
+type AttendeeViewer struct {
+	UserID    int
+	Organizer bool
+}
+
+// attendeeUsers selects users as the viewer may see them on attendee lists,
+// with the names of those who do not show them blanked. Hiding names here
+// keeps them out of sorting and cursors too.
+func attendeeUsers(viewer AttendeeViewer, args *[]any) string {
+	if viewer.Organizer {
+		return `users`
+	}
+	*args = append(*args, viewer.UserID)
+	return fmt.Sprintf(`(SELECT id, CASE WHEN show_name_on_attendee_lists OR id = $%[1]d THEN name ELSE '' END AS name, email
+		FROM users WHERE NOT hide_attendance OR id = $%[1]d)`, len(*args))
+}
+
+// GetAttendeesByEvent lists the event's attendees as the viewer may see them.
+// A nil occurrence lists the attendees of every occurrence.
+func (a *AttendeeStore) GetAttendeesByEvent(ctx context.Context, eventId int, occurrence *time.Time, page PageParams, viewer AttendeeViewer) (*Page[EventAttendee], error) {
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
 	defer cancel()
 
-	query := `SELECT u.id, u.name, u.email FROM users u
-				JOIN attendees a ON u.id = a.user_id
-				WHERE a.event_id = $1`
+	k, err := newKeyset(page, attendeeSortColumns, "name", "a.id")
+	if err != nil {
+		return nil, err
+	}
 
-	var users []User
+	args := []any{eventId}
+	conditions := []string{"a.event_id = $1"}
+	if occurrence != nil {
+		args = append(args, *occurrence)
+		conditions = append(conditions, "a.occurrence_start = $2")
+	}
+	from := attendeeUsers(viewer, &args) + ` u JOIN attendees a ON u.id = a.user_id`
 
-	rows, err := a.db.QueryContext(ctx, query, eventId)
+	total, err := countRows(ctx, a.db, `SELECT COUNT(*) FROM `+from+whereClause(conditions), args)
+	if err != nil {
+		return nil, err
+	}
+
+	if cond := k.condition(&args); cond != "" {
+		conditions = append(conditions, cond)
+	}
+
+	query := `SELECT u.id, u.name, u.email, a.occurrence_start, a.status, a.id FROM ` + from + whereClause(conditions) + k.orderAndLimit()
+
+	users := []EventAttendee{}
+
+	rows, err := a.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 	for rows.Next() {
-		var u User
-		if err = rows.Scan(&u.ID, &u.Name, &u.Email); err != nil {
+		var u EventAttendee
+		if err = rows.Scan(&u.ID, &u.Name, &u.Email, &u.OccurrenceStart, &u.Status, &u.attendanceID); err != nil {
 			return nil, err
 		}
 
@@ -85,21 +272,36 @@ func (a *AttendeeStore) GetAttendeesByEvent(ctx context.Context, eventId int) (*
 		return nil, err
 	}
 
-	return &users, nil
+	users, next := nextCursor(k, users, func(u EventAttendee) (string, int) {
+		if k.params.Sort == "name" {
+			return u.Name, u.attendanceID
+		}
+		return "", u.attendanceID
+	})
+
+	return &Page[EventAttendee]{Data: users, NextCursor: next, Total: total}, nil
 }
 
-func (a *AttendeeStore) DeleteAttendee(ctx context.Context, eventId, userId int) error {
+// DeleteAttendee removes the user from the event, or from one occurrence of a
+// recurring event, and promotes the first person on the waitlist into the
+// freed seat.
+func (a *AttendeeStore) DeleteAttendee(ctx context.Context, eventId, userId int, occurrence *time.Time) error {
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
 	defer cancel()
 
-	query := `DELETE FROM attendees WHERE event_id = $1 AND user_id = $2`
+	query := `DELETE FROM attendees WHERE event_id = $1 AND user_id = $2 AND occurrence_start IS NOT DISTINCT FROM $3`
 	tx, err := a.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
 
-	results, err := tx.ExecContext(ctx, query, eventId, userId)
+	if _, err = lockEventForAttendance(ctx, tx, eventId, occurrence); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	results, err := tx.ExecContext(ctx, query, eventId, userId, occurrence)
 	if err != nil {
 		tx.Rollback()
 		return err
@@ -116,6 +318,11 @@ func (a *AttendeeStore) DeleteAttendee(ctx context.Context, eventId, userId int)
 		return ErrAttendeeNotFound
 	}
 
+	if err = promoteFromWaitlist(ctx, tx, eventId, occurrence); err != nil {
+		tx.Rollback()
+		return err
+	}
+
 	if err = tx.Commit(); err != nil {
 		tx.Rollback()
 		return err
@@ -125,26 +332,66 @@ func (a *AttendeeStore) DeleteAttendee(ctx context.Context, eventId, userId int)
 
 }
 
-func (a *AttendeeStore) GetEventsOfAttendee(ctx context.Context, userId int) (*[]Event, error) {
+// attendedEvents is a per-attendance view of events, aliased as e so that
+// eventColumns and EventFilter apply to it. Occurrences of recurring events
+// carry their own times, with any single-occurrence override applied, and no
+// RRULE of their own.
+const attendedEvents = `(
+	SELECT ev.id, ev.owner_id,
+		COALESCE(o.name, ev.name) AS name,
+		COALESCE(o.description, ev.description) AS description,
+		COALESCE(o.starts_at, a.occurrence_start, ev.starts_at) AS starts_at,
+		COALESCE(o.ends_at, a.occurrence_start + (ev.ends_at - ev.starts_at), ev.ends_at) AS ends_at,
+		ev.timezone,
+		COALESCE(o.location, ev.location) AS location,
+		ev.capacity, ev.visibility,
+		CASE WHEN a.occurrence_start IS NULL THEN ev.rrule END AS rrule,
+		CASE WHEN a.occurrence_start IS NULL THEN ev.exdates ELSE '{}' END AS exdates,
+		CASE WHEN a.occurrence_start IS NULL THEN ev.series_ends_at END AS series_ends_at,
+		a.user_id, a.occurrence_start, a.status, a.id AS attendance_id
+	FROM events ev
+	JOIN attendees a ON ev.id = a.event_id
+	LEFT JOIN event_occurrence_overrides o ON o.event_id = a.event_id AND o.occurrence_start = a.occurrence_start
+) e`
+
+func (a *AttendeeStore) GetEventsOfAttendee(ctx context.Context, userId int, filter EventFilter, page PageParams) (*Page[AttendingEvent], error) {
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
 	defer cancel()
 
-	query := `SELECT e.id, e.owner_id, e.name, e.description, e.date, e.location FROM events e
-	JOIN attendees a ON e.id = a.event_id
-	WHERE a.user_id = $1`
+	// the same event shows up once per attended occurrence, so ties are
+	// broken on the attendance rather than the event
+	k, err := newKeyset(page, eventSortColumns, "date", "e.attendance_id")
+	if err != nil {
+		return nil, err
+	}
 
-	var events []Event
+	args := []any{userId}
+	conditions := append([]string{"e.user_id = $1"}, filter.conditions(&args)...)
 
-	rows, err := a.db.QueryContext(ctx, query, userId)
+	total, err := countRows(ctx, a.db, `SELECT COUNT(*) FROM `+attendedEvents+whereClause(conditions), args)
+	if err != nil {
+		return nil, err
+	}
+
+	if cond := k.condition(&args); cond != "" {
+		conditions = append(conditions, cond)
+	}
+
+	query := `SELECT ` + eventColumns + `, e.occurrence_start, e.status, e.attendance_id FROM ` + attendedEvents + whereClause(conditions) + k.orderAndLimit()
+
+	events := []AttendingEvent{}
+
+	rows, err := a.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 	for rows.Next() {
-		var e Event
-		if err = rows.Scan(&e.ID, &e.OwnerID, &e.Name, &e.Description, &e.Date, &e.Location); err != nil {
+		var e AttendingEvent
+		if err = rows.Scan(append(e.fields(), &e.OccurrenceStart, &e.Status, &e.attendanceID)...); err != nil {
 			return nil, err
 		}
+		e.localize()
 
 		events = append(events, e)
 	}
@@ -153,5 +400,39 @@ func (a *AttendeeStore) GetEventsOfAttendee(ctx context.Context, userId int) (*[
 		return nil, err
 	}
 
-	return &events, nil
+	key := eventCursorKey(k.params.Sort)
+	events, next := nextCursor(k, events, func(e AttendingEvent) (string, int) {
+		value, _ := key(e.Event)
+		return value, e.attendanceID
+	})
+
+	return &Page[AttendingEvent]{Data: events, NextCursor: next, Total: total}, nil
+}
+
+// GetEventIDsOfAttendee lists the IDs of the events the user attends or is
+// waitlisted for.
+func (a *AttendeeStore) GetEventIDsOfAttendee(ctx context.Context, userId int) ([]int, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	ids := []int{}
+
+	rows, err := a.db.QueryContext(ctx, `SELECT event_id FROM attendees WHERE user_id = $1 UNION SELECT event_id FROM waitlist WHERE user_id = $1`, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		if err = rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ids, nil
 }
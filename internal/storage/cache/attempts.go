@@ -0,0 +1,88 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/puremike/event-mgt-api/internal/storage"
+)
+
+// LoginAttempts is the Redis backed store of failed login attempts. Keys
+// expire a window after their last failure. While Redis is unavailable
+// attempts are counted in Postgres instead.
+type LoginAttempts struct {
+	rdb      *redis.Client
+	breaker  *breaker
+	fallback *storage.LoginAttemptStore
+}
+
+// attempt records a failure unless the key still has to wait the delay of
+// its failures, returning when the wait ends if it does. ARGV holds the time
+// and the window followed by the delays, all in milliseconds.
+var attempt = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local values = redis.call('HMGET', KEYS[1], 'failures', 'last')
+local failures = tonumber(values[1]) or 0
+local last = tonumber(values[2]) or 0
+local ends = last + tonumber(ARGV[3 + math.min(failures, #ARGV - 3)])
+if ends > now then
+	return ends
+end
+redis.call('HSET', KEYS[1], 'failures', failures + 1, 'last', now)
+redis.call('PEXPIRE', KEYS[1], ARGV[2])
+return 0`)
+
+func (a *LoginAttempts) Attempt(ctx context.Context, key string, window time.Duration, delays []time.Duration) (time.Time, error) {
+	if !a.breaker.allow() {
+		return a.fallback.Attempt(ctx, key, window, delays)
+	}
+
+	args := make([]any, 0, len(delays)+2)
+	args = append(args, time.Now().UnixMilli(), window.Milliseconds())
+	for _, d := range delays {
+		args = append(args, d.Milliseconds())
+	}
+
+	until, err := attempt.Run(ctx, a.rdb, []string{"login_attempts:" + key}, args...).Int64()
+	if err != nil {
+		a.breaker.failed(ctx, err)
+		return a.fallback.Attempt(ctx, key, window, delays)
+	}
+
+	if until == 0 {
+		return time.Time{}, nil
+	}
+	return time.UnixMilli(until), nil
+}
+
+// forgive decrements the failures, dropping the key once none are left.
+var forgive = redis.NewScript(`
+if redis.call('HINCRBY', KEYS[1], 'failures', -1) <= 0 then
+	redis.call('DEL', KEYS[1])
+end
+return 0`)
+
+func (a *LoginAttempts) Forgive(ctx context.Context, key string) error {
+	if !a.breaker.allow() {
+		return a.fallback.Forgive(ctx, key)
+	}
+
+	if err := forgive.Run(ctx, a.rdb, []string{"login_attempts:" + key}).Err(); err != nil && err != redis.Nil {
+		a.breaker.failed(ctx, err)
+		return a.fallback.Forgive(ctx, key)
+	}
+	return nil
+}
+
+func (a *LoginAttempts) Reset(ctx context.Context, key string) error {
+	if !a.breaker.allow() {
+		return a.fallback.Reset(ctx, key)
+	}
+
+	if err := a.rdb.Del(ctx, "login_attempts:"+key).Err(); err != nil {
+		a.breaker.failed(ctx, err)
+		return a.fallback.Reset(ctx, key)
+	}
+	return nil
+}
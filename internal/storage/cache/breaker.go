@@ -0,0 +1,192 @@
+package cache
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// retryInterval is how often Redis is pinged while the breaker is open
+	retryInterval = 2 * time.Second
+
+	// maxPendingInvalidations bounds the keys remembered while Redis is down.
+	// Keys beyond it are left to expire.
+	maxPendingInvalidations = 10000
+)
+
+// breaker keeps requests away from Redis while it is unavailable. A failed
+// command opens it, after which reads fall back to the in-process tier and
+// Postgres. The invalidations that could not reach Redis are remembered and
+// replayed before Monitor closes it again.
+type breaker struct {
+	mu      sync.Mutex
+	open    bool
+	since   time.Time
+	lastErr error
+	trips   int64
+	pending map[string]struct{}
+	// opened wakes Monitor up
+	opened chan struct{}
+}
+
+// CacheHealth describes the Redis tier. Redis is "disabled" when it is not
+// configured, "up" or "down"; Since is when it went down.
+type CacheHealth struct {
+	Redis string     `json:"redis"`
+	Since *time.Time `json:"since,omitempty"`
+	Error string     `json:"error,omitempty"`
+	// Trips counts how often Redis went down since startup
+	Trips                int64      `json:"trips"`
+	PendingInvalidations int        `json:"pending_invalidations"`
+	Local                LocalStats `json:"local"`
+}
+
+func newBreaker() *breaker {
+	return &breaker{pending: make(map[string]struct{}), opened: make(chan struct{}, 1)}
+}
+
+func (b *breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return !b.open
+}
+
+// failed opens the breaker when err means Redis is unavailable. Misses and
+// requests that were cancelled by their client do not count.
+func (b *breaker) failed(ctx context.Context, err error) {
+	if err == nil || err == redis.Nil || ctx.Err() != nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lastErr = err
+	if b.open {
+		return
+	}
+	b.open, b.since = true, time.Now()
+	b.trips++
+
+	select {
+	case b.opened <- struct{}{}:
+	default:
+	}
+}
+
+// postpone remembers key to be invalidated once Redis is back.
+func (b *breaker) postpone(key string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.pending) < maxPendingInvalidations {
+		b.pending[key] = struct{}{}
+	}
+}
+
+func (b *breaker) err() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.lastErr
+}
+
+func (b *breaker) health() CacheHealth {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	h := CacheHealth{Redis: "up", Trips: b.trips, PendingInvalidations: len(b.pending)}
+	if b.open {
+		since := b.since
+		h.Redis, h.Since = "down", &since
+		if b.lastErr != nil {
+			h.Error = b.lastErr.Error()
+		}
+	}
+	return h
+}
+
+// Monitor pings Redis while the breaker is open until it answers, refills
+// the denylist, replays the invalidations it missed and closes the breaker,
+// until ctx is done. It calls onDown when Redis goes down and onUp when it is
+// back. Without Redis it returns immediately.
+func (s *CacheStorage) Monitor(ctx context.Context, onDown func(error), onUp func()) {
+	if s.rdb == nil {
+		return
+	}
+
+	// Redis may already be down at startup
+	s.breaker.failed(ctx, s.rdb.Ping(ctx).Err())
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.breaker.opened:
+		}
+
+		onDown(s.breaker.err())
+
+		for !s.reconnect(ctx) {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(retryInterval):
+			}
+		}
+
+		onUp()
+	}
+}
+
+// reconnect reports whether Redis is back, closing the breaker once it has
+// caught up on what it missed.
+func (s *CacheStorage) reconnect(ctx context.Context) bool {
+	b := s.breaker
+
+	err := s.rdb.Ping(ctx).Err()
+	if err == nil {
+		err = s.Denylist.refill(ctx)
+	}
+	if err != nil {
+		b.mu.Lock()
+		b.lastErr = err
+		b.mu.Unlock()
+		return false
+	}
+
+	for {
+		b.mu.Lock()
+		keys := make([]string, 0, len(b.pending))
+		for key := range b.pending {
+			keys = append(keys, key)
+		}
+		if len(keys) == 0 {
+			b.open = false
+			b.mu.Unlock()
+			return true
+		}
+		b.mu.Unlock()
+
+		for _, key := range keys {
+			var err error
+			if tag, ok := strings.CutPrefix(key, "tag:"); ok {
+				err = s.Lists.invalidateTag(ctx, tag)
+			} else if err = s.rdb.Del(ctx, key).Err(); err == nil {
+				err = s.Users.publish(ctx, key)
+			}
+			if err != nil {
+				return false
+			}
+		}
+
+		b.mu.Lock()
+		for _, key := range keys {
+			delete(b.pending, key)
+		}
+		b.mu.Unlock()
+	}
+}
@@ -0,0 +1,202 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/puremike/event-mgt-api/internal/storage"
+)
+
+func TestBreakerFailed(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	down := errors.New("connection refused")
+
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		err      error
+		wantOpen bool
+	}{
+		{name: "success", ctx: context.Background(), err: nil},
+		{name: "miss", ctx: context.Background(), err: redis.Nil},
+		{name: "cancelled request", ctx: cancelled, err: down},
+		{name: "failure", ctx: context.Background(), err: down, wantOpen: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newBreaker()
+			b.failed(tt.ctx, tt.err)
+
+			if open := !b.allow(); open != tt.wantOpen {
+				t.Errorf("open = %v, want %v", open, tt.wantOpen)
+			}
+			select {
+			case <-b.opened:
+				if !tt.wantOpen {
+					t.Error("Monitor was woken up")
+				}
+			default:
+				if tt.wantOpen {
+					t.Error("Monitor was not woken up")
+				}
+			}
+		})
+	}
+}
+
+func TestBreakerTrips(t *testing.T) {
+	b := newBreaker()
+	b.failed(context.Background(), errors.New("first"))
+	b.failed(context.Background(), errors.New("second"))
+
+	h := b.health()
+	if h.Redis != "down" || h.Since == nil || h.Trips != 1 || h.Error != "second" {
+		t.Errorf("health = %+v, want down once with the last error", h)
+	}
+}
+
+func TestBreakerPostponeIsBounded(t *testing.T) {
+	b := newBreaker()
+	for i := 0; i < maxPendingInvalidations+10; i++ {
+		b.postpone("user:" + strconv.Itoa(i))
+	}
+	b.postpone("user:0")
+
+	if got := b.health().PendingInvalidations; got != maxPendingInvalidations {
+		t.Errorf("pending invalidations = %d, want %d", got, maxPendingInvalidations)
+	}
+}
+
+func TestFallbackWhileRedisIsDown(t *testing.T) {
+	ctx := context.Background()
+	srv := newFakeRedis(t)
+	s := newTestStorage(t, srv, 0)
+
+	loads := 0
+	load := func(ctx context.Context, id int) (*storage.User, error) {
+		loads++
+		return &storage.User{ID: id, Name: "Alice"}, nil
+	}
+	fetch := func() {
+		t.Helper()
+		if user, err := s.Users.Fetch(ctx, 1, load); err != nil || user.Name != "Alice" {
+			t.Fatalf("Fetch() = %+v, %v, want Alice", user, err)
+		}
+	}
+	listKey := ListKey("events")
+	if _, err := FetchList(ctx, &s.Lists, listKey, func(ctx context.Context) (*[]int, []string, error) {
+		return &[]int{1}, []string{EventTag(1)}, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// cached in Redis
+	fetch()
+	fetch()
+	if loads != 1 {
+		t.Fatalf("loads = %d, want 1 with Redis up", loads)
+	}
+
+	srv.setDown(true)
+
+	// the failed read opens the breaker and falls back
+	fetch()
+	if h := s.Health(); h.Redis != "down" || h.Trips != 1 {
+		t.Fatalf("health = %+v, want Redis down", h)
+	}
+	fetch()
+	if loads != 3 {
+		t.Fatalf("loads = %d, want 3 with Redis down", loads)
+	}
+
+	// changes are remembered for later
+	if err := s.Users.Delete(ctx, 1); err != nil {
+		t.Errorf("Delete() error = %v, want none while Redis is down", err)
+	}
+	if err := s.Lists.Invalidate(ctx, EventTag(1)); err != nil {
+		t.Errorf("Invalidate() error = %v, want none while Redis is down", err)
+	}
+	if h := s.Health(); h.PendingInvalidations != 2 {
+		t.Errorf("pending invalidations = %d, want 2", h.PendingInvalidations)
+	}
+
+	if s.reconnect(ctx) {
+		t.Fatal("reconnected while Redis is down")
+	}
+
+	srv.setDown(false)
+
+	if !s.reconnect(ctx) {
+		t.Fatalf("did not reconnect once Redis is up: %v", s.breaker.err())
+	}
+	if h := s.Health(); h.Redis != "up" || h.PendingInvalidations != 0 {
+		t.Errorf("health = %+v, want Redis up with nothing pending", h)
+	}
+	// the copies that went stale while Redis was down are gone
+	for _, key := range []string{userKey(1), listKey, tagKey(EventTag(1))} {
+		if srv.has(key) {
+			t.Errorf("%s is still in Redis", key)
+		}
+	}
+}
+
+func TestMonitor(t *testing.T) {
+	srv := newFakeRedis(t)
+	s := newTestStorage(t, srv, 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	down, up := make(chan error, 1), make(chan struct{}, 1)
+	go s.Monitor(ctx, func(err error) { down <- err }, func() { up <- struct{}{} })
+
+	srv.setDown(true)
+	s.Users.Fetch(ctx, 1, func(ctx context.Context, id int) (*storage.User, error) {
+		return &storage.User{ID: id}, nil
+	})
+
+	select {
+	case err := <-down:
+		if err == nil {
+			t.Error("Monitor reported Redis down without an error")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Monitor did not notice Redis going down")
+	}
+
+	srv.setDown(false)
+
+	select {
+	case <-up:
+	case <-time.After(2*retryInterval + time.Second):
+		t.Fatal("Monitor did not notice Redis coming back")
+	}
+	if !s.breaker.allow() {
+		t.Error("breaker is still open")
+	}
+}
+
+func TestWithoutRedis(t *testing.T) {
+	s := newTestStorage(t, nil, 10)
+	if h := s.Health(); h.Redis != "disabled" {
+		t.Errorf("health = %+v, want Redis disabled", h)
+	}
+
+	// Monitor has nothing to watch
+	done := make(chan struct{})
+	go func() {
+		s.Monitor(context.Background(), func(error) {}, func() {})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Monitor did not return without Redis")
+	}
+}
@@ -0,0 +1,62 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/puremike/event-mgt-api/internal/storage"
+)
+
+// TokenDenylist is the Redis backed access token denylist. Entries expire
+// together with the tokens they deny. Denials are also kept in Postgres,
+// which answers while Redis is unavailable and refills it once it is back.
+type TokenDenylist struct {
+	rdb      *redis.Client
+	breaker  *breaker
+	fallback *storage.RevokedTokenStore
+}
+
+func (d *TokenDenylist) Deny(ctx context.Context, jti string, expiresAt time.Time) error {
+	if err := d.fallback.Deny(ctx, jti, expiresAt); err != nil {
+		return err
+	}
+
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 || !d.breaker.allow() {
+		return nil
+	}
+	d.breaker.failed(ctx, d.rdb.Set(ctx, "denylist:"+jti, 1, ttl).Err())
+	return nil
+}
+
+func (d *TokenDenylist) Denied(ctx context.Context, jti string) (bool, error) {
+	if !d.breaker.allow() {
+		return d.fallback.Denied(ctx, jti)
+	}
+
+	n, err := d.rdb.Exists(ctx, "denylist:"+jti).Result()
+	if err != nil {
+		d.breaker.failed(ctx, err)
+		return d.fallback.Denied(ctx, jti)
+	}
+	return n > 0, nil
+}
+
+// refill copies the denials made while Redis was unavailable into it.
+func (d *TokenDenylist) refill(ctx context.Context) error {
+	refs, err := d.fallback.GetRevokedTokens(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = d.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, ref := range refs {
+			if ttl := time.Until(ref.ExpiresAt); ttl > 0 {
+				pipe.Set(ctx, "denylist:"+ref.JTI, 1, ttl)
+			}
+		}
+		return nil
+	})
+	return err
+}
@@ -0,0 +1,185 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"golang.org/x/sync/singleflight"
+)
+
+// missing is cached in Redis in place of an entity that does not exist, so
+// that repeated lookups of unknown IDs do not reach the database.
+const missing = "null"
+
+// entries caches entities in the local tier and, when rdb is set, in Redis
+// behind it. Entities live for ttl and missing ones for negativeTTL. While
+// the breaker is open Redis is skipped.
+type entries struct {
+	rdb         *redis.Client
+	breaker     *breaker
+	local       *localCache
+	ttl         time.Duration
+	negativeTTL time.Duration
+	loads       *singleflight.Group
+	// instance tells this instance's invalidations apart from the others'
+	instance string
+}
+
+// redis reports whether Redis is configured and available.
+func (e entries) redis() bool {
+	return e.rdb != nil && e.breaker.allow()
+}
+
+// get decodes the entity cached in Redis at key into v. It reports whether
+// the key is cached at all, returning notFound when it is cached as missing.
+func (e entries) get(ctx context.Context, key string, v any, notFound error) (bool, error) {
+	data, err := e.rdb.Get(ctx, key).Result()
+	if err == redis.Nil {
+		return false, nil
+	} else if err != nil {
+		e.breaker.failed(ctx, err)
+		return false, err
+	}
+
+	if data == missing {
+		return true, notFound
+	}
+
+	return true, json.Unmarshal([]byte(data), v)
+}
+
+// tagged is implemented by cached values that carry tags.
+type tagged interface {
+	cacheTags() []string
+}
+
+func tagsOf(value any) []string {
+	if t, ok := value.(tagged); ok {
+		return t.cacheTags()
+	}
+	return nil
+}
+
+// set caches value, an entity rather than a pointer to one, in both tiers
+// and drops it from the local tier of the other instances. When Redis cannot
+// be updated the key is invalidated once it is back.
+func (e entries) set(ctx context.Context, key string, value any) error {
+	tags := tagsOf(value)
+	e.local.set(key, value, e.ttl, tags...)
+	if e.rdb == nil {
+		return nil
+	}
+	if !e.breaker.allow() {
+		e.breaker.postpone(key)
+		return nil
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	_, err = e.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, key, data, e.ttl)
+		for _, tag := range tags {
+			pipe.SAdd(ctx, tagKey(tag), key)
+			pipe.Expire(ctx, tagKey(tag), e.ttl)
+		}
+		return nil
+	})
+	if err == nil {
+		err = e.publish(ctx, key)
+	}
+	if err != nil {
+		e.breaker.failed(ctx, err)
+		e.breaker.postpone(key)
+	}
+	return err
+}
+
+func (e entries) setMissing(ctx context.Context, key string) {
+	e.local.set(key, missingEntry{}, e.negativeTTL)
+	if e.redis() {
+		e.breaker.failed(ctx, e.rdb.Set(ctx, key, missing, e.negativeTTL).Err())
+	}
+}
+
+// delete drops key from both tiers and from the local tier of the other
+// instances. When Redis cannot be updated the key is invalidated once it is
+// back.
+func (e entries) delete(ctx context.Context, key string) error {
+	e.local.delete(key)
+	if e.rdb == nil {
+		return nil
+	}
+	if !e.breaker.allow() {
+		e.breaker.postpone(key)
+		return nil
+	}
+
+	err := e.rdb.Del(ctx, key).Err()
+	if err == nil {
+		err = e.publish(ctx, key)
+	}
+	if err != nil {
+		e.breaker.failed(ctx, err)
+		e.breaker.postpone(key)
+	}
+	return err
+}
+
+// fetch returns the entity cached at key, loading and caching it on a miss.
+// Concurrent misses for the same key share a single load, and entities that
+// load returns notFound for are cached as missing; a nil notFound caches no
+// missing values.
+func fetch[T any](ctx context.Context, e entries, key string, notFound error, load func(context.Context) (*T, error)) (*T, error) {
+	if cached, ok := e.local.get(key); ok {
+		if _, ok := cached.(missingEntry); ok {
+			return nil, notFound
+		}
+		value := cached.(T)
+		return &value, nil
+	}
+
+	// Redis errors fall through to load
+	if e.redis() {
+		var cached T
+		found, err := e.get(ctx, key, &cached, notFound)
+		if notFound != nil && errors.Is(err, notFound) {
+			e.local.set(key, missingEntry{}, e.negativeTTL)
+			return nil, err
+		}
+		if err == nil && found {
+			e.local.set(key, cached, e.ttl, tagsOf(cached)...)
+			return &cached, nil
+		}
+	}
+
+	v, err, _ := e.loads.Do(key, func() (any, error) {
+		// the load is shared, so it must outlive the request that started it
+		ctx := context.WithoutCancel(ctx)
+
+		value, err := load(ctx)
+		if notFound != nil && errors.Is(err, notFound) {
+			e.setMissing(ctx, key)
+			return nil, err
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// failing to cache only costs another miss
+		e.set(ctx, key, *value)
+		return value, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// callers get their own copy of the shared result
+	value := *v.(*T)
+	return &value, nil
+}
@@ -2,50 +2,31 @@ package cache
 
 import (
 	"context"
-	"encoding/json"
 	"strconv"
 
-	"github.com/go-redis/redis/v8"
 	"github.com/puremike/event-mgt-api/internal/storage"
 )
 
 type EventCache struct {
-	rdb *redis.Client
+	entries
 }
 
-func (u *EventCache) Get(ctx context.Context, id int) (*storage.Event, error) {
-	cacheKey := "event:" + strconv.Itoa(id)
-
-	data, err := u.rdb.Get(ctx, cacheKey).Result()
-
-	if err == redis.Nil {
-		return nil, nil
-	} else if err != nil {
-		return nil, err
-	}
-
-	var event storage.Event
-
-	if data != "" {
-		if err := json.Unmarshal([]byte(data), &event); err != nil {
-			return nil, err
-		}
-	}
-
-	return &event, nil
+func eventKey(id int) string {
+	return "event:" + strconv.Itoa(id)
 }
 
-func (u *EventCache) Set(ctx context.Context, event *storage.Event) error {
-	CacheKey := "event:" + strconv.Itoa(event.ID)
-	data, err := json.Marshal(event)
-	if err != nil {
-		return err
-	}
+// Fetch returns the cached event, loading it with load on a miss. Unknown IDs
+// return storage.ErrEventNotFound.
+func (e *EventCache) Fetch(ctx context.Context, id int, load func(context.Context, int) (*storage.Event, error)) (*storage.Event, error) {
+	return fetch(ctx, e.entries, eventKey(id), storage.ErrEventNotFound, func(ctx context.Context) (*storage.Event, error) {
+		return load(ctx, id)
+	})
+}
 
-	return u.rdb.Set(ctx, CacheKey, data, timeExp).Err()
+func (e *EventCache) Set(ctx context.Context, event *storage.Event) error {
+	return e.set(ctx, eventKey(event.ID), *event)
 }
 
-func (u *EventCache) Delete(ctx context.Context, id int) {
-	cacheKey := "user:" + strconv.Itoa(id)
-	u.rdb.Del(ctx, cacheKey)
+func (e *EventCache) Delete(ctx context.Context, id int) error {
+	return e.delete(ctx, eventKey(id))
 }
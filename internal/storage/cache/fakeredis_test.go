@@ -0,0 +1,347 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/puremike/event-mgt-api/internal/storage"
+)
+
+// fakeRedis is a Redis server speaking just enough RESP for the cache:
+// strings, sets, MULTI/EXEC and pub/sub. Expiry is ignored. Taking it down
+// drops every connection and refuses new ones while keeping the data, like
+// a network partition would.
+type fakeRedis struct {
+	ln net.Listener
+
+	mu          sync.Mutex
+	down        bool
+	conns       map[*fakeRedisConn]struct{}
+	strings     map[string]string
+	sets        map[string]map[string]struct{}
+	subscribers map[string]map[*fakeRedisConn]struct{}
+}
+
+type fakeRedisConn struct {
+	net.Conn
+	// mu serializes writes, which PUBLISH makes from other connections
+	mu         sync.Mutex
+	w          *bufio.Writer
+	subscribed bool
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &fakeRedis{
+		ln:          ln,
+		conns:       map[*fakeRedisConn]struct{}{},
+		strings:     map[string]string{},
+		sets:        map[string]map[string]struct{}{},
+		subscribers: map[string]map[*fakeRedisConn]struct{}{},
+	}
+	go s.accept()
+	t.Cleanup(func() {
+		ln.Close()
+		s.setDown(true)
+	})
+
+	return s
+}
+
+// client returns a client of the server that does not retry failed
+// commands, so that the breaker sees failures right away.
+func (s *fakeRedis) client(t *testing.T) *redis.Client {
+	rdb := redis.NewClient(&redis.Options{Addr: s.ln.Addr().String(), MaxRetries: -1, DialTimeout: time.Second, ReadTimeout: time.Second})
+	t.Cleanup(func() { rdb.Close() })
+	return rdb
+}
+
+func (s *fakeRedis) setDown(down bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.down = down
+	if down {
+		for c := range s.conns {
+			c.Close()
+		}
+	}
+}
+
+func (s *fakeRedis) has(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, isString := s.strings[key]
+	_, isSet := s.sets[key]
+	return isString || isSet
+}
+
+func (s *fakeRedis) subscriberCount(channel string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.subscribers[channel])
+}
+
+func (s *fakeRedis) accept() {
+	for {
+		nc, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		if s.down {
+			s.mu.Unlock()
+			nc.Close()
+			continue
+		}
+		c := &fakeRedisConn{Conn: nc, w: bufio.NewWriter(nc)}
+		s.conns[c] = struct{}{}
+		s.mu.Unlock()
+
+		go s.serve(c)
+	}
+}
+
+func (s *fakeRedis) serve(c *fakeRedisConn) {
+	defer func() {
+		c.Close()
+		s.mu.Lock()
+		delete(s.conns, c)
+		for _, subs := range s.subscribers {
+			delete(subs, c)
+		}
+		s.mu.Unlock()
+	}()
+
+	r := bufio.NewReader(c)
+	var queued [][]string
+	inMulti := false
+
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		name := strings.ToUpper(args[0])
+
+		switch {
+		case name == "MULTI":
+			inMulti, queued = true, nil
+			c.reply("+OK")
+		case name == "EXEC":
+			replies := make([]string, 0, len(queued))
+			for _, cmd := range queued {
+				replies = append(replies, s.exec(c, cmd))
+			}
+			inMulti = false
+			c.reply(arrayReply(replies))
+		case inMulti:
+			queued = append(queued, args)
+			c.reply("+QUEUED")
+		default:
+			c.reply(s.exec(c, args))
+		}
+	}
+}
+
+// exec runs a command and returns its encoded reply.
+func (s *fakeRedis) exec(c *fakeRedisConn, args []string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch name := strings.ToUpper(args[0]); name {
+	case "PING":
+		if c.subscribed {
+			return arrayReply([]string{bulkReply("pong"), bulkReply("")})
+		}
+		return "+PONG"
+	case "GET":
+		v, ok := s.strings[args[1]]
+		if !ok {
+			return "$-1"
+		}
+		return bulkReply(v)
+	case "SET":
+		s.strings[args[1]] = args[2]
+		return "+OK"
+	case "DEL", "EXISTS":
+		n := 0
+		for _, key := range args[1:] {
+			_, isString := s.strings[key]
+			_, isSet := s.sets[key]
+			if isString || isSet {
+				n++
+			}
+			if name == "DEL" {
+				delete(s.strings, key)
+				delete(s.sets, key)
+			}
+		}
+		return ":" + strconv.Itoa(n)
+	case "EXPIRE":
+		return ":1"
+	case "SADD":
+		set := s.sets[args[1]]
+		if set == nil {
+			set = map[string]struct{}{}
+			s.sets[args[1]] = set
+		}
+		n := 0
+		for _, member := range args[2:] {
+			if _, ok := set[member]; !ok {
+				set[member] = struct{}{}
+				n++
+			}
+		}
+		return ":" + strconv.Itoa(n)
+	case "SMEMBERS":
+		members := []string{}
+		for member := range s.sets[args[1]] {
+			members = append(members, bulkReply(member))
+		}
+		return arrayReply(members)
+	case "SUBSCRIBE":
+		c.subscribed = true
+		replies := ""
+		for i, channel := range args[1:] {
+			if s.subscribers[channel] == nil {
+				s.subscribers[channel] = map[*fakeRedisConn]struct{}{}
+			}
+			s.subscribers[channel][c] = struct{}{}
+			reply := arrayReply([]string{bulkReply("subscribe"), bulkReply(channel), ":" + strconv.Itoa(i+1)})
+			if i > 0 {
+				replies += "\r\n"
+			}
+			replies += reply
+		}
+		return replies
+	case "PUBLISH":
+		message := arrayReply([]string{bulkReply("message"), bulkReply(args[1]), bulkReply(args[2])})
+		for sub := range s.subscribers[args[1]] {
+			go sub.reply(message)
+		}
+		return ":" + strconv.Itoa(len(s.subscribers[args[1]]))
+	default:
+		return "-ERR unknown command '" + name + "'"
+	}
+}
+
+func (c *fakeRedisConn) reply(reply string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.w.WriteString(reply + "\r\n")
+	c.w.Flush()
+}
+
+func bulkReply(s string) string {
+	return "$" + strconv.Itoa(len(s)) + "\r\n" + s
+}
+
+func arrayReply(items []string) string {
+	if len(items) == 0 {
+		return "*0"
+	}
+	return "*" + strconv.Itoa(len(items)) + "\r\n" + strings.Join(items, "\r\n")
+}
+
+// readCommand reads a command sent as an array of bulk strings.
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "*") {
+		return nil, fmt.Errorf("unexpected %q", line)
+	}
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n < 1 {
+		return nil, fmt.Errorf("unexpected %q", line)
+	}
+
+	args := make([]string, n)
+	for i := range args {
+		line, err := readLine(r)
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimPrefix(line, "$"))
+		if err != nil {
+			return nil, fmt.Errorf("unexpected %q", line)
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// newTestStorage returns a cache in front of the fake server, or of no Redis
+// at all when srv is nil, along with a Postgres fallback without any rows.
+func newTestStorage(t *testing.T, srv *fakeRedis, localSize int) *CacheStorage {
+	t.Helper()
+
+	var rdb *redis.Client
+	if srv != nil {
+		rdb = srv.client(t)
+	}
+
+	db := sql.OpenDB(emptyDB{})
+	t.Cleanup(func() { db.Close() })
+
+	return NewCacheStorage(rdb, storage.NewStorage(db), Config{TTL: time.Minute, NegativeTTL: time.Minute, ListTTL: time.Minute, LocalSize: localSize})
+}
+
+// emptyDB is a database/sql driver whose queries return no rows.
+type emptyDB struct{}
+
+func (emptyDB) Connect(context.Context) (driver.Conn, error) { return emptyConn{}, nil }
+func (emptyDB) Driver() driver.Driver                        { return nil }
+
+type emptyConn struct{}
+
+func (emptyConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("prepared statements are not supported")
+}
+func (emptyConn) Close() error              { return nil }
+func (emptyConn) Begin() (driver.Tx, error) { return nil, errors.New("transactions are not supported") }
+
+func (emptyConn) QueryContext(context.Context, string, []driver.NamedValue) (driver.Rows, error) {
+	return emptyRows{}, nil
+}
+
+type emptyRows struct{}
+
+func (emptyRows) Columns() []string         { return nil }
+func (emptyRows) Close() error              { return nil }
+func (emptyRows) Next([]driver.Value) error { return io.EOF }
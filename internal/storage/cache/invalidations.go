@@ -0,0 +1,65 @@
+package cache
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// invalidationChannel carries the keys and tag keys that an instance
+// invalidated, prefixed with its instance ID, so that the other instances
+// drop them from their local tier.
+const invalidationChannel = "cache:invalidations"
+
+func (e entries) publish(ctx context.Context, key string) error {
+	return e.rdb.Publish(ctx, invalidationChannel, e.instance+" "+key).Err()
+}
+
+// ListenForInvalidations drops the entries that other instances change from
+// the local tier until ctx is done. Messages sent while the subscription is
+// down are lost, so the local tier is cleared every time it is established.
+// Without Redis there is nothing to listen to and it returns immediately.
+func (s *CacheStorage) ListenForInvalidations(ctx context.Context) {
+	e := s.Users.entries
+	if e.rdb == nil || e.local == nil {
+		return
+	}
+
+	pubsub := e.rdb.Subscribe(ctx, invalidationChannel)
+	defer pubsub.Close()
+
+	for {
+		msg, err := pubsub.Receive(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			// the subscription is retried once Redis is back
+			s.breaker.failed(ctx, err)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(retryInterval):
+			}
+			continue
+		}
+
+		switch msg := msg.(type) {
+		case *redis.Subscription:
+			e.local.purge()
+		case *redis.Message:
+			instance, key, ok := strings.Cut(msg.Payload, " ")
+			if !ok || instance == e.instance {
+				continue
+			}
+			if tag, ok := strings.CutPrefix(key, "tag:"); ok {
+				e.local.invalidateTag(tag)
+			} else {
+				e.local.delete(key)
+			}
+		}
+	}
+}
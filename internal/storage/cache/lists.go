@@ -0,0 +1,119 @@
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// EventsTag is carried by every cached event listing. Creating or changing
+// any event can change which events a listing holds and its total.
+const EventsTag = "events"
+
+// EventTag is carried by the cached lists that depend on the event.
+func EventTag(id int) string {
+	return "event:" + strconv.Itoa(id)
+}
+
+// UserTag is carried by the cached lists that depend on the user.
+func UserTag(id int) string {
+	return "user:" + strconv.Itoa(id)
+}
+
+func tagKey(tag string) string {
+	return "tag:" + tag
+}
+
+// ListCache caches query results under keys derived from their parameters.
+// Each result is tagged with the events and users it depends on, and
+// invalidating a tag drops exactly the results carrying it.
+type ListCache struct {
+	entries
+}
+
+// ListKey derives the cache key of the kind of list queried with params.
+func ListKey(kind string, params ...any) string {
+	data, _ := json.Marshal(params)
+	sum := sha256.Sum256(data)
+	return "list:" + kind + ":" + hex.EncodeToString(sum[:16])
+}
+
+// listEntry is a cached list along with its tags, which are kept in Redis
+// too so that the local tier can tag the lists it reads from there.
+type listEntry[T any] struct {
+	Items T        `json:"items"`
+	Tags  []string `json:"tags"`
+}
+
+func (l listEntry[T]) cacheTags() []string {
+	return l.Tags
+}
+
+// FetchList returns the list cached at key, loading it on a miss along with
+// the tags it is cached with. Concurrent misses for the same key share a
+// single load.
+func FetchList[T any](ctx context.Context, l *ListCache, key string, load func(context.Context) (*T, []string, error)) (*T, error) {
+	entry, err := fetch(ctx, l.entries, key, nil, func(ctx context.Context) (*listEntry[T], error) {
+		items, tags, err := load(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return &listEntry[T]{Items: *items, Tags: tags}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &entry.Items, nil
+}
+
+// Invalidate drops the lists carrying any of the tags from both tiers and
+// from the local tier of the other instances. When Redis cannot be updated
+// the tags are invalidated once it is back.
+func (l *ListCache) Invalidate(ctx context.Context, tags ...string) error {
+	for _, tag := range tags {
+		l.local.invalidateTag(tag)
+	}
+	if l.rdb == nil {
+		return nil
+	}
+
+	var err error
+	for _, tag := range tags {
+		if !l.breaker.allow() {
+			l.breaker.postpone(tagKey(tag))
+			continue
+		}
+		if tagErr := l.invalidateTag(ctx, tag); tagErr != nil {
+			l.breaker.failed(ctx, tagErr)
+			l.breaker.postpone(tagKey(tag))
+			err = tagErr
+		}
+	}
+	return err
+}
+
+// invalidateTag drops the lists carrying tag from Redis. The tag's members
+// are read and cleared at once, so lists tagged meanwhile stay reachable.
+func (e entries) invalidateTag(ctx context.Context, tag string) error {
+	var members *redis.StringSliceCmd
+	_, err := e.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		members = pipe.SMembers(ctx, tagKey(tag))
+		pipe.Del(ctx, tagKey(tag))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if keys := members.Val(); len(keys) > 0 {
+		if err := e.rdb.Del(ctx, keys...).Err(); err != nil {
+			return err
+		}
+	}
+
+	return e.publish(ctx, tagKey(tag))
+}
@@ -0,0 +1,171 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestListKey(t *testing.T) {
+	type filter struct{ Name string }
+
+	tests := []struct {
+		a, b []any
+		same bool
+	}{
+		{a: []any{"events", filter{"go"}, 1}, b: []any{"events", filter{"go"}, 1}, same: true},
+		{a: []any{"events", filter{"go"}, 1}, b: []any{"events", filter{"go"}, 2}},
+		{a: []any{"events", filter{"go"}}, b: []any{"events", filter{"rust"}}},
+		{a: []any{"events", 1}, b: []any{"attending", 1}},
+	}
+
+	for _, tt := range tests {
+		a, b := ListKey(tt.a[0].(string), tt.a[1:]...), ListKey(tt.b[0].(string), tt.b[1:]...)
+		if (a == b) != tt.same {
+			t.Errorf("ListKey(%v) = %s and ListKey(%v) = %s, want same = %v", tt.a, a, tt.b, b, tt.same)
+		}
+	}
+}
+
+// testLists are cached by cacheTestLists, with their tags.
+var testLists = map[string][]string{
+	"a": {EventTag(1), EventsTag},
+	"b": {EventTag(2), EventsTag},
+	"c": {UserTag(1)},
+}
+
+// cacheTestLists caches testLists and returns a fetch that reports whether
+// the list had to be loaded again.
+func cacheTestLists(t *testing.T, s *CacheStorage) func(name string) bool {
+	t.Helper()
+
+	fetch := func(name string) bool {
+		t.Helper()
+		loaded := false
+		items, err := FetchList(context.Background(), &s.Lists, ListKey(name), func(ctx context.Context) (*[]string, []string, error) {
+			loaded = true
+			return &[]string{name}, testLists[name], nil
+		})
+		if err != nil || len(*items) != 1 || (*items)[0] != name {
+			t.Fatalf("FetchList(%s) = %v, %v", name, items, err)
+		}
+		return loaded
+	}
+
+	for name := range testLists {
+		if !fetch(name) {
+			t.Fatalf("%s was cached before it was loaded", name)
+		}
+	}
+	return fetch
+}
+
+func TestListInvalidate(t *testing.T) {
+	tests := []struct {
+		name string
+		tags []string
+		gone []string
+	}{
+		{name: "event", tags: []string{EventTag(1)}, gone: []string{"a"}},
+		{name: "all event listings", tags: []string{EventsTag}, gone: []string{"a", "b"}},
+		{name: "several tags", tags: []string{EventTag(2), UserTag(1)}, gone: []string{"b", "c"}},
+		{name: "unknown tag", tags: []string{EventTag(3)}},
+	}
+
+	for _, tt := range tests {
+		for _, tier := range []string{"local", "redis"} {
+			t.Run(tt.name+" in "+tier, func(t *testing.T) {
+				var s *CacheStorage
+				srv := newFakeRedis(t)
+				if tier == "local" {
+					s = newTestStorage(t, nil, 10)
+				} else {
+					s = newTestStorage(t, srv, 0)
+				}
+				fetch := cacheTestLists(t, s)
+
+				if err := s.Lists.Invalidate(context.Background(), tt.tags...); err != nil {
+					t.Fatal(err)
+				}
+				for _, tag := range tt.tags {
+					if srv.has(tagKey(tag)) {
+						t.Errorf("%s is still in Redis", tagKey(tag))
+					}
+				}
+
+				gone := map[string]bool{}
+				for _, name := range tt.gone {
+					gone[name] = true
+				}
+				for name := range testLists {
+					if loaded := fetch(name); loaded != gone[name] {
+						t.Errorf("%s loaded again = %v, want %v", name, loaded, gone[name])
+					}
+				}
+			})
+		}
+	}
+}
+
+// TestListInvalidateAcrossInstances checks that lists another instance read
+// from Redis keep their tags in its local tier, so that invalidating them on
+// one instance drops them on the other.
+func TestListInvalidateAcrossInstances(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	srv := newFakeRedis(t)
+	first, second := newTestStorage(t, srv, 10), newTestStorage(t, srv, 10)
+
+	// the local tier is cleared once the subscription is established
+	second.local.set("sentinel", true, time.Minute)
+	go second.ListenForInvalidations(ctx)
+	waitFor(t, "the subscription", func() bool {
+		_, ok := second.local.get("sentinel")
+		return !ok
+	})
+
+	cacheTestLists(t, first)
+	secondFetch := func(name string) bool {
+		t.Helper()
+		loaded := false
+		if _, err := FetchList(ctx, &second.Lists, ListKey(name), func(ctx context.Context) (*[]string, []string, error) {
+			loaded = true
+			return &[]string{name}, testLists[name], nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		return loaded
+	}
+	for name := range testLists {
+		if secondFetch(name) {
+			t.Fatalf("%s was loaded again instead of read from Redis", name)
+		}
+	}
+
+	if err := first.Lists.Invalidate(ctx, EventTag(1)); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, "the invalidation", func() bool {
+		_, ok := second.local.get(ListKey("a"))
+		return !ok
+	})
+	for _, name := range []string{"b", "c"} {
+		if _, ok := second.local.get(ListKey(name)); !ok {
+			t.Errorf("%s was dropped from the other instance", name)
+		}
+	}
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,176 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// localCache is a bounded in-process LRU cache whose entries also expire
+// after their TTL. A nil localCache caches nothing.
+type localCache struct {
+	mu       sync.Mutex
+	capacity int
+	items    map[string]*list.Element
+	// order holds the entries, most recently used first
+	order *list.List
+	// tagged holds the keys of the entries carrying each tag
+	tagged map[string]map[string]struct{}
+
+	hits, misses, evictions, expirations atomic.Int64
+}
+
+type localEntry struct {
+	key       string
+	value     any
+	expiresAt time.Time
+	tags      []string
+}
+
+// missingEntry is cached locally in place of an entity that does not exist.
+type missingEntry struct{}
+
+// LocalStats are the counters of the in-process cache tier.
+type LocalStats struct {
+	Size        int   `json:"size"`
+	Capacity    int   `json:"capacity"`
+	Hits        int64 `json:"hits"`
+	Misses      int64 `json:"misses"`
+	Evictions   int64 `json:"evictions"`
+	Expirations int64 `json:"expirations"`
+}
+
+func newLocalCache(capacity int) *localCache {
+	if capacity <= 0 {
+		return nil
+	}
+	return &localCache{capacity: capacity, items: make(map[string]*list.Element), order: list.New(), tagged: make(map[string]map[string]struct{})}
+}
+
+func (l *localCache) get(key string) (any, bool) {
+	if l == nil {
+		return nil, false
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	el, ok := l.items[key]
+	if !ok {
+		l.misses.Add(1)
+		return nil, false
+	}
+
+	entry := el.Value.(*localEntry)
+	if !time.Now().Before(entry.expiresAt) {
+		l.remove(el)
+		l.expirations.Add(1)
+		l.misses.Add(1)
+		return nil, false
+	}
+
+	l.order.MoveToFront(el)
+	l.hits.Add(1)
+	return entry.value, true
+}
+
+// set caches value at key, tagged with tags.
+func (l *localCache) set(key string, value any, ttl time.Duration, tags ...string) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if el, ok := l.items[key]; ok {
+		l.remove(el)
+	}
+
+	l.items[key] = l.order.PushFront(&localEntry{key: key, value: value, expiresAt: time.Now().Add(ttl), tags: tags})
+	for _, tag := range tags {
+		if l.tagged[tag] == nil {
+			l.tagged[tag] = make(map[string]struct{})
+		}
+		l.tagged[tag][key] = struct{}{}
+	}
+
+	if l.order.Len() > l.capacity {
+		l.remove(l.order.Back())
+		l.evictions.Add(1)
+	}
+}
+
+func (l *localCache) delete(key string) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if el, ok := l.items[key]; ok {
+		l.remove(el)
+	}
+}
+
+// invalidateTag drops the entries carrying tag.
+func (l *localCache) invalidateTag(tag string) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for key := range l.tagged[tag] {
+		l.remove(l.items[key])
+	}
+}
+
+// purge drops every entry.
+func (l *localCache) purge() {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.items = make(map[string]*list.Element)
+	l.order.Init()
+	l.tagged = make(map[string]map[string]struct{})
+}
+
+func (l *localCache) remove(el *list.Element) {
+	entry := el.Value.(*localEntry)
+
+	l.order.Remove(el)
+	delete(l.items, entry.key)
+	for _, tag := range entry.tags {
+		delete(l.tagged[tag], entry.key)
+		if len(l.tagged[tag]) == 0 {
+			delete(l.tagged, tag)
+		}
+	}
+}
+
+func (l *localCache) stats() LocalStats {
+	if l == nil {
+		return LocalStats{}
+	}
+
+	l.mu.Lock()
+	size := l.order.Len()
+	l.mu.Unlock()
+
+	return LocalStats{
+		Size:        size,
+		Capacity:    l.capacity,
+		Hits:        l.hits.Load(),
+		Misses:      l.misses.Load(),
+		Evictions:   l.evictions.Load(),
+		Expirations: l.expirations.Load(),
+	}
+}
@@ -0,0 +1,151 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLocalCacheEviction(t *testing.T) {
+	tests := []struct {
+		name string
+		// ops are "get" or "set" followed by a key
+		ops  [][2]string
+		want []string
+		gone []string
+	}{
+		{
+			name: "least recently set",
+			ops:  [][2]string{{"set", "a"}, {"set", "b"}, {"set", "c"}, {"set", "d"}},
+			want: []string{"b", "c", "d"},
+			gone: []string{"a"},
+		},
+		{
+			name: "reads count as use",
+			ops:  [][2]string{{"set", "a"}, {"set", "b"}, {"set", "c"}, {"get", "a"}, {"set", "d"}},
+			want: []string{"a", "c", "d"},
+			gone: []string{"b"},
+		},
+		{
+			name: "setting again counts as use",
+			ops:  [][2]string{{"set", "a"}, {"set", "b"}, {"set", "c"}, {"set", "a"}, {"set", "d"}},
+			want: []string{"a", "c", "d"},
+			gone: []string{"b"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newLocalCache(3)
+			for _, op := range tt.ops {
+				if op[0] == "get" {
+					l.get(op[1])
+				} else {
+					l.set(op[1], op[1], time.Minute)
+				}
+			}
+
+			for _, key := range tt.gone {
+				if _, ok := l.get(key); ok {
+					t.Errorf("%s is still cached", key)
+				}
+			}
+			for _, key := range tt.want {
+				if v, ok := l.get(key); !ok || v != key {
+					t.Errorf("get(%s) = %v, %v, want %s", key, v, ok, key)
+				}
+			}
+			if stats := l.stats(); stats.Size != 3 || stats.Evictions != int64(len(tt.gone)) {
+				t.Errorf("stats = %+v, want size 3 and %d evictions", stats, len(tt.gone))
+			}
+		})
+	}
+}
+
+func TestLocalCacheExpiry(t *testing.T) {
+	l := newLocalCache(10)
+	l.set("short", 1, time.Millisecond)
+	l.set("long", 2, time.Minute)
+
+	time.Sleep(5 * time.Millisecond)
+
+	if _, ok := l.get("short"); ok {
+		t.Error("expired entry is still cached")
+	}
+	if v, ok := l.get("long"); !ok || v != 2 {
+		t.Errorf("get(long) = %v, %v, want 2", v, ok)
+	}
+
+	want := LocalStats{Size: 1, Capacity: 10, Hits: 1, Misses: 1, Expirations: 1}
+	if stats := l.stats(); stats != want {
+		t.Errorf("stats = %+v, want %+v", stats, want)
+	}
+}
+
+func TestLocalCacheTags(t *testing.T) {
+	tests := []struct {
+		name       string
+		invalidate string
+		want       []string
+		gone       []string
+	}{
+		{name: "one tag", invalidate: "event:1", want: []string{"b", "c"}, gone: []string{"a"}},
+		{name: "shared tag", invalidate: "events", want: []string{"c"}, gone: []string{"a", "b"}},
+		{name: "unknown tag", invalidate: "event:3", want: []string{"a", "b", "c"}},
+		// d was retagged without user:1 when it was set again
+		{name: "stale tag", invalidate: "user:1", want: []string{"a", "b", "c", "d"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newLocalCache(10)
+			l.set("a", "a", time.Minute, "event:1", "events")
+			l.set("b", "b", time.Minute, "event:2", "events")
+			l.set("c", "c", time.Minute, "user:2")
+			l.set("d", "d", time.Minute, "user:1")
+			l.set("d", "d", time.Minute)
+
+			l.invalidateTag(tt.invalidate)
+
+			for _, key := range tt.gone {
+				if _, ok := l.get(key); ok {
+					t.Errorf("%s is still cached", key)
+				}
+			}
+			for _, key := range tt.want {
+				if _, ok := l.get(key); !ok {
+					t.Errorf("%s is no longer cached", key)
+				}
+			}
+		})
+	}
+}
+
+func TestLocalCacheTagIndex(t *testing.T) {
+	l := newLocalCache(1)
+	l.set("a", "a", time.Minute, "event:1")
+	l.set("b", "b", time.Minute, "event:2")
+	l.delete("b")
+
+	// neither the evicted nor the deleted entry is left in the index
+	if len(l.tagged) != 0 {
+		t.Errorf("tag index = %v, want it empty", l.tagged)
+	}
+}
+
+func TestLocalCacheNil(t *testing.T) {
+	l := newLocalCache(0)
+	if l != nil {
+		t.Fatalf("newLocalCache(0) = %v, want nil", l)
+	}
+
+	l.set("a", "a", time.Minute, "tag")
+	if _, ok := l.get("a"); ok {
+		t.Error("nil cache returned a value")
+	}
+	l.delete("a")
+	l.invalidateTag("tag")
+	l.purge()
+	if stats := l.stats(); stats != (LocalStats{}) {
+		t.Errorf("stats = %+v, want zero", stats)
+	}
+}
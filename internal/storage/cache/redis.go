@@ -2,21 +2,28 @@ package cache
 
 import (
 	"context"
+	"time"
+
 	"github.com/go-redis/redis/v8"
-	"log"
 )
 
-func NewRedisClient(addr, pw string, db int) *redis.Client {
+// NewRedisClient returns a client for the Redis server along with the error
+// of pinging it. The client is usable either way: it connects once the
+// server is reachable, and until then the cache falls back to Postgres.
+func NewRedisClient(addr, pw string, db int) (*redis.Client, error) {
 	rdb := redis.NewClient(&redis.Options{
 		Addr:     addr,
 		Password: pw, // no password set
 		DB:       db, // use default DB
+		// fail fast so that requests fall back instead of waiting on an
+		// unreachable server
+		DialTimeout:  2 * time.Second,
+		ReadTimeout:  time.Second,
+		WriteTimeout: time.Second,
 	})
 
-	// Ping the Redis server to check if it's available
-	if err := rdb.Ping(context.Background()).Err(); err != nil {
-		log.Fatalf("Could not connect to Redis: %v", err)
-	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
 
-	return rdb
+	return rdb, rdb.Ping(ctx).Err()
 }
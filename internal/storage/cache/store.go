@@ -1,15 +1,73 @@
 package cache
 
-import "github.com/go-redis/redis/v8"
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/puremike/event-mgt-api/internal/storage"
+	"golang.org/x/sync/singleflight"
+)
 
 type CacheStorage struct {
-	Users  UserCache
-	Events EventCache
+	Users    UserCache
+	Events   EventCache
+	Lists    ListCache
+	Denylist TokenDenylist
+	Attempts LoginAttempts
+
+	rdb     *redis.Client
+	breaker *breaker
+	local   *localCache
+}
+
+// Config sets how long users and events are cached, how long IDs that do not
+// exist are remembered and how long lists are cached. Up to LocalSize
+// entries are kept in process, in front of Redis when it is enabled; a
+// LocalSize of 0 leaves them to Redis alone.
+type Config struct {
+	TTL         time.Duration
+	NegativeTTL time.Duration
+	ListTTL     time.Duration
+	LocalSize   int
 }
 
-func NewCacheStorage(rdb *redis.Client) *CacheStorage {
+// NewCacheStorage caches in Redis when rdb is set. The denylist and login
+// attempts fall back to their Postgres stores while Redis is unavailable.
+func NewCacheStorage(rdb *redis.Client, store *storage.Storage, cfg Config) *CacheStorage {
+	b := newBreaker()
+	local := newLocalCache(cfg.LocalSize)
+
+	e := entries{rdb: rdb, breaker: b, local: local, ttl: cfg.TTL, negativeTTL: cfg.NegativeTTL, loads: &singleflight.Group{}, instance: newInstanceID()}
+	lists := e
+	lists.ttl = cfg.ListTTL
+
 	return &CacheStorage{
-		Users:  UserCache{rdb},
-		Events: EventCache{rdb},
+		Users:    UserCache{e},
+		Events:   EventCache{e},
+		Lists:    ListCache{lists},
+		Denylist: TokenDenylist{rdb, b, &store.RevokedTokens},
+		Attempts: LoginAttempts{rdb, b, &store.LoginAttempts},
+		rdb:      rdb,
+		breaker:  b,
+		local:    local,
 	}
 }
+
+// Health reports whether Redis is up along with the counters of the
+// in-process tier.
+func (s *CacheStorage) Health() CacheHealth {
+	h := CacheHealth{Redis: "disabled"}
+	if s.rdb != nil {
+		h = s.breaker.health()
+	}
+	h.Local = s.local.stats()
+	return h
+}
+
+func newInstanceID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
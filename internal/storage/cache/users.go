@@ -2,53 +2,31 @@ package cache
 
 import (
 	"context"
-	"encoding/json"
 	"strconv"
-	"time"
 
-	"github.com/go-redis/redis/v8"
 	"github.com/puremike/event-mgt-api/internal/storage"
 )
 
 type UserCache struct {
-	rdb *redis.Client
+	entries
 }
 
-const timeExp = time.Minute * 2
-
-func (u *UserCache) Get(ctx context.Context, id int) (*storage.User, error) {
-	cacheKey := "user:" + strconv.Itoa(id)
-
-	data, err := u.rdb.Get(ctx, cacheKey).Result()
-
-	if err == redis.Nil {
-		return nil, nil
-	} else if err != nil {
-		return nil, err
-	}
-
-	var user storage.User
-
-	if data != "" {
-		if err := json.Unmarshal([]byte(data), &user); err != nil {
-			return nil, err
-		}
-	}
+func userKey(id int) string {
+	return "user:" + strconv.Itoa(id)
+}
 
-	return &user, nil
+// Fetch returns the cached user, loading it with load on a miss. Unknown IDs
+// return storage.ErrUserNotFound.
+func (u *UserCache) Fetch(ctx context.Context, id int, load func(context.Context, int) (*storage.User, error)) (*storage.User, error) {
+	return fetch(ctx, u.entries, userKey(id), storage.ErrUserNotFound, func(ctx context.Context) (*storage.User, error) {
+		return load(ctx, id)
+	})
 }
 
 func (u *UserCache) Set(ctx context.Context, user *storage.User) error {
-	CacheKey := "user:" + strconv.Itoa(user.ID)
-	data, err := json.Marshal(user)
-	if err != nil {
-		return err
-	}
-
-	return u.rdb.Set(ctx, CacheKey, data, timeExp).Err()
+	return u.set(ctx, userKey(user.ID), *user)
 }
 
-func (u *UserCache) Delete(ctx context.Context, id int) {
-	cacheKey := "user:" + strconv.Itoa(id)
-	u.rdb.Del(ctx, cacheKey)
+func (u *UserCache) Delete(ctx context.Context, id int) error {
+	return u.delete(ctx, userKey(id))
 }
@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+)
+
+type CalendarFeedStore struct {
+	db *sql.DB
+}
+
+// RotateFeedToken revokes the user's current feed token, if any, and stores
+// the hash of a new one. Only one feed token is active per user.
+func (f *CalendarFeedStore) RotateFeedToken(ctx context.Context, userId int, tokenHash string) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	tx, err := f.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx, `UPDATE calendar_feed_tokens SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`, userId); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx, `INSERT INTO calendar_feed_tokens (user_id, token_hash) VALUES ($1, $2)`, userId, tokenHash); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return nil
+}
+
+// GetFeedTokenUserID returns the user an active feed token belongs to.
+func (f *CalendarFeedStore) GetFeedTokenUserID(ctx context.Context, tokenHash string) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	query := `SELECT user_id FROM calendar_feed_tokens WHERE token_hash = $1 AND revoked_at IS NULL`
+
+	var userId int
+	if err := f.db.QueryRowContext(ctx, query, tokenHash).Scan(&userId); err != nil {
+		if err == sql.ErrNoRows {
+			return 0, ErrFeedTokenNotFound
+		}
+		return 0, err
+	}
+
+	return userId, nil
+}
+
+func (f *CalendarFeedStore) RevokeFeedTokens(ctx context.Context, userId int) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	query := `UPDATE calendar_feed_tokens SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`
+
+	result, err := f.db.ExecContext(ctx, query, userId)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrFeedTokenNotFound
+	}
+
+	return nil
+}
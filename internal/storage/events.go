@@ -3,7 +3,12 @@ package storage
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"fmt"
 	"time"
+
+	"github.com/lib/pq"
+	"github.com/puremike/event-mgt-api/internal/rrule"
 )
 
 type Event struct {
@@ -11,31 +16,233 @@ type Event struct {
 	OwnerID     int       `json:"owner_id"`
 	Name        string    `json:"name"`
 	Description string    `json:"description"`
-	Date        time.Time `json:"date"`
+	StartsAt    time.Time `json:"starts_at"`
+	EndsAt      time.Time `json:"ends_at"`
+	Timezone    string    `json:"timezone"`
 	Location    string    `json:"location"`
+	Capacity    *int      `json:"capacity"`
+	Visibility  string    `json:"visibility"`
+	// RRule makes the event a recurring series whose first occurrence is
+	// StartsAt to EndsAt. ExDates lists the start times of cancelled
+	// occurrences.
+	RRule   string      `json:"rrule,omitempty"`
+	ExDates []time.Time `json:"exdates,omitempty"`
+}
+
+// eventColumns lists the columns read into an Event for queries that alias
+// the events table as e. It matches the order of Event.fields.
+const eventColumns = `e.id, e.owner_id, e.name, e.description, e.starts_at, e.ends_at, e.timezone, e.location, e.capacity, e.visibility, COALESCE(e.rrule, ''), to_json(e.exdates)`
+
+// fields returns the scan destinations for eventColumns.
+func (e *Event) fields() []any {
+	return []any{&e.ID, &e.OwnerID, &e.Name, &e.Description, &e.StartsAt, &e.EndsAt, &e.Timezone, &e.Location, &e.Capacity, &e.Visibility, &e.RRule, (*timeList)(&e.ExDates)}
+}
+
+// localize expresses the event times in the event's own time zone so they are
+// rendered with its local offset. Recurring events are expanded in this zone.
+func (e *Event) localize() {
+	loc, err := time.LoadLocation(e.Timezone)
+	if err != nil {
+		return
+	}
+	e.StartsAt = e.StartsAt.In(loc)
+	e.EndsAt = e.EndsAt.In(loc)
+	for i := range e.ExDates {
+		e.ExDates[i] = e.ExDates[i].In(loc)
+	}
+}
+
+func (e *Event) Recurring() bool {
+	return e.RRule != ""
+}
+
+// Occurrences returns the start times of the occurrences that begin within
+// [from, to]. A non-recurring event has a single occurrence.
+func (e *Event) Occurrences(from, to time.Time) ([]time.Time, error) {
+	if !e.Recurring() {
+		if e.StartsAt.Before(from) || e.StartsAt.After(to) {
+			return nil, nil
+		}
+		return []time.Time{e.StartsAt}, nil
+	}
+
+	rule, err := rrule.Parse(e.RRule)
+	if err != nil {
+		return nil, err
+	}
+	return rule.Between(e.StartsAt, from, to, e.ExDates), nil
+}
+
+// HasOccurrence reports whether an occurrence of the series starts at t.
+func (e *Event) HasOccurrence(t time.Time) bool {
+	occurrences, err := e.Occurrences(t, t)
+	return err == nil && len(occurrences) == 1
+}
+
+// seriesEnd returns when the last occurrence of the event ends, or nil for a
+// series that repeats forever.
+func (e *Event) seriesEnd() (*time.Time, error) {
+	if !e.Recurring() {
+		return &e.EndsAt, nil
+	}
+
+	rule, err := rrule.Parse(e.RRule)
+	if err != nil {
+		return nil, err
+	}
+
+	last, ok := rule.Last(e.StartsAt)
+	if !ok {
+		return nil, nil
+	}
+	end := last.Add(e.EndsAt.Sub(e.StartsAt))
+	return &end, nil
 }
 
+// timeList scans the JSON rendering of a timestamptz[] column.
+type timeList []time.Time
+
+func (t *timeList) Scan(src any) error {
+	var data []byte
+	switch v := src.(type) {
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	case nil:
+		*t = nil
+		return nil
+	default:
+		return fmt.Errorf("cannot scan %T into timeList", src)
+	}
+
+	var times []time.Time
+	if err := json.Unmarshal(data, &times); err != nil {
+		return err
+	}
+	*t = times
+	return nil
+}
+
+// timestampArray renders times as a text array for a $n::timestamptz[]
+// parameter.
+func timestampArray(times []time.Time) pq.StringArray {
+	out := make(pq.StringArray, len(times))
+	for i, t := range times {
+		out[i] = t.Format(time.RFC3339Nano)
+	}
+	return out
+}
+
+// Event visibility. Unlisted events can be seen by anyone who knows their ID
+// but are left out of listings; private events are only visible to their
+// owner, invitees and attendees.
+const (
+	VisibilityPublic   = "public"
+	VisibilityUnlisted = "unlisted"
+	VisibilityPrivate  = "private"
+)
+
 type EventStore struct {
 	db *sql.DB
 }
 
+// EventFilter narrows down event listings. Zero values are ignored.
+//
+// ViewerID is the user the listing is for, or 0 when anonymous. Private
+// events are only returned to users who may see them, and ListedOnly further
+// limits the listing to public events and the viewer's own.
+type EventFilter struct {
+	From       *time.Time
+	To         *time.Time
+	Location   string
+	OwnerID    int
+	ViewerID   int
+	ListedOnly bool
+}
+
+var eventSortColumns = map[string]sortColumn{
+	"date": {expr: "e.starts_at", cast: "::timestamptz"},
+	"name": {expr: "e.name"},
+	"id":   {expr: "e.id"},
+}
+
+// conditions renders the filter as SQL predicates over the events table
+// aliased as e, appending their arguments to args.
+func (f EventFilter) conditions(args *[]any) []string {
+	var conditions []string
+
+	// an event matches the range when any part of it overlaps the range; for
+	// a recurring event that is any part of the whole series
+	if f.From != nil {
+		*args = append(*args, *f.From)
+		conditions = append(conditions, fmt.Sprintf("(CASE WHEN e.rrule IS NULL THEN e.ends_at ELSE COALESCE(e.series_ends_at, 'infinity') END) >= $%d", len(*args)))
+	}
+	if f.To != nil {
+		*args = append(*args, *f.To)
+		conditions = append(conditions, fmt.Sprintf("e.starts_at <= $%d", len(*args)))
+	}
+	if f.Location != "" {
+		*args = append(*args, "%"+escapeLike(f.Location)+"%")
+		conditions = append(conditions, fmt.Sprintf("e.location ILIKE $%d", len(*args)))
+	}
+	if f.OwnerID != 0 {
+		*args = append(*args, f.OwnerID)
+		conditions = append(conditions, fmt.Sprintf("e.owner_id = $%d", len(*args)))
+	}
+
+	*args = append(*args, f.ViewerID)
+	if f.ListedOnly {
+		conditions = append(conditions, fmt.Sprintf("(e.visibility = 'public' OR e.owner_id = $%d)", len(*args)))
+	} else {
+		conditions = append(conditions, fmt.Sprintf("(e.visibility <> 'private' OR %s)", eventAccessCondition("e.id", fmt.Sprintf("$%d", len(*args)))))
+	}
+
+	return conditions
+}
+
+func eventCursorKey(sort string) func(Event) (string, int) {
+	return func(e Event) (string, int) {
+		switch sort {
+		case "date":
+			return e.StartsAt.Format(time.RFC3339Nano), e.ID
+		case "name":
+			return e.Name, e.ID
+		default:
+			return "", e.ID
+		}
+	}
+}
+
 func (e *EventStore) CreateEvent(ctx context.Context, event *Event) error {
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
 	defer cancel()
 
-	query := `INSERT INTO events (owner_id, name, description, date, location) VALUES ($1, $2, $3, $4, $5) RETURNING owner_id, name, description, date, location`
+	query := `INSERT INTO events AS e (owner_id, name, description, starts_at, ends_at, timezone, location, capacity, visibility, rrule, exdates, series_ends_at)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NULLIF($10, ''), $11::timestamptz[], $12) RETURNING ` + eventColumns
+
+	seriesEnd, err := event.seriesEnd()
+	if err != nil {
+		return err
+	}
 
 	tx, err := e.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
 
-	err = tx.QueryRowContext(ctx, query, event.OwnerID, event.Name, event.Description, event.Date, event.Location).Scan(&event.OwnerID, &event.Name, &event.Description, &event.Date, &event.Location)
+	err = tx.QueryRowContext(ctx, query, event.OwnerID, event.Name, event.Description, event.StartsAt, event.EndsAt, event.Timezone, event.Location, event.Capacity, event.Visibility, event.RRule, timestampArray(event.ExDates), seriesEnd).Scan(event.fields()...)
 
 	if err != nil {
 		tx.Rollback()
 		return err
 	}
+	event.localize()
+
+	if err = grantOwnerRole(ctx, tx, event.ID, event.OwnerID); err != nil {
+		tx.Rollback()
+		return err
+	}
 
 	if err = tx.Commit(); err != nil {
 		tx.Rollback()
@@ -49,39 +256,86 @@ func (e *EventStore) GetEventByID(ctx context.Context, eventId int) (*Event, err
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
 	defer cancel()
 
-	query := `SELECT id, owner_id, name, description, date, location FROM events WHERE id = $1`
+	query := `SELECT ` + eventColumns + ` FROM events e WHERE e.id = $1`
 
 	event := &Event{}
 
-	err := e.db.QueryRowContext(ctx, query, eventId).Scan(&event.ID, &event.OwnerID, &event.Name, &event.Description, &event.Date, &event.Location)
+	err := e.db.QueryRowContext(ctx, query, eventId).Scan(event.fields()...)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, ErrEventNotFound
 		}
 		return nil, err
 	}
+	event.localize()
 	return event, nil
 }
 
-func (e *EventStore) GetAllEvents(ctx context.Context) (*[]Event, error) {
+// GetEventIDsByOwner lists the IDs of the user's events, which are deleted
+// together with the user.
+func (e *EventStore) GetEventIDsByOwner(ctx context.Context, ownerId int) ([]int, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	ids := []int{}
+
+	rows, err := e.db.QueryContext(ctx, `SELECT id FROM events WHERE owner_id = $1`, ownerId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		if err = rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+func (e *EventStore) GetAllEvents(ctx context.Context, filter EventFilter, page PageParams) (*Page[Event], error) {
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
 	defer cancel()
 
-	query := `SELECT id, owner_id, name, description, date, location FROM events`
+	k, err := newKeyset(page, eventSortColumns, "date", "e.id")
+	if err != nil {
+		return nil, err
+	}
 
-	var events []Event
+	var args []any
+	conditions := filter.conditions(&args)
 
-	rows, err := e.db.QueryContext(ctx, query)
+	total, err := countRows(ctx, e.db, `SELECT COUNT(*) FROM events e`+whereClause(conditions), args)
+	if err != nil {
+		return nil, err
+	}
+
+	if cond := k.condition(&args); cond != "" {
+		conditions = append(conditions, cond)
+	}
+
+	query := `SELECT ` + eventColumns + ` FROM events e` + whereClause(conditions) + k.orderAndLimit()
+
+	events := []Event{}
+
+	rows, err := e.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 	for rows.Next() {
 		var e Event
-		if err = rows.Scan(&e.ID, &e.OwnerID, &e.Name, &e.Description, &e.Date, &e.Location); err != nil {
+		if err = rows.Scan(e.fields()...); err != nil {
 			return nil, err
 		}
+		e.localize()
 
 		events = append(events, e)
 	}
@@ -90,7 +344,9 @@ func (e *EventStore) GetAllEvents(ctx context.Context) (*[]Event, error) {
 		return nil, err
 	}
 
-	return &events, nil
+	events, next := nextCursor(k, events, eventCursorKey(k.params.Sort))
+
+	return &Page[Event]{Data: events, NextCursor: next, Total: total}, nil
 }
 
 func (e *EventStore) UpdateEvent(ctx context.Context, event *Event, eventId int) (*Event, error) {
@@ -98,19 +354,47 @@ func (e *EventStore) UpdateEvent(ctx context.Context, event *Event, eventId int)
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
 	defer cancel()
 
-	query := `UPDATE events SET name = $1, description = $2, date = $3, location = $4 WHERE id = $5 RETURNING owner_id, name, description, date, location`
+	query := `UPDATE events AS e SET name = $1, description = $2, starts_at = $3, ends_at = $4, timezone = $5, location = $6, capacity = $7,
+				visibility = $8, rrule = NULLIF($9, ''), exdates = $10::timestamptz[], series_ends_at = $11 WHERE id = $12 RETURNING ` + eventColumns
+
+	seriesEnd, err := event.seriesEnd()
+	if err != nil {
+		return nil, err
+	}
 
 	tx, err := e.db.BeginTx(ctx, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	err = tx.QueryRowContext(ctx, query, event.Name, event.Description, event.Date, event.Location, eventId).Scan(&event.OwnerID, &event.Name, &event.Description, &event.Date, &event.Location)
+	var previousStart time.Time
+	if err = tx.QueryRowContext(ctx, `SELECT starts_at FROM events WHERE id = $1 FOR UPDATE`, eventId).Scan(&previousStart); err != nil {
+		tx.Rollback()
+		if err == sql.ErrNoRows {
+			return nil, ErrEventNotFound
+		}
+		return nil, err
+	}
+
+	err = tx.QueryRowContext(ctx, query, event.Name, event.Description, event.StartsAt, event.EndsAt, event.Timezone, event.Location, event.Capacity, event.Visibility, event.RRule, timestampArray(event.ExDates), seriesEnd, eventId).Scan(event.fields()...)
 
 	if err != nil {
 		tx.Rollback()
 		return nil, err
 	}
+	event.localize()
+
+	// moving the series moves every occurrence's attendance along with it
+	if err = reconcileOccurrences(ctx, tx, event, event.StartsAt.Sub(previousStart)); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	// a raised or removed capacity frees up seats for people on the waitlist
+	if err = promoteAllFromWaitlist(ctx, tx, eventId); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
 
 	if err = tx.Commit(); err != nil {
 		tx.Rollback()
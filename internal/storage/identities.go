@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+)
+
+type IdentityStore struct {
+	db *sql.DB
+}
+
+// Identity links a user to an account at an external identity provider.
+type Identity struct {
+	Provider string
+	Subject  string
+	Email    string
+}
+
+// GetUserByIdentity returns the user linked to the provider's subject.
+func (i *IdentityStore) GetUserByIdentity(ctx context.Context, provider, subject string) (*User, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	query := `SELECT ` + userColumns + ` FROM users WHERE id = (SELECT user_id FROM user_identities WHERE provider = $1 AND subject = $2)`
+
+	user := &User{}
+	if err := i.db.QueryRowContext(ctx, query, provider, subject).Scan(user.fields()...); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (i *IdentityStore) LinkIdentity(ctx context.Context, userId int, identity Identity) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	_, err := i.db.ExecContext(ctx, `INSERT INTO user_identities (user_id, provider, subject, email) VALUES ($1, $2, $3, $4)`, userId, identity.Provider, identity.Subject, identity.Email)
+	return err
+}
+
+// CreateUserWithIdentity creates a user who signed up through an identity
+// provider. The provider verified their email address, and they have no
+// password until they set one through a password reset.
+func (i *IdentityStore) CreateUserWithIdentity(ctx context.Context, user *User, identity Identity) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	tx, err := i.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO users (name, email, password, email_verified_at) VALUES ($1, $2, '', NOW()) RETURNING ` + userColumns
+	if err = tx.QueryRowContext(ctx, query, user.Name, user.Email).Scan(user.fields()...); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	query = `INSERT INTO user_identities (user_id, provider, subject, email) VALUES ($1, $2, $3, $4)`
+	if _, err = tx.ExecContext(ctx, query, user.ID, identity.Provider, identity.Subject, identity.Email); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return nil
+}
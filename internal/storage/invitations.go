@@ -0,0 +1,194 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+type InvitationStore struct {
+	db *sql.DB
+}
+
+// Invitation is an invitation link to an event. The link itself is a signed
+// token; the row tracks how often it has been used and whether it has been
+// revoked. MaxUses is nil for invitations that can be used any number of
+// times.
+type Invitation struct {
+	ID        int        `json:"id"`
+	EventID   int        `json:"event_id"`
+	CreatedBy int        `json:"created_by"`
+	MaxUses   *int       `json:"max_uses"`
+	Uses      int        `json:"uses"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+const invitationColumns = `id, event_id, created_by, max_uses, uses, expires_at, revoked_at, created_at`
+
+func (i *Invitation) fields() []any {
+	return []any{&i.ID, &i.EventID, &i.CreatedBy, &i.MaxUses, &i.Uses, &i.ExpiresAt, &i.RevokedAt, &i.CreatedAt}
+}
+
+// Usable reports whether the invitation can still be accepted.
+func (i *Invitation) Usable(now time.Time) bool {
+	if i.RevokedAt != nil || !now.Before(i.ExpiresAt) {
+		return false
+	}
+	return i.MaxUses == nil || i.Uses < *i.MaxUses
+}
+
+// eventAccessCondition renders the SQL predicate for whether the user may see
+// a private event: anyone with a role on it, invitees and anyone attending or
+// on the waitlist of any of its occurrences.
+func eventAccessCondition(eventId, userId string) string {
+	return fmt.Sprintf(`(EXISTS (SELECT 1 FROM event_roles WHERE event_id = %[1]s AND user_id = %[2]s)
+		OR EXISTS (SELECT 1 FROM event_invitees WHERE event_id = %[1]s AND user_id = %[2]s)
+		OR EXISTS (SELECT 1 FROM attendees WHERE event_id = %[1]s AND user_id = %[2]s)
+		OR EXISTS (SELECT 1 FROM waitlist WHERE event_id = %[1]s AND user_id = %[2]s))`, eventId, userId)
+}
+
+// HasAccess reports whether the user may see the event regardless of its
+// visibility.
+func (i *InvitationStore) HasAccess(ctx context.Context, eventId, userId int) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	var ok bool
+	if err := i.db.QueryRowContext(ctx, `SELECT `+eventAccessCondition("$1", "$2"), eventId, userId).Scan(&ok); err != nil {
+		return false, err
+	}
+	return ok, nil
+}
+
+func (i *InvitationStore) CreateInvitation(ctx context.Context, invitation *Invitation) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	query := `INSERT INTO event_invitations (event_id, created_by, max_uses, expires_at) VALUES ($1, $2, $3, $4) RETURNING ` + invitationColumns
+
+	return i.db.QueryRowContext(ctx, query, invitation.EventID, invitation.CreatedBy, invitation.MaxUses, invitation.ExpiresAt).Scan(invitation.fields()...)
+}
+
+func (i *InvitationStore) GetInvitation(ctx context.Context, eventId, invitationId int) (*Invitation, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	query := `SELECT ` + invitationColumns + ` FROM event_invitations WHERE id = $1 AND event_id = $2`
+
+	invitation := &Invitation{}
+	if err := i.db.QueryRowContext(ctx, query, invitationId, eventId).Scan(invitation.fields()...); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrInvitationNotFound
+		}
+		return nil, err
+	}
+	return invitation, nil
+}
+
+func (i *InvitationStore) GetInvitationsByEvent(ctx context.Context, eventId int) ([]Invitation, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	query := `SELECT ` + invitationColumns + ` FROM event_invitations WHERE event_id = $1 ORDER BY created_at DESC, id DESC`
+
+	invitations := []Invitation{}
+
+	rows, err := i.db.QueryContext(ctx, query, eventId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var invitation Invitation
+		if err = rows.Scan(invitation.fields()...); err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, invitation)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return invitations, nil
+}
+
+func (i *InvitationStore) RevokeInvitation(ctx context.Context, eventId, invitationId int) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	query := `UPDATE event_invitations SET revoked_at = NOW() WHERE id = $1 AND event_id = $2 AND revoked_at IS NULL`
+
+	result, err := i.db.ExecContext(ctx, query, invitationId, eventId)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrInvitationNotFound
+	}
+
+	return nil
+}
+
+// AcceptInvitation makes the user an invitee of the event. Accepting uses up
+// one of the invitation's uses unless the user was already invited.
+func (i *InvitationStore) AcceptInvitation(ctx context.Context, eventId, invitationId, userId int) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	tx, err := i.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	invitation := &Invitation{}
+	query := `SELECT ` + invitationColumns + ` FROM event_invitations WHERE id = $1 AND event_id = $2 FOR UPDATE`
+	if err = tx.QueryRowContext(ctx, query, invitationId, eventId).Scan(invitation.fields()...); err != nil {
+		tx.Rollback()
+		if err == sql.ErrNoRows {
+			return ErrInvitationNotFound
+		}
+		return err
+	}
+
+	if !invitation.Usable(time.Now()) {
+		tx.Rollback()
+		return ErrInvitationUnusable
+	}
+
+	query = `INSERT INTO event_invitees (event_id, user_id, invitation_id) VALUES ($1, $2, $3) ON CONFLICT (event_id, user_id) DO NOTHING`
+	result, err := tx.ExecContext(ctx, query, eventId, userId, invitationId)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if rows > 0 {
+		if _, err = tx.ExecContext(ctx, `UPDATE event_invitations SET uses = uses + 1 WHERE id = $1`, invitationId); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return nil
+}
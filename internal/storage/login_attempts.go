@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// LoginAttemptStore is the Postgres backed store of failed login attempts,
+// used when Redis is not enabled or unavailable.
+type LoginAttemptStore struct {
+	db *sql.DB
+}
+
+// Attempt records an attempt as a failure, starting the count over when the
+// previous failure is older than window, unless the key still has to wait
+// the delay of its failures. Forgotten rows are pruned along the way.
+func (l *LoginAttemptStore) Attempt(ctx context.Context, key string, window time.Duration, delays []time.Duration) (time.Time, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	if _, err := l.db.ExecContext(ctx, `DELETE FROM login_attempts WHERE last_failed_at <= NOW() - $1 * INTERVAL '1 second'`, window.Seconds()); err != nil {
+		return time.Time{}, err
+	}
+
+	tx, err := l.db.BeginTx(ctx, nil)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	// locking the key's row makes concurrent attempts take turns, so each one
+	// sees the failure recorded by the one before
+	if _, err = tx.ExecContext(ctx, `INSERT INTO login_attempts (key, failures, last_failed_at) VALUES ($1, 0, 'epoch') ON CONFLICT (key) DO NOTHING`, key); err != nil {
+		tx.Rollback()
+		return time.Time{}, err
+	}
+
+	var failures int
+	var last time.Time
+	if err = tx.QueryRowContext(ctx, `SELECT failures, last_failed_at FROM login_attempts WHERE key = $1 FOR UPDATE`, key).Scan(&failures, &last); err != nil {
+		tx.Rollback()
+		return time.Time{}, err
+	}
+
+	if time.Since(last) >= window {
+		failures = 0
+	}
+	if until := last.Add(delays[min(failures, len(delays)-1)]); time.Now().Before(until) {
+		tx.Rollback()
+		return until, nil
+	}
+
+	if _, err = tx.ExecContext(ctx, `UPDATE login_attempts SET failures = $2, last_failed_at = NOW() WHERE key = $1`, key, failures+1); err != nil {
+		tx.Rollback()
+		return time.Time{}, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return time.Time{}, err
+	}
+	return time.Time{}, nil
+}
+
+func (l *LoginAttemptStore) Forgive(ctx context.Context, key string) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	_, err := l.db.ExecContext(ctx, `UPDATE login_attempts SET failures = failures - 1 WHERE key = $1 AND failures > 0`, key)
+	return err
+}
+
+func (l *LoginAttemptStore) Reset(ctx context.Context, key string) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	_, err := l.db.ExecContext(ctx, `DELETE FROM login_attempts WHERE key = $1`, key)
+	return err
+}
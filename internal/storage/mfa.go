@@ -0,0 +1,229 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+)
+
+type MFAStore struct {
+	db *sql.DB
+}
+
+// TOTPEnrollment is a user's TOTP secret, still sealed, and whether
+// enrollment was confirmed with a valid code.
+type TOTPEnrollment struct {
+	SealedSecret string
+	Enabled      bool
+}
+
+// StartTOTPEnrollment stores a new, unconfirmed TOTP secret for the user,
+// replacing any earlier unconfirmed one.
+func (m *MFAStore) StartTOTPEnrollment(ctx context.Context, userId int, sealedSecret string) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	query := `UPDATE users SET totp_secret = $1, totp_last_step = NULL WHERE id = $2 AND totp_enabled_at IS NULL`
+
+	result, err := m.db.ExecContext(ctx, query, sealedSecret, userId)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrMFAAlreadyEnabled
+	}
+
+	return nil
+}
+
+func (m *MFAStore) GetTOTPEnrollment(ctx context.Context, userId int) (*TOTPEnrollment, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	var secret sql.NullString
+	enrollment := &TOTPEnrollment{}
+
+	query := `SELECT totp_secret, totp_enabled_at IS NOT NULL FROM users WHERE id = $1`
+	if err := m.db.QueryRowContext(ctx, query, userId).Scan(&secret, &enrollment.Enabled); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	if !secret.Valid {
+		return nil, ErrMFANotEnrolled
+	}
+
+	enrollment.SealedSecret = secret.String
+	return enrollment, nil
+}
+
+// UseTOTPStep records that a code for the time step was accepted. It reports
+// false when a code for this or a later step was already used, so each code
+// works only once.
+func (m *MFAStore) UseTOTPStep(ctx context.Context, userId int, step int64) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	query := `UPDATE users SET totp_last_step = $1 WHERE id = $2 AND (totp_last_step IS NULL OR totp_last_step < $1)`
+
+	result, err := m.db.ExecContext(ctx, query, step, userId)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rows > 0, nil
+}
+
+// EnableTOTP confirms the user's enrollment and replaces their recovery
+// codes with the given hashes.
+func (m *MFAStore) EnableTOTP(ctx context.Context, userId int, recoveryCodeHashes []string) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx, `UPDATE users SET totp_enabled_at = NOW() WHERE id = $1 AND totp_secret IS NOT NULL AND totp_enabled_at IS NULL`, userId)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if rows == 0 {
+		tx.Rollback()
+		return ErrMFAAlreadyEnabled
+	}
+
+	if err = replaceRecoveryCodes(ctx, tx, userId, recoveryCodeHashes); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return nil
+}
+
+func (m *MFAStore) DisableTOTP(ctx context.Context, userId int) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	query := `UPDATE users SET totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = NULL WHERE id = $1`
+	if _, err = tx.ExecContext(ctx, query, userId); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userId); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return nil
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes, used or not.
+func (m *MFAStore) RegenerateRecoveryCodes(ctx context.Context, userId int, codeHashes []string) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err = replaceRecoveryCodes(ctx, tx, userId, codeHashes); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return nil
+}
+
+// UseRecoveryCode spends one of the user's recovery codes.
+func (m *MFAStore) UseRecoveryCode(ctx context.Context, userId int, codeHash string) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	query := `UPDATE mfa_recovery_codes SET used_at = NOW() WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`
+
+	result, err := m.db.ExecContext(ctx, query, userId, codeHash)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrRecoveryCodeInvalid
+	}
+
+	return nil
+}
+
+func (m *MFAStore) CountRecoveryCodes(ctx context.Context, userId int) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	var count int
+	query := `SELECT COUNT(*) FROM mfa_recovery_codes WHERE user_id = $1 AND used_at IS NULL`
+	if err := m.db.QueryRowContext(ctx, query, userId).Scan(&count); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx *sql.Tx, userId int, codeHashes []string) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userId); err != nil {
+		return err
+	}
+
+	for _, hash := range codeHashes {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO mfa_recovery_codes (user_id, code_hash) VALUES ($1, $2)`, userId, hash); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
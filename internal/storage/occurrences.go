@@ -0,0 +1,499 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/puremike/event-mgt-api/internal/rrule"
+)
+
+// Occurrence is a single instance of an event. OccurrenceStart identifies the
+// occurrence of a recurring event by its original start time, which stays the
+// same when the occurrence is moved; it is nil for one-off events.
+type Occurrence struct {
+	Event
+	OccurrenceStart *time.Time `json:"occurrence_start,omitempty"`
+}
+
+// OccurrenceOverride replaces the details of one occurrence of a recurring
+// event.
+type OccurrenceOverride struct {
+	OccurrenceStart time.Time `json:"occurrence_start"`
+	Name            string    `json:"name"`
+	Description     string    `json:"description"`
+	StartsAt        time.Time `json:"starts_at"`
+	EndsAt          time.Time `json:"ends_at"`
+	Location        string    `json:"location"`
+}
+
+func (o *OccurrenceOverride) fields() []any {
+	return []any{&o.OccurrenceStart, &o.Name, &o.Description, &o.StartsAt, &o.EndsAt, &o.Location}
+}
+
+// occurrence returns the instance of the event starting at start, with any
+// override applied.
+func (e *Event) occurrence(start time.Time, override *OccurrenceOverride) Occurrence {
+	o := Occurrence{Event: *e}
+	o.RRule = ""
+	o.ExDates = nil
+
+	if e.Recurring() {
+		o.OccurrenceStart = &start
+		o.StartsAt = start
+		o.EndsAt = start.Add(e.EndsAt.Sub(e.StartsAt))
+	}
+
+	if override != nil {
+		o.Name = override.Name
+		o.Description = override.Description
+		o.StartsAt = override.StartsAt.In(e.StartsAt.Location())
+		o.EndsAt = override.EndsAt.In(e.StartsAt.Location())
+		o.Location = override.Location
+	}
+
+	return o
+}
+
+// GetEventOccurrences expands the events matching the filter into their
+// occurrences within [filter.From, filter.To], both of which are required.
+// Occurrences are ordered by start time and paginated with the same cursors
+// as GetAllEvents; only the date sort is supported.
+func (e *EventStore) GetEventOccurrences(ctx context.Context, filter EventFilter, page PageParams) (*Page[Occurrence], error) {
+	if filter.From == nil || filter.To == nil {
+		return nil, ErrOccurrenceWindowRequired
+	}
+
+	k, err := newKeyset(page, map[string]sortColumn{"date": eventSortColumns["date"]}, "date", "e.id")
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	var args []any
+	query := `SELECT ` + eventColumns + ` FROM events e` + whereClause(filter.conditions(&args))
+
+	rows, err := e.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []Event
+	var recurring []int64
+	for rows.Next() {
+		var event Event
+		if err = rows.Scan(event.fields()...); err != nil {
+			return nil, err
+		}
+		event.localize()
+
+		events = append(events, event)
+		if event.Recurring() {
+			recurring = append(recurring, int64(event.ID))
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	overrides, err := getOccurrenceOverrides(ctx, e.db, recurring)
+	if err != nil {
+		return nil, err
+	}
+
+	occurrences := []Occurrence{}
+	for i := range events {
+		event := &events[i]
+
+		// an occurrence that starts before the window may still run into it
+		starts, err := event.Occurrences(filter.From.Add(-event.EndsAt.Sub(event.StartsAt)), *filter.To)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, start := range starts {
+			o := event.occurrence(start, overrides[occurrenceKey{event.ID, start.Unix()}])
+			if o.EndsAt.Before(*filter.From) || o.StartsAt.After(*filter.To) {
+				continue
+			}
+			occurrences = append(occurrences, o)
+		}
+	}
+
+	less := func(a, b Occurrence) bool {
+		if !a.StartsAt.Equal(b.StartsAt) {
+			return a.StartsAt.Before(b.StartsAt)
+		}
+		return a.ID < b.ID
+	}
+	sort.Slice(occurrences, func(i, j int) bool {
+		if k.params.Desc {
+			return less(occurrences[j], occurrences[i])
+		}
+		return less(occurrences[i], occurrences[j])
+	})
+
+	total := len(occurrences)
+
+	if k.after != nil {
+		after, err := time.Parse(time.RFC3339Nano, k.after.Value)
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		last := Occurrence{Event: Event{ID: k.after.ID, StartsAt: after}}
+
+		skip := sort.Search(len(occurrences), func(i int) bool {
+			if k.params.Desc {
+				return less(occurrences[i], last)
+			}
+			return less(last, occurrences[i])
+		})
+		occurrences = occurrences[skip:]
+	}
+
+	if len(occurrences) > k.params.Limit+1 {
+		occurrences = occurrences[:k.params.Limit+1]
+	}
+
+	key := eventCursorKey("date")
+	occurrences, next := nextCursor(k, occurrences, func(o Occurrence) (string, int) {
+		return key(o.Event)
+	})
+
+	return &Page[Occurrence]{Data: occurrences, NextCursor: next, Total: total}, nil
+}
+
+type occurrenceKey struct {
+	eventID int
+	start   int64
+}
+
+func getOccurrenceOverrides(ctx context.Context, q *sql.DB, eventIds []int64) (map[occurrenceKey]*OccurrenceOverride, error) {
+	overrides := map[occurrenceKey]*OccurrenceOverride{}
+	if len(eventIds) == 0 {
+		return overrides, nil
+	}
+
+	query := `SELECT event_id, occurrence_start, name, description, starts_at, ends_at, location
+				FROM event_occurrence_overrides WHERE event_id = ANY($1)`
+
+	rows, err := q.QueryContext(ctx, query, pq.Int64Array(eventIds))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var eventId int
+		o := &OccurrenceOverride{}
+		if err = rows.Scan(append([]any{&eventId}, o.fields()...)...); err != nil {
+			return nil, err
+		}
+		overrides[occurrenceKey{eventId, o.OccurrenceStart.Unix()}] = o
+	}
+
+	return overrides, rows.Err()
+}
+
+// GetOccurrenceOverrides lists the overridden occurrences of a recurring
+// event in order.
+func (e *EventStore) GetOccurrenceOverrides(ctx context.Context, eventId int) ([]OccurrenceOverride, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	query := `SELECT occurrence_start, name, description, starts_at, ends_at, location
+				FROM event_occurrence_overrides WHERE event_id = $1 ORDER BY occurrence_start`
+
+	var overrides []OccurrenceOverride
+
+	rows, err := e.db.QueryContext(ctx, query, eventId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var o OccurrenceOverride
+		if err = rows.Scan(o.fields()...); err != nil {
+			return nil, err
+		}
+		overrides = append(overrides, o)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return overrides, nil
+}
+
+// SetOccurrenceOverride changes a single occurrence of a recurring event,
+// leaving the rest of the series untouched.
+func (e *EventStore) SetOccurrenceOverride(ctx context.Context, eventId int, override *OccurrenceOverride) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	query := `INSERT INTO event_occurrence_overrides (event_id, occurrence_start, name, description, starts_at, ends_at, location)
+				VALUES ($1, $2, $3, $4, $5, $6, $7)
+				ON CONFLICT (event_id, occurrence_start) DO UPDATE SET name = EXCLUDED.name, description = EXCLUDED.description,
+				starts_at = EXCLUDED.starts_at, ends_at = EXCLUDED.ends_at, location = EXCLUDED.location`
+
+	_, err := e.db.ExecContext(ctx, query, eventId, override.OccurrenceStart, override.Name, override.Description, override.StartsAt, override.EndsAt, override.Location)
+	return err
+}
+
+// CancelOccurrence removes a single occurrence from a recurring event by
+// adding it to the event's EXDATEs, along with its attendees and waitlist.
+func (e *EventStore) CancelOccurrence(ctx context.Context, eventId int, occurrence time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	tx, err := e.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	query := `UPDATE events SET exdates = array_append(exdates, $2::timestamptz) WHERE id = $1 AND NOT ($2::timestamptz = ANY(exdates))`
+	if _, err = tx.ExecContext(ctx, query, eventId, occurrence); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err = deleteOccurrenceRows(ctx, tx, eventId, "occurrence_start = $2", occurrence); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return nil
+}
+
+// EndSeries stops a recurring event before the occurrence starting at "at",
+// removing that occurrence and every later one.
+func (e *EventStore) EndSeries(ctx context.Context, event *Event, at time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	if err := truncateSeries(event, at); err != nil {
+		return err
+	}
+
+	tx, err := e.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err = updateSeries(ctx, tx, event); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err = deleteOccurrenceRows(ctx, tx, event.ID, "occurrence_start >= $2", at); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return nil
+}
+
+// SplitSeries ends the recurring event before the occurrence starting at
+// "at" and continues it as the new event next, for "this and following"
+// edits. Attendees and waitlists of the moved occurrences follow them to the
+// new event, as do the roles on the event; overrides of those occurrences are
+// discarded.
+func (e *EventStore) SplitSeries(ctx context.Context, event *Event, at time.Time, next *Event) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	if err := truncateSeries(event, at); err != nil {
+		return err
+	}
+
+	nextEnd, err := next.seriesEnd()
+	if err != nil {
+		return err
+	}
+
+	tx, err := e.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err = updateSeries(ctx, tx, event); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	query := `INSERT INTO events AS e (owner_id, name, description, starts_at, ends_at, timezone, location, capacity, visibility, rrule, exdates, series_ends_at)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NULLIF($10, ''), $11::timestamptz[], $12) RETURNING ` + eventColumns
+
+	err = tx.QueryRowContext(ctx, query, next.OwnerID, next.Name, next.Description, next.StartsAt, next.EndsAt, next.Timezone, next.Location, next.Capacity, next.Visibility, next.RRule, timestampArray(next.ExDates), nextEnd).Scan(next.fields()...)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	next.localize()
+
+	// the rest of the series is managed by the same people
+	query = `INSERT INTO event_roles (event_id, user_id, role, granted_by) SELECT $1, user_id, role, granted_by FROM event_roles WHERE event_id = $2`
+	if _, err = tx.ExecContext(ctx, query, next.ID, event.ID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx, `DELETE FROM event_occurrence_overrides WHERE event_id = $1 AND occurrence_start >= $2`, event.ID, at); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	shift := next.StartsAt.Sub(at).Microseconds()
+	for _, table := range []string{"attendees", "waitlist"} {
+		query := `UPDATE ` + table + ` SET event_id = $3, occurrence_start = occurrence_start + $4 * INTERVAL '1 microsecond'
+					WHERE event_id = $1 AND occurrence_start >= $2`
+		if _, err = tx.ExecContext(ctx, query, event.ID, at, next.ID, shift); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	if err = reconcileOccurrences(ctx, tx, next, 0); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err = promoteAllFromWaitlist(ctx, tx, next.ID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return nil
+}
+
+// truncateSeries rewrites the event's rule so that the series ends before the
+// occurrence starting at "at", which must not be the first one.
+func truncateSeries(event *Event, at time.Time) error {
+	rule, err := rrule.Parse(event.RRule)
+	if err != nil {
+		return err
+	}
+
+	head, _ := rule.Split(event.StartsAt, at)
+	event.RRule = head.String()
+
+	var exdates []time.Time
+	for _, t := range event.ExDates {
+		if t.Before(at) {
+			exdates = append(exdates, t)
+		}
+	}
+	event.ExDates = exdates
+
+	return nil
+}
+
+func updateSeries(ctx context.Context, tx *sql.Tx, event *Event) error {
+	seriesEnd, err := event.seriesEnd()
+	if err != nil {
+		return err
+	}
+
+	query := `UPDATE events SET rrule = $1, exdates = $2::timestamptz[], series_ends_at = $3 WHERE id = $4`
+	_, err = tx.ExecContext(ctx, query, event.RRule, timestampArray(event.ExDates), seriesEnd, event.ID)
+	return err
+}
+
+// deleteOccurrenceRows removes the attendees, waitlist entries and overrides
+// of the occurrences matching cond, whose arguments start at $2.
+func deleteOccurrenceRows(ctx context.Context, tx *sql.Tx, eventId int, cond string, args ...any) error {
+	for _, table := range []string{"attendees", "waitlist", "event_occurrence_overrides"} {
+		query := `DELETE FROM ` + table + ` WHERE event_id = $1 AND ` + cond
+		if _, err := tx.ExecContext(ctx, query, append([]any{eventId}, args...)...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reconcileOccurrences keeps attendance in line with the event's schedule
+// after it changes. Occurrences are moved by shift when the whole series
+// moves, attendance of a one-off event carries over to the first occurrence
+// when it becomes recurring (and back), and whatever belongs to an occurrence
+// that no longer exists is dropped.
+func reconcileOccurrences(ctx context.Context, tx *sql.Tx, event *Event, shift time.Duration) error {
+	tables := []string{"attendees", "waitlist", "event_occurrence_overrides"}
+
+	if shift != 0 {
+		for _, table := range tables {
+			query := `UPDATE ` + table + ` SET occurrence_start = occurrence_start + $2 * INTERVAL '1 microsecond' WHERE event_id = $1`
+			if _, err := tx.ExecContext(ctx, query, event.ID, shift.Microseconds()); err != nil {
+				return err
+			}
+		}
+	}
+
+	if !event.Recurring() {
+		for _, table := range tables[:2] {
+			query := `UPDATE ` + table + ` SET occurrence_start = NULL WHERE event_id = $1 AND occurrence_start = $2`
+			if _, err := tx.ExecContext(ctx, query, event.ID, event.StartsAt); err != nil {
+				return err
+			}
+		}
+		return deleteOccurrenceRows(ctx, tx, event.ID, "occurrence_start IS NOT NULL")
+	}
+
+	for _, table := range tables[:2] {
+		query := `UPDATE ` + table + ` SET occurrence_start = $2 WHERE event_id = $1 AND occurrence_start IS NULL`
+		if _, err := tx.ExecContext(ctx, query, event.ID, event.StartsAt); err != nil {
+			return err
+		}
+	}
+
+	query := `SELECT occurrence_start FROM attendees WHERE event_id = $1
+				UNION SELECT occurrence_start FROM waitlist WHERE event_id = $1
+				UNION SELECT occurrence_start FROM event_occurrence_overrides WHERE event_id = $1`
+
+	rows, err := tx.QueryContext(ctx, query, event.ID)
+	if err != nil {
+		return err
+	}
+
+	var stale []time.Time
+	for rows.Next() {
+		var start time.Time
+		if err = rows.Scan(&start); err != nil {
+			rows.Close()
+			return err
+		}
+		if !event.HasOccurrence(start) {
+			stale = append(stale, start)
+		}
+	}
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if len(stale) == 0 {
+		return nil
+	}
+	return deleteOccurrenceRows(ctx, tx, event.ID, "occurrence_start = ANY($2::timestamptz[])", timestampArray(stale))
+}
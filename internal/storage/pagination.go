@@ -0,0 +1,173 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const (
+	DefaultPageLimit = 20
+	MaxPageLimit     = 100
+)
+
+// PageParams controls sorting and keyset pagination of a list query. Cursor is
+// the opaque NextCursor value returned with the previous page.
+type PageParams struct {
+	Sort   string
+	Desc   bool
+	Cursor string
+	Limit  int
+}
+
+type Page[T any] struct {
+	Data       []T    `json:"data"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	Total      int    `json:"total"`
+}
+
+// cursor marks the last row of a page. It carries the sort it was issued for
+// so that it cannot be replayed against a differently ordered list.
+type cursor struct {
+	Sort  string `json:"s"`
+	Desc  bool   `json:"d"`
+	Value string `json:"v,omitempty"`
+	ID    int    `json:"id"`
+}
+
+func (c cursor) encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string) (*cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var c cursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+// sortColumn maps a public sort key to the SQL expression it orders by. Cast
+// is applied to the cursor value when comparing against it.
+type sortColumn struct {
+	expr string
+	cast string
+}
+
+// keyset is a resolved PageParams ready to be rendered into SQL.
+type keyset struct {
+	params PageParams
+	column sortColumn
+	idExpr string
+	after  *cursor
+}
+
+func newKeyset(p PageParams, columns map[string]sortColumn, defaultSort, idExpr string) (*keyset, error) {
+	if p.Sort == "" {
+		p.Sort = defaultSort
+	}
+
+	column, ok := columns[p.Sort]
+	if !ok {
+		return nil, ErrInvalidSort
+	}
+
+	if p.Limit <= 0 {
+		p.Limit = DefaultPageLimit
+	}
+	if p.Limit > MaxPageLimit {
+		p.Limit = MaxPageLimit
+	}
+
+	k := &keyset{params: p, column: column, idExpr: idExpr}
+
+	if p.Cursor != "" {
+		c, err := decodeCursor(p.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		if c.Sort != p.Sort || c.Desc != p.Desc {
+			return nil, ErrInvalidCursor
+		}
+		k.after = c
+	}
+
+	return k, nil
+}
+
+// condition returns the predicate that skips rows up to and including the
+// cursor, appending its arguments to args. It is empty on the first page.
+func (k *keyset) condition(args *[]any) string {
+	if k.after == nil {
+		return ""
+	}
+
+	op := ">"
+	if k.params.Desc {
+		op = "<"
+	}
+
+	if k.column.expr == k.idExpr {
+		*args = append(*args, k.after.ID)
+		return fmt.Sprintf("%s %s $%d", k.idExpr, op, len(*args))
+	}
+
+	*args = append(*args, k.after.Value, k.after.ID)
+	return fmt.Sprintf("(%s, %s) %s ($%d%s, $%d)", k.column.expr, k.idExpr, op, len(*args)-1, k.column.cast, len(*args))
+}
+
+// orderAndLimit renders the ORDER BY and LIMIT clauses. One extra row is
+// fetched to find out whether another page follows.
+func (k *keyset) orderAndLimit() string {
+	dir := "ASC"
+	if k.params.Desc {
+		dir = "DESC"
+	}
+
+	if k.column.expr == k.idExpr {
+		return fmt.Sprintf(" ORDER BY %s %s LIMIT %d", k.idExpr, dir, k.params.Limit+1)
+	}
+	return fmt.Sprintf(" ORDER BY %s %s, %s %s LIMIT %d", k.column.expr, dir, k.idExpr, dir, k.params.Limit+1)
+}
+
+// nextCursor trims the extra row fetched by orderAndLimit and, when there was
+// one, returns the cursor pointing at the last row that is kept.
+func nextCursor[T any](k *keyset, rows []T, key func(T) (string, int)) ([]T, string) {
+	if len(rows) <= k.params.Limit {
+		return rows, ""
+	}
+
+	rows = rows[:k.params.Limit]
+	value, id := key(rows[len(rows)-1])
+
+	return rows, cursor{Sort: k.params.Sort, Desc: k.params.Desc, Value: value, ID: id}.encode()
+}
+
+func whereClause(conditions []string) string {
+	if len(conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(conditions, " AND ")
+}
+
+func countRows(ctx context.Context, db *sql.DB, query string, args []any) (int, error) {
+	var total int
+	if err := db.QueryRowContext(ctx, query, args...).Scan(&total); err != nil {
+		return 0, err
+	}
+	return total, nil
+}
+
+// escapeLike escapes the LIKE wildcards in s so it is matched literally.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,228 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+type RefreshTokenStore struct {
+	db *sql.DB
+}
+
+// RefreshToken is one link in a chain of rotated refresh tokens. Each login
+// starts a new family; refreshing uses up the presented token and issues the
+// next one in the same family. Only the hash of the token is stored.
+type RefreshToken struct {
+	ID              int
+	UserID          int
+	FamilyID        string
+	TokenHash       string
+	AccessJTI       string
+	AccessExpiresAt time.Time
+	ExpiresAt       time.Time
+	UsedAt          *time.Time
+	RevokedAt       *time.Time
+	CreatedAt       time.Time
+}
+
+const refreshTokenColumns = `id, user_id, family_id, token_hash, access_jti, access_expires_at, expires_at, used_at, revoked_at, created_at`
+
+func (t *RefreshToken) fields() []any {
+	return []any{&t.ID, &t.UserID, &t.FamilyID, &t.TokenHash, &t.AccessJTI, &t.AccessExpiresAt, &t.ExpiresAt, &t.UsedAt, &t.RevokedAt, &t.CreatedAt}
+}
+
+// AccessTokenRef identifies an access token that may still be in use.
+type AccessTokenRef struct {
+	JTI       string
+	ExpiresAt time.Time
+}
+
+func (r *RefreshTokenStore) CreateRefreshToken(ctx context.Context, token *RefreshToken) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	return insertRefreshToken(ctx, r.db.QueryRowContext, token)
+}
+
+func insertRefreshToken(ctx context.Context, queryRow func(context.Context, string, ...any) *sql.Row, token *RefreshToken) error {
+	query := `INSERT INTO refresh_tokens (user_id, family_id, token_hash, access_jti, access_expires_at, expires_at)
+				VALUES ($1, $2, $3, $4, $5, $6) RETURNING ` + refreshTokenColumns
+
+	return queryRow(ctx, query, token.UserID, token.FamilyID, token.TokenHash, token.AccessJTI, token.AccessExpiresAt, token.ExpiresAt).Scan(token.fields()...)
+}
+
+// RotateRefreshToken uses up the refresh token with the given hash and stores
+// next as its successor in the same family, filling in next's user and
+// family. Presenting a token that was already used means it was copied, so
+// ErrRefreshTokenReused is returned with next's user and family filled in for
+// the caller to revoke the family.
+func (r *RefreshTokenStore) RotateRefreshToken(ctx context.Context, tokenHash string, next *RefreshToken) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	current := &RefreshToken{}
+	query := `SELECT ` + refreshTokenColumns + ` FROM refresh_tokens WHERE token_hash = $1 FOR UPDATE`
+	if err = tx.QueryRowContext(ctx, query, tokenHash).Scan(current.fields()...); err != nil {
+		tx.Rollback()
+		if err == sql.ErrNoRows {
+			return ErrRefreshTokenNotFound
+		}
+		return err
+	}
+
+	next.UserID = current.UserID
+	next.FamilyID = current.FamilyID
+
+	switch {
+	case current.RevokedAt != nil || !time.Now().Before(current.ExpiresAt):
+		tx.Rollback()
+		return ErrRefreshTokenNotFound
+	case current.UsedAt != nil:
+		tx.Rollback()
+		return ErrRefreshTokenReused
+	}
+
+	if _, err = tx.ExecContext(ctx, `UPDATE refresh_tokens SET used_at = NOW() WHERE id = $1`, current.ID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err = insertRefreshToken(ctx, tx.QueryRowContext, next); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return nil
+}
+
+// RevokeFamily revokes every refresh token of a login and returns the access
+// tokens issued with them that have not expired yet.
+func (r *RefreshTokenStore) RevokeFamily(ctx context.Context, familyId string) ([]AccessTokenRef, error) {
+	return r.revoke(ctx, `family_id = $1`, familyId)
+}
+
+// RevokeUserTokens logs the user out of every session.
+func (r *RefreshTokenStore) RevokeUserTokens(ctx context.Context, userId int) ([]AccessTokenRef, error) {
+	return r.revoke(ctx, `user_id = $1`, userId)
+}
+
+// RevokeOtherUserTokens logs the user out of every session but the one with
+// the given family.
+func (r *RefreshTokenStore) RevokeOtherUserTokens(ctx context.Context, userId int, keepFamilyId string) ([]AccessTokenRef, error) {
+	return r.revoke(ctx, `user_id = $1 AND family_id <> $2`, userId, keepFamilyId)
+}
+
+func (r *RefreshTokenStore) revoke(ctx context.Context, cond string, args ...any) ([]AccessTokenRef, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = tx.ExecContext(ctx, `UPDATE refresh_tokens SET revoked_at = NOW() WHERE revoked_at IS NULL AND `+cond, args...); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	refs := []AccessTokenRef{}
+
+	rows, err := tx.QueryContext(ctx, `SELECT access_jti, access_expires_at FROM refresh_tokens WHERE access_expires_at > NOW() AND `+cond, args...)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	for rows.Next() {
+		var ref AccessTokenRef
+		if err = rows.Scan(&ref.JTI, &ref.ExpiresAt); err != nil {
+			rows.Close()
+			tx.Rollback()
+			return nil, err
+		}
+		refs = append(refs, ref)
+	}
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	return refs, nil
+}
+
+// RevokedTokenStore is the Postgres backed access token denylist, used when
+// Redis is not enabled and behind it otherwise.
+type RevokedTokenStore struct {
+	db *sql.DB
+}
+
+// Deny revokes the access token until it expires. Expired entries are pruned
+// along the way since they can no longer be presented.
+func (r *RevokedTokenStore) Deny(ctx context.Context, jti string, expiresAt time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM revoked_access_tokens WHERE expires_at <= NOW()`); err != nil {
+		return err
+	}
+
+	query := `INSERT INTO revoked_access_tokens (jti, expires_at) VALUES ($1, $2) ON CONFLICT (jti) DO NOTHING`
+	_, err := r.db.ExecContext(ctx, query, jti, expiresAt)
+	return err
+}
+
+func (r *RevokedTokenStore) Denied(ctx context.Context, jti string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	var denied bool
+	if err := r.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM revoked_access_tokens WHERE jti = $1)`, jti).Scan(&denied); err != nil {
+		return false, err
+	}
+	return denied, nil
+}
+
+// GetRevokedTokens lists the revoked access tokens that have not expired yet.
+func (r *RevokedTokenStore) GetRevokedTokens(ctx context.Context) ([]AccessTokenRef, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	refs := []AccessTokenRef{}
+
+	rows, err := r.db.QueryContext(ctx, `SELECT jti, expires_at FROM revoked_access_tokens WHERE expires_at > NOW()`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var ref AccessTokenRef
+		if err = rows.Scan(&ref.JTI, &ref.ExpiresAt); err != nil {
+			return nil, err
+		}
+		refs = append(refs, ref)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return refs, nil
+}
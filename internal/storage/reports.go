@@ -0,0 +1,154 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+type ReportStore struct {
+	db *sql.DB
+}
+
+// ReportTarget is the kind of thing a report is about.
+type ReportTarget string
+
+const (
+	ReportTargetEvent ReportTarget = "event"
+	ReportTargetUser  ReportTarget = "user"
+)
+
+type ReportStatus string
+
+const (
+	ReportStatusOpen      ReportStatus = "open"
+	ReportStatusResolved  ReportStatus = "resolved"
+	ReportStatusDismissed ReportStatus = "dismissed"
+)
+
+// Report is a user's complaint about an event or another user, reviewed by
+// moderators. ReporterID is nil once the reporter's account is deleted.
+type Report struct {
+	ID         int          `json:"id"`
+	ReporterID *int         `json:"reporter_id"`
+	TargetType ReportTarget `json:"target_type"`
+	TargetID   int          `json:"target_id"`
+	Reason     string       `json:"reason"`
+	Status     ReportStatus `json:"status"`
+	ResolvedBy *int         `json:"resolved_by,omitempty"`
+	ResolvedAt *time.Time   `json:"resolved_at,omitempty"`
+	CreatedAt  time.Time    `json:"created_at"`
+}
+
+const reportColumns = `id, reporter_id, target_type, target_id, reason, status, resolved_by, resolved_at, created_at`
+
+func (r *Report) fields() []any {
+	return []any{&r.ID, &r.ReporterID, &r.TargetType, &r.TargetID, &r.Reason, &r.Status, &r.ResolvedBy, &r.ResolvedAt, &r.CreatedAt}
+}
+
+type ReportFilter struct {
+	Status     ReportStatus
+	TargetType ReportTarget
+}
+
+func (f ReportFilter) conditions(args *[]any) []string {
+	var conditions []string
+
+	if f.Status != "" {
+		*args = append(*args, f.Status)
+		conditions = append(conditions, fmt.Sprintf("status = $%d", len(*args)))
+	}
+	if f.TargetType != "" {
+		*args = append(*args, f.TargetType)
+		conditions = append(conditions, fmt.Sprintf("target_type = $%d", len(*args)))
+	}
+
+	return conditions
+}
+
+var reportSortColumns = map[string]sortColumn{
+	"created_at": {expr: "created_at", cast: "::timestamptz"},
+	"id":         {expr: "id"},
+}
+
+func (r *ReportStore) CreateReport(ctx context.Context, report *Report) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	query := `INSERT INTO reports (reporter_id, target_type, target_id, reason) VALUES ($1, $2, $3, $4) RETURNING ` + reportColumns
+
+	return r.db.QueryRowContext(ctx, query, report.ReporterID, report.TargetType, report.TargetID, report.Reason).Scan(report.fields()...)
+}
+
+func (r *ReportStore) GetReports(ctx context.Context, filter ReportFilter, page PageParams) (*Page[Report], error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	k, err := newKeyset(page, reportSortColumns, "created_at", "id")
+	if err != nil {
+		return nil, err
+	}
+
+	var args []any
+	conditions := filter.conditions(&args)
+
+	total, err := countRows(ctx, r.db, `SELECT COUNT(*) FROM reports`+whereClause(conditions), args)
+	if err != nil {
+		return nil, err
+	}
+
+	if cond := k.condition(&args); cond != "" {
+		conditions = append(conditions, cond)
+	}
+
+	query := `SELECT ` + reportColumns + ` FROM reports` + whereClause(conditions) + k.orderAndLimit()
+
+	reports := []Report{}
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var report Report
+		if err = rows.Scan(report.fields()...); err != nil {
+			return nil, err
+		}
+		reports = append(reports, report)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	reports, next := nextCursor(k, reports, func(report Report) (string, int) {
+		if k.params.Sort == "created_at" {
+			return report.CreatedAt.Format(time.RFC3339Nano), report.ID
+		}
+		return "", report.ID
+	})
+
+	return &Page[Report]{Data: reports, NextCursor: next, Total: total}, nil
+}
+
+// ResolveReport closes the report as resolved or dismissed, or reopens it.
+func (r *ReportStore) ResolveReport(ctx context.Context, reportId int, status ReportStatus, resolvedBy int) (*Report, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	query := `UPDATE reports SET status = $1,
+				resolved_by = CASE WHEN $1 = 'open' THEN NULL ELSE $2::integer END,
+				resolved_at = CASE WHEN $1 = 'open' THEN NULL ELSE NOW() END
+				WHERE id = $3 RETURNING ` + reportColumns
+
+	report := &Report{}
+	if err := r.db.QueryRowContext(ctx, query, status, resolvedBy, reportId).Scan(report.fields()...); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrReportNotFound
+		}
+		return nil, err
+	}
+	return report, nil
+}
@@ -0,0 +1,215 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+type EventRoleStore struct {
+	db *sql.DB
+}
+
+// EventRole is what a user may do with an event. Every event has exactly one
+// owner, who is also its OwnerID.
+type EventRole string
+
+const (
+	RoleOwner        EventRole = "owner"
+	RoleCoOrganizer  EventRole = "co_organizer"
+	RoleCheckInStaff EventRole = "check_in_staff"
+	RoleViewer       EventRole = "viewer"
+)
+
+// Permission is an action on an event that is granted through a role.
+type Permission int
+
+const (
+	// PermView lets the user see the event and its attendees even when it is
+	// private.
+	PermView Permission = iota
+	PermEdit
+	PermDelete
+	PermManageAttendees
+	PermManageInvitations
+	PermViewRoles
+	PermManageRoles
+	PermTransferOwnership
+)
+
+var rolePermissions = map[EventRole][]Permission{
+	RoleOwner:        {PermView, PermEdit, PermDelete, PermManageAttendees, PermManageInvitations, PermViewRoles, PermManageRoles, PermTransferOwnership},
+	RoleCoOrganizer:  {PermView, PermEdit, PermManageAttendees, PermManageInvitations, PermViewRoles},
+	RoleCheckInStaff: {PermView, PermManageAttendees},
+	RoleViewer:       {PermView},
+}
+
+// Can reports whether the role grants the permission.
+func (r EventRole) Can(p Permission) bool {
+	for _, granted := range rolePermissions[r] {
+		if granted == p {
+			return true
+		}
+	}
+	return false
+}
+
+// EventRoleGrant is a user's role on an event.
+type EventRoleGrant struct {
+	UserID    int       `json:"user_id"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	Role      EventRole `json:"role"`
+	GrantedBy *int      `json:"granted_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (r *EventRoleStore) GetRole(ctx context.Context, eventId, userId int) (EventRole, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	var role EventRole
+	err := r.db.QueryRowContext(ctx, `SELECT role FROM event_roles WHERE event_id = $1 AND user_id = $2`, eventId, userId).Scan(&role)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", ErrEventRoleNotFound
+		}
+		return "", err
+	}
+	return role, nil
+}
+
+func (r *EventRoleStore) GetRolesByEvent(ctx context.Context, eventId int) ([]EventRoleGrant, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	query := `SELECT u.id, u.name, u.email, r.role, r.granted_by, r.created_at FROM event_roles r
+				JOIN users u ON u.id = r.user_id WHERE r.event_id = $1
+				ORDER BY CASE r.role WHEN 'owner' THEN 0 WHEN 'co_organizer' THEN 1 WHEN 'check_in_staff' THEN 2 ELSE 3 END, u.name, u.id`
+
+	grants := []EventRoleGrant{}
+
+	rows, err := r.db.QueryContext(ctx, query, eventId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var g EventRoleGrant
+		if err = rows.Scan(&g.UserID, &g.Name, &g.Email, &g.Role, &g.GrantedBy, &g.CreatedAt); err != nil {
+			return nil, err
+		}
+		grants = append(grants, g)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return grants, nil
+}
+
+// SetRole grants the user a role on the event, replacing any role they had.
+// Ownership is only changed through TransferOwnership, so neither granting
+// the owner role nor changing the owner's role is allowed.
+func (r *EventRoleStore) SetRole(ctx context.Context, eventId, userId int, role EventRole, grantedBy int) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	if role == RoleOwner {
+		return ErrOwnerRoleImmutable
+	}
+
+	query := `INSERT INTO event_roles (event_id, user_id, role, granted_by) VALUES ($1, $2, $3, $4)
+				ON CONFLICT (event_id, user_id) DO UPDATE SET role = EXCLUDED.role, granted_by = EXCLUDED.granted_by, created_at = NOW()
+				WHERE event_roles.role <> 'owner'`
+
+	result, err := r.db.ExecContext(ctx, query, eventId, userId, role, grantedBy)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrOwnerRoleImmutable
+	}
+
+	return nil
+}
+
+func (r *EventRoleStore) DeleteRole(ctx context.Context, eventId, userId int) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	var role EventRole
+	err := r.db.QueryRowContext(ctx, `DELETE FROM event_roles WHERE event_id = $1 AND user_id = $2 AND role <> 'owner' RETURNING role`, eventId, userId).Scan(&role)
+	if err == sql.ErrNoRows {
+		// either there is no such role or it is the owner's
+		if _, err := r.GetRole(ctx, eventId, userId); err == nil {
+			return ErrOwnerRoleImmutable
+		}
+		return ErrEventRoleNotFound
+	}
+	return err
+}
+
+// TransferOwnership makes another user the owner of the event. The previous
+// owner stays on as a co-organizer.
+func (r *EventRoleStore) TransferOwnership(ctx context.Context, eventId, newOwnerId int) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	var previousOwnerId int
+	err = tx.QueryRowContext(ctx, `SELECT owner_id FROM events WHERE id = $1 FOR UPDATE`, eventId).Scan(&previousOwnerId)
+	if err != nil {
+		tx.Rollback()
+		if err == sql.ErrNoRows {
+			return ErrEventNotFound
+		}
+		return err
+	}
+
+	if previousOwnerId == newOwnerId {
+		tx.Rollback()
+		return nil
+	}
+
+	if _, err = tx.ExecContext(ctx, `UPDATE event_roles SET role = 'co_organizer' WHERE event_id = $1 AND user_id = $2`, eventId, previousOwnerId); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	query := `INSERT INTO event_roles (event_id, user_id, role, granted_by) VALUES ($1, $2, 'owner', $3)
+				ON CONFLICT (event_id, user_id) DO UPDATE SET role = 'owner', granted_by = EXCLUDED.granted_by, created_at = NOW()`
+	if _, err = tx.ExecContext(ctx, query, eventId, newOwnerId, previousOwnerId); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx, `UPDATE events SET owner_id = $1 WHERE id = $2`, newOwnerId, eventId); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return nil
+}
+
+// grantOwnerRole records the owner of a newly created event.
+func grantOwnerRole(ctx context.Context, tx *sql.Tx, eventId, ownerId int) error {
+	_, err := tx.ExecContext(ctx, `INSERT INTO event_roles (event_id, user_id, role) VALUES ($1, $2, 'owner')`, eventId, ownerId)
+	return err
+}
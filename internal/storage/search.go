@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"context"
+	"html"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// EventSearchResult is an event matched by SearchEvents. NameHighlight and
+// Snippet are HTML: the event's own text is escaped, and only the matched
+// terms are wrapped in <mark> tags.
+type EventSearchResult struct {
+	Event
+	Rank          float64 `json:"rank"`
+	NameHighlight string  `json:"name_highlight"`
+	Snippet       string  `json:"snippet"`
+}
+
+// SearchEvents ranks events against q across name, description and location.
+// Every term is matched as a prefix so partially typed words still match,
+// which makes the query usable for autocomplete.
+func (e *EventStore) SearchEvents(ctx context.Context, q string, filter EventFilter, limit int) (*Page[EventSearchResult], error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	tsquery := prefixTSQuery(q)
+	if tsquery == "" {
+		return nil, ErrEmptySearchQuery
+	}
+
+	if limit <= 0 {
+		limit = DefaultPageLimit
+	}
+	if limit > MaxPageLimit {
+		limit = MaxPageLimit
+	}
+
+	args := []any{tsquery}
+	conditions := append([]string{"e.search @@ q"}, filter.conditions(&args)...)
+	from := ` FROM events e, to_tsquery('english', $1) q`
+
+	total, err := countRows(ctx, e.db, `SELECT COUNT(*)`+from+whereClause(conditions), args)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `SELECT ` + eventColumns + `,
+				ts_rank_cd(e.search, q) AS rank,
+				ts_headline('english', e.name, q, 'StartSel=` + highlightStart + `, StopSel=` + highlightStop + `, HighlightAll=true'),
+				ts_headline('english', e.description, q, 'StartSel=` + highlightStart + `, StopSel=` + highlightStop + `, MaxWords=35, MinWords=15, MaxFragments=2')` +
+		from + whereClause(conditions) + ` ORDER BY rank DESC, e.id LIMIT ` + strconv.Itoa(limit)
+
+	results := []EventSearchResult{}
+
+	rows, err := e.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var r EventSearchResult
+		if err = rows.Scan(append(r.fields(), &r.Rank, &r.NameHighlight, &r.Snippet)...); err != nil {
+			return nil, err
+		}
+		r.localize()
+		r.NameHighlight, r.Snippet = highlightHTML(r.NameHighlight), highlightHTML(r.Snippet)
+
+		results = append(results, r)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return &Page[EventSearchResult]{Data: results, Total: total}, nil
+}
+
+// ts_headline marks the matched terms with these private use characters
+// instead of tags, so that the text around them can be escaped before the
+// marks are turned into tags.
+const (
+	highlightStart = "\ue000"
+	highlightStop  = "\ue001"
+)
+
+// highlightHTML escapes the text returned by ts_headline and turns its marks
+// into <mark> tags. Should an event's own text contain the marks, they only
+// turn into stray tags.
+func highlightHTML(s string) string {
+	return strings.NewReplacer(highlightStart, "<mark>", highlightStop, "</mark>").Replace(html.EscapeString(s))
+}
+
+// prefixTSQuery turns free text into a tsquery that ANDs every word as a
+// prefix match, e.g. "go meet" becomes "go:* & meet:*". Everything that is
+// not a letter or digit is treated as a separator, so user input can never
+// inject tsquery operators.
+func prefixTSQuery(q string) string {
+	words := strings.FieldsFunc(q, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	for i, w := range words {
+		words[i] = strings.ToLower(w) + ":*"
+	}
+
+	return strings.Join(words, " & ")
+}
@@ -4,19 +4,45 @@ import (
 	"database/sql"
 	"errors"
 	"time"
+
+	"github.com/lib/pq"
 )
 
 type Storage struct {
-	Users     UserStore
-	Events    EventStore
-	Attendees AttendeeStore
+	Users         UserStore
+	Events        EventStore
+	Attendees     AttendeeStore
+	Waitlist      WaitlistStore
+	Calendar      CalendarFeedStore
+	Invitations   InvitationStore
+	Roles         EventRoleStore
+	Reports       ReportStore
+	RefreshTokens RefreshTokenStore
+	RevokedTokens RevokedTokenStore
+	UserTokens    UserTokenStore
+	LoginAttempts LoginAttemptStore
+	MFA           MFAStore
+	APIKeys       APIKeyStore
+	Identities    IdentityStore
 }
 
 func NewStorage(db *sql.DB) *Storage {
 	return &Storage{
-		Users:     UserStore{db},
-		Events:    EventStore{db},
-		Attendees: AttendeeStore{db},
+		Users:         UserStore{db},
+		Events:        EventStore{db},
+		Attendees:     AttendeeStore{db},
+		Waitlist:      WaitlistStore{db},
+		Calendar:      CalendarFeedStore{db},
+		Invitations:   InvitationStore{db},
+		Roles:         EventRoleStore{db},
+		Reports:       ReportStore{db},
+		RefreshTokens: RefreshTokenStore{db},
+		RevokedTokens: RevokedTokenStore{db},
+		UserTokens:    UserTokenStore{db},
+		LoginAttempts: LoginAttemptStore{db},
+		MFA:           MFAStore{db},
+		APIKeys:       APIKeyStore{db},
+		Identities:    IdentityStore{db},
 	}
 }
 
@@ -25,4 +51,33 @@ var (
 	ErrEventNotFound     = errors.New("event not found")
 	ErrUserNotFound      = errors.New("user not found")
 	ErrAttendeeNotFound  = errors.New("attendee not found")
+
+	ErrWaitlistEntryNotFound = errors.New("waitlist entry not found")
+	ErrInvalidCursor         = errors.New("invalid cursor")
+	ErrInvalidSort           = errors.New("invalid sort field")
+	ErrEmptySearchQuery      = errors.New("empty search query")
+	ErrFeedTokenNotFound     = errors.New("calendar feed token not found")
+
+	ErrOccurrenceWindowRequired = errors.New("occurrence expansion requires a from and to date")
+	ErrInvitationNotFound       = errors.New("invitation not found")
+	ErrInvitationUnusable       = errors.New("invitation is expired, revoked or used up")
+	ErrEventRoleNotFound        = errors.New("event role not found")
+	ErrOwnerRoleImmutable       = errors.New("the owner role can only change through an ownership transfer")
+	ErrReportNotFound           = errors.New("report not found")
+	ErrRefreshTokenNotFound     = errors.New("refresh token not found")
+	ErrRefreshTokenReused       = errors.New("refresh token already used")
+	ErrUserTokenInvalid         = errors.New("token is invalid, expired or already used")
+	ErrTokenRequestedTooSoon    = errors.New("a token was issued too recently")
+	ErrMFAAlreadyEnabled        = errors.New("two-factor authentication is already enabled")
+	ErrMFANotEnrolled           = errors.New("two-factor authentication is not set up")
+	ErrRecoveryCodeInvalid      = errors.New("recovery code is invalid or already used")
+	ErrAPIKeyNotFound           = errors.New("API key not found")
+	ErrEmailTaken               = errors.New("email address is already in use")
 )
+
+// isUniqueViolation reports whether err is a Postgres unique constraint
+// violation.
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
@@ -0,0 +1,245 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+type UserTokenStore struct {
+	db *sql.DB
+}
+
+// TokenPurpose is what a single-use user token can be redeemed for.
+type TokenPurpose string
+
+const (
+	TokenPasswordReset     TokenPurpose = "password_reset"
+	TokenEmailVerification TokenPurpose = "email_verification"
+	TokenMagicLink         TokenPurpose = "magic_link"
+	TokenEmailChange       TokenPurpose = "email_change"
+)
+
+// CreateToken stores the hash of a new single-use token for the user,
+// replacing any unused token they had for the same purpose.
+func (t *UserTokenStore) CreateToken(ctx context.Context, userId int, purpose TokenPurpose, tokenHash string, expiresAt time.Time) error {
+	return t.createToken(ctx, userId, purpose, tokenHash, expiresAt, 0)
+}
+
+// CreateTokenUnlessRecent is CreateToken for tokens that are issued at most
+// once every interval. It returns ErrTokenRequestedTooSoon when the user was
+// issued one for the purpose less than interval ago.
+func (t *UserTokenStore) CreateTokenUnlessRecent(ctx context.Context, userId int, purpose TokenPurpose, tokenHash string, expiresAt time.Time, interval time.Duration) error {
+	return t.createToken(ctx, userId, purpose, tokenHash, expiresAt, interval)
+}
+
+func (t *UserTokenStore) createToken(ctx context.Context, userId int, purpose TokenPurpose, tokenHash string, expiresAt time.Time, interval time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	tx, err := t.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	// locking the user makes concurrent requests for their tokens take turns,
+	// so each one sees the token issued by the one before
+	if _, err = tx.ExecContext(ctx, `SELECT id FROM users WHERE id = $1 FOR UPDATE`, userId); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	query := `INSERT INTO user_tokens (user_id, purpose, token_hash, expires_at)
+				SELECT $1, $2, $3, $4
+				WHERE $5::float8 <= 0 OR NOT EXISTS (SELECT 1 FROM user_tokens WHERE user_id = $1 AND purpose = $2 AND created_at > NOW() - $5::float8 * INTERVAL '1 second')`
+	result, err := tx.ExecContext(ctx, query, userId, purpose, tokenHash, expiresAt, interval.Seconds())
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if rows == 0 {
+		tx.Rollback()
+		return ErrTokenRequestedTooSoon
+	}
+
+	if _, err = tx.ExecContext(ctx, `DELETE FROM user_tokens WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL AND token_hash <> $3`, userId, purpose, tokenHash); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return nil
+}
+
+// ConsumeToken redeems a token, returning the user it was issued to. Unknown,
+// expired and already used tokens are all reported as ErrUserTokenInvalid.
+func (t *UserTokenStore) ConsumeToken(ctx context.Context, purpose TokenPurpose, tokenHash string) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	return consumeToken(ctx, t.db.QueryRowContext, purpose, tokenHash)
+}
+
+// ResetPassword redeems a password reset token and sets the user's new
+// password hash, returning the user.
+func (t *UserTokenStore) ResetPassword(ctx context.Context, tokenHash, passwordHash string) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	tx, err := t.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	userId, err := consumeToken(ctx, tx.QueryRowContext, TokenPasswordReset, tokenHash)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	if _, err = tx.ExecContext(ctx, `UPDATE users SET password = $1 WHERE id = $2`, passwordHash, userId); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	return userId, nil
+}
+
+// VerifyEmail redeems an email verification token and marks the user's
+// email address as verified, returning the user.
+func (t *UserTokenStore) VerifyEmail(ctx context.Context, tokenHash string) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	tx, err := t.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	userId, err := consumeToken(ctx, tx.QueryRowContext, TokenEmailVerification, tokenHash)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	if _, err = tx.ExecContext(ctx, `UPDATE users SET email_verified_at = COALESCE(email_verified_at, NOW()) WHERE id = $1`, userId); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	return userId, nil
+}
+
+// RedeemMagicLink redeems a magic link login token, returning the user.
+// Opening the link proves the user owns their email address, so it is marked
+// as verified too.
+func (t *UserTokenStore) RedeemMagicLink(ctx context.Context, tokenHash string) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	tx, err := t.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	userId, err := consumeToken(ctx, tx.QueryRowContext, TokenMagicLink, tokenHash)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	if _, err = tx.ExecContext(ctx, `UPDATE users SET email_verified_at = COALESCE(email_verified_at, NOW()) WHERE id = $1`, userId); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	return userId, nil
+}
+
+// ConfirmEmailChange redeems an email change token and makes the user's
+// pending email address their verified email address, returning the user.
+// ErrEmailTaken is returned when another account took the address in the
+// meantime.
+func (t *UserTokenStore) ConfirmEmailChange(ctx context.Context, tokenHash string) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	tx, err := t.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	userId, err := consumeToken(ctx, tx.QueryRowContext, TokenEmailChange, tokenHash)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	query := `UPDATE users SET email = pending_email, pending_email = NULL, email_verified_at = NOW() WHERE id = $1 AND pending_email IS NOT NULL`
+	result, err := tx.ExecContext(ctx, query, userId)
+	if err != nil {
+		tx.Rollback()
+		if isUniqueViolation(err) {
+			return 0, ErrEmailTaken
+		}
+		return 0, err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	if rows == 0 {
+		tx.Rollback()
+		return 0, ErrUserTokenInvalid
+	}
+
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	return userId, nil
+}
+
+func consumeToken(ctx context.Context, queryRow func(context.Context, string, ...any) *sql.Row, purpose TokenPurpose, tokenHash string) (int, error) {
+	query := `UPDATE user_tokens SET used_at = NOW()
+				WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > NOW() RETURNING user_id`
+
+	var userId int
+	if err := queryRow(ctx, query, tokenHash, purpose).Scan(&userId); err != nil {
+		if err == sql.ErrNoRows {
+			return 0, ErrUserTokenInvalid
+		}
+		return 0, err
+	}
+	return userId, nil
+}
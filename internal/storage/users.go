@@ -2,6 +2,8 @@ package storage
 
 import (
 	"database/sql"
+	"fmt"
+	"time"
 
 	"golang.org/x/net/context"
 )
@@ -10,25 +12,98 @@ type UserStore struct {
 	db *sql.DB
 }
 
+// UserRole is a user's platform-wide role. It is unrelated to the roles a
+// user holds on individual events.
+type UserRole string
+
+const (
+	UserRoleUser      UserRole = "user"
+	UserRoleModerator UserRole = "moderator"
+	UserRoleAdmin     UserRole = "admin"
+)
+
+var userRoleRanks = map[UserRole]int{
+	UserRoleUser:      0,
+	UserRoleModerator: 1,
+	UserRoleAdmin:     2,
+}
+
+// AtLeast reports whether the role is the given role or a more privileged one.
+func (r UserRole) AtLeast(min UserRole) bool {
+	rank, ok := userRoleRanks[r]
+	return ok && rank >= userRoleRanks[min]
+}
+
+// UserStatus is whether a user may sign in.
+type UserStatus string
+
+const (
+	UserStatusActive    UserStatus = "active"
+	UserStatusSuspended UserStatus = "suspended"
+	UserStatusBanned    UserStatus = "banned"
+)
+
 type User struct {
-	ID       int    `json:"id"`
-	Name     string `json:"name"`
-	Email    string `json:"email"`
-	Password string `json:"_"`
+	ID             int        `json:"id"`
+	Name           string     `json:"name"`
+	Email          string     `json:"email"`
+	Password       string     `json:"-"`
+	Role           UserRole   `json:"role"`
+	Status         UserStatus `json:"status"`
+	StatusReason   *string    `json:"status_reason,omitempty"`
+	SuspendedUntil *time.Time `json:"suspended_until,omitempty"`
+	// EmailVerifiedAt is nil until the user confirms their email address
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	// PendingEmail replaces Email once the user confirms it
+	PendingEmail *string `json:"pending_email,omitempty"`
+	// TOTPEnabledAt is set while two-factor authentication is on
+	TOTPEnabledAt *time.Time      `json:"totp_enabled_at"`
+	Privacy       PrivacySettings `json:"privacy"`
+	CreatedAt     time.Time       `json:"created_at"`
+}
+
+// PrivacySettings control what other users see of the user. Event owners and
+// co-organizers always see their attendees in full.
+type PrivacySettings struct {
+	// ShowNameOnAttendeeLists shows the user's name to other attendees;
+	// otherwise they are listed anonymously
+	ShowNameOnAttendeeLists bool `json:"show_name_on_attendee_lists"`
+	// HideAttendance leaves the user out of attendee lists and hides the
+	// events they attend
+	HideAttendance bool `json:"hide_attendance"`
+}
+
+const userColumns = `id, name, email, password, role, status, status_reason, suspended_until, email_verified_at, pending_email, totp_enabled_at, show_name_on_attendee_lists, hide_attendance, created_at`
+
+func (u *User) fields() []any {
+	return []any{&u.ID, &u.Name, &u.Email, &u.Password, &u.Role, &u.Status, &u.StatusReason, &u.SuspendedUntil, &u.EmailVerifiedAt, &u.PendingEmail, &u.TOTPEnabledAt, &u.Privacy.ShowNameOnAttendeeLists, &u.Privacy.HideAttendance, &u.CreatedAt}
+}
+
+// Active reports whether the user may use the API. Suspensions with an end
+// date lapse on their own.
+func (u *User) Active(now time.Time) bool {
+	switch u.Status {
+	case UserStatusBanned:
+		return false
+	case UserStatusSuspended:
+		return u.SuspendedUntil != nil && !now.Before(*u.SuspendedUntil)
+	default:
+		return true
+	}
 }
 
 func (u *UserStore) CreateUser(ctx context.Context, user *User) error {
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
 	defer cancel()
 
-	query := `INSERT INTO users (name, email, password) VALUES ($1, $2, $3) RETURNING id, name, email`
+	query := `INSERT INTO users (name, email, password) VALUES ($1, $2, $3) RETURNING ` + userColumns
 
 	tx, err := u.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
 
-	if err = tx.QueryRowContext(ctx, query, user.Name, user.Email, user.Password).Scan(&user.ID, &user.Name, &user.Email); err != nil {
+	if err = tx.QueryRowContext(ctx, query, user.Name, user.Email, user.Password).Scan(user.fields()...); err != nil {
 		tx.Rollback()
 		return err
 	}
@@ -45,10 +120,10 @@ func (u *UserStore) GetUserByID(ctx context.Context, userId int) (*User, error)
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
 	defer cancel()
 
-	query := `SELECT id, name, email, password FROM users WHERE id = $1`
+	query := `SELECT ` + userColumns + ` FROM users WHERE id = $1`
 
 	user := &User{}
-	if err := u.db.QueryRowContext(ctx, query, userId).Scan(&user.ID, &user.Name, &user.Email, &user.Password); err != nil {
+	if err := u.db.QueryRowContext(ctx, query, userId).Scan(user.fields()...); err != nil {
 		if err == sql.ErrNoRows {
 			return nil, ErrUserNotFound
 		}
@@ -62,10 +137,10 @@ func (u *UserStore) GetUserByEmail(ctx context.Context, email string) (*User, er
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
 	defer cancel()
 
-	query := `SELECT id, name, email, password FROM users WHERE email = $1`
+	query := `SELECT ` + userColumns + ` FROM users WHERE email = $1`
 
 	user := &User{}
-	if err := u.db.QueryRowContext(ctx, query, email).Scan(&user.ID, &user.Name, &user.Email, &user.Password); err != nil {
+	if err := u.db.QueryRowContext(ctx, query, email).Scan(user.fields()...); err != nil {
 		if err == sql.ErrNoRows {
 			return nil, ErrUserNotFound
 		}
@@ -74,3 +149,247 @@ func (u *UserStore) GetUserByEmail(ctx context.Context, email string) (*User, er
 
 	return user, nil
 }
+
+// UserFilter narrows the user list, rendered over the users table aliased as
+// u. Query matches name or email case-insensitively.
+type UserFilter struct {
+	Query  string
+	Role   UserRole
+	Status UserStatus
+}
+
+func (f UserFilter) conditions(args *[]any) []string {
+	var conditions []string
+
+	if f.Query != "" {
+		*args = append(*args, "%"+escapeLike(f.Query)+"%")
+		conditions = append(conditions, fmt.Sprintf("(u.name ILIKE $%[1]d OR u.email ILIKE $%[1]d)", len(*args)))
+	}
+	if f.Role != "" {
+		*args = append(*args, f.Role)
+		conditions = append(conditions, fmt.Sprintf("u.role = $%d", len(*args)))
+	}
+	if f.Status != "" {
+		*args = append(*args, f.Status)
+		conditions = append(conditions, fmt.Sprintf("u.status = $%d", len(*args)))
+	}
+
+	return conditions
+}
+
+var userSortColumns = map[string]sortColumn{
+	"name":       {expr: "u.name"},
+	"email":      {expr: "u.email"},
+	"created_at": {expr: "u.created_at", cast: "::timestamptz"},
+	"id":         {expr: "u.id"},
+}
+
+func (u *UserStore) GetUsers(ctx context.Context, filter UserFilter, page PageParams) (*Page[User], error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	k, err := newKeyset(page, userSortColumns, "id", "u.id")
+	if err != nil {
+		return nil, err
+	}
+
+	var args []any
+	conditions := filter.conditions(&args)
+
+	total, err := countRows(ctx, u.db, `SELECT COUNT(*) FROM users u`+whereClause(conditions), args)
+	if err != nil {
+		return nil, err
+	}
+
+	if cond := k.condition(&args); cond != "" {
+		conditions = append(conditions, cond)
+	}
+
+	query := `SELECT ` + userColumns + ` FROM users u` + whereClause(conditions) + k.orderAndLimit()
+
+	users := []User{}
+
+	rows, err := u.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var user User
+		if err = rows.Scan(user.fields()...); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	users, next := nextCursor(k, users, func(user User) (string, int) {
+		switch k.params.Sort {
+		case "name":
+			return user.Name, user.ID
+		case "email":
+			return user.Email, user.ID
+		case "created_at":
+			return user.CreatedAt.Format(time.RFC3339Nano), user.ID
+		}
+		return "", user.ID
+	})
+
+	return &Page[User]{Data: users, NextCursor: next, Total: total}, nil
+}
+
+// SetStatus suspends, bans or reinstates the user. until only applies to
+// suspensions; a nil until suspends the user indefinitely.
+func (u *UserStore) SetStatus(ctx context.Context, userId int, status UserStatus, reason *string, until *time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	if status != UserStatusSuspended {
+		until = nil
+	}
+	if status == UserStatusActive {
+		reason = nil
+	}
+
+	result, err := u.db.ExecContext(ctx, `UPDATE users SET status = $1, status_reason = $2, suspended_until = $3 WHERE id = $4`, status, reason, until, userId)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+func (u *UserStore) SetRole(ctx context.Context, userId int, role UserRole) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	result, err := u.db.ExecContext(ctx, `UPDATE users SET role = $1 WHERE id = $2`, role, userId)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+// UpdateProfile changes the user's name and pending email address, leaving
+// those that are nil as they are.
+func (u *UserStore) UpdateProfile(ctx context.Context, userId int, name, pendingEmail *string) (*User, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	query := `UPDATE users SET name = COALESCE($1, name), pending_email = COALESCE($2, pending_email) WHERE id = $3 RETURNING ` + userColumns
+
+	user := &User{}
+	if err := u.db.QueryRowContext(ctx, query, name, pendingEmail, userId).Scan(user.fields()...); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (u *UserStore) UpdatePassword(ctx context.Context, userId int, passwordHash string) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	result, err := u.db.ExecContext(ctx, `UPDATE users SET password = $1 WHERE id = $2`, passwordHash, userId)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+// DeleteUser deletes the user together with the events they own and
+// everything else that belongs to them.
+func (u *UserStore) DeleteUser(ctx context.Context, userId int) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	result, err := u.db.ExecContext(ctx, `DELETE FROM users WHERE id = $1`, userId)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+func (u *UserStore) UpdatePrivacy(ctx context.Context, userId int, settings PrivacySettings) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	query := `UPDATE users SET show_name_on_attendee_lists = $1, hide_attendance = $2 WHERE id = $3`
+
+	result, err := u.db.ExecContext(ctx, query, settings.ShowNameOnAttendeeLists, settings.HideAttendance, userId)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+// IsOrganizerOfAttendee reports whether the organizer owns or co-organizes an
+// event the user attends, which lets them see the user in full.
+func (u *UserStore) IsOrganizerOfAttendee(ctx context.Context, organizerId, userId int) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	query := `SELECT EXISTS (SELECT 1 FROM attendees a JOIN event_roles r ON r.event_id = a.event_id
+				WHERE a.user_id = $1 AND r.user_id = $2 AND r.role IN ('owner', 'co_organizer'))`
+
+	var ok bool
+	if err := u.db.QueryRowContext(ctx, query, userId, organizerId).Scan(&ok); err != nil {
+		return false, err
+	}
+	return ok, nil
+}
@@ -0,0 +1,217 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+type WaitlistStore struct {
+	db *sql.DB
+}
+
+// WaitlistEntry is a place on the waitlist. Each occurrence of a recurring
+// event has its own waitlist, identified by OccurrenceStart.
+type WaitlistEntry struct {
+	ID              int        `json:"id"`
+	UserID          int        `json:"user_id"`
+	EventID         int        `json:"event_id"`
+	OccurrenceStart *time.Time `json:"occurrence_start,omitempty"`
+	Position        int        `json:"position"`
+	CreatedAt       time.Time  `json:"created_at"`
+}
+
+// occurrenceConflictTarget matches the unique indexes on attendees and
+// waitlist, which treat a NULL occurrence as a value of its own.
+const occurrenceConflictTarget = `(event_id, user_id, (COALESCE(occurrence_start, '-infinity'::timestamptz)))`
+
+// GetWaitlistByEvent lists the event's waitlist in order. A nil occurrence
+// lists the waitlists of every occurrence.
+func (w *WaitlistStore) GetWaitlistByEvent(ctx context.Context, eventId int, occurrence *time.Time) (*[]WaitlistEntry, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	query := `SELECT id, user_id, event_id, occurrence_start, created_at,
+				ROW_NUMBER() OVER (PARTITION BY occurrence_start ORDER BY created_at, id) AS position
+				FROM waitlist WHERE event_id = $1 AND ($2::timestamptz IS NULL OR occurrence_start = $2)
+				ORDER BY occurrence_start NULLS FIRST, created_at, id`
+
+	var entries []WaitlistEntry
+
+	rows, err := w.db.QueryContext(ctx, query, eventId, occurrence)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var entry WaitlistEntry
+		if err = rows.Scan(&entry.ID, &entry.UserID, &entry.EventID, &entry.OccurrenceStart, &entry.CreatedAt, &entry.Position); err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return &entries, nil
+}
+
+func (w *WaitlistStore) GetWaitlistEntry(ctx context.Context, eventId, userId int, occurrence *time.Time) (*WaitlistEntry, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	return getWaitlistEntry(ctx, w.db, eventId, userId, occurrence)
+}
+
+func (w *WaitlistStore) DeleteFromWaitlist(ctx context.Context, eventId, userId int, occurrence *time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOutDuration)
+	defer cancel()
+
+	query := `DELETE FROM waitlist WHERE event_id = $1 AND user_id = $2 AND occurrence_start IS NOT DISTINCT FROM $3`
+
+	result, err := w.db.ExecContext(ctx, query, eventId, userId, occurrence)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrWaitlistEntryNotFound
+	}
+
+	return nil
+}
+
+// queryRower is satisfied by both *sql.DB and *sql.Tx.
+type queryRower interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+func getWaitlistEntry(ctx context.Context, q queryRower, eventId, userId int, occurrence *time.Time) (*WaitlistEntry, error) {
+	query := `SELECT id, user_id, event_id, occurrence_start, created_at, position FROM (
+				SELECT id, user_id, event_id, occurrence_start, created_at, ROW_NUMBER() OVER (ORDER BY created_at, id) AS position
+				FROM waitlist WHERE event_id = $1 AND occurrence_start IS NOT DISTINCT FROM $3
+			) w WHERE user_id = $2`
+
+	entry := &WaitlistEntry{}
+	err := q.QueryRowContext(ctx, query, eventId, userId, occurrence).Scan(&entry.ID, &entry.UserID, &entry.EventID, &entry.OccurrenceStart, &entry.CreatedAt, &entry.Position)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrWaitlistEntryNotFound
+		}
+		return nil, err
+	}
+
+	return entry, nil
+}
+
+// lockEventForAttendance locks the event row for the rest of the transaction
+// and reports whether the event, or the given occurrence of a recurring
+// event, has reached its capacity. Every path that adds or removes attendees
+// goes through this lock, which serialises concurrent sign-ups for the same
+// event.
+func lockEventForAttendance(ctx context.Context, tx *sql.Tx, eventId int, occurrence *time.Time) (bool, error) {
+	var capacity sql.NullInt64
+	if err := tx.QueryRowContext(ctx, `SELECT capacity FROM events WHERE id = $1 FOR UPDATE`, eventId).Scan(&capacity); err != nil {
+		if err == sql.ErrNoRows {
+			return false, ErrEventNotFound
+		}
+		return false, err
+	}
+
+	if !capacity.Valid {
+		return false, nil
+	}
+
+	var count int
+	query := `SELECT COUNT(*) FROM attendees WHERE event_id = $1 AND occurrence_start IS NOT DISTINCT FROM $2 AND status = 'going'`
+	if err := tx.QueryRowContext(ctx, query, eventId, occurrence).Scan(&count); err != nil {
+		return false, err
+	}
+
+	return count >= int(capacity.Int64), nil
+}
+
+func addToWaitlist(ctx context.Context, tx *sql.Tx, eventId, userId int, occurrence *time.Time) (*WaitlistEntry, error) {
+	query := `INSERT INTO waitlist (user_id, event_id, occurrence_start) VALUES ($1, $2, $3)`
+
+	if _, err := tx.ExecContext(ctx, query, userId, eventId, occurrence); err != nil {
+		return nil, err
+	}
+
+	return getWaitlistEntry(ctx, tx, eventId, userId, occurrence)
+}
+
+// promoteFromWaitlist moves people from the head of the waitlist into the
+// attendees table until the event is full again or the waitlist is empty. The
+// caller must already hold the event row lock.
+func promoteFromWaitlist(ctx context.Context, tx *sql.Tx, eventId int, occurrence *time.Time) error {
+	for {
+		full, err := lockEventForAttendance(ctx, tx, eventId, occurrence)
+		if err != nil {
+			return err
+		}
+		if full {
+			return nil
+		}
+
+		query := `DELETE FROM waitlist WHERE id = (
+					SELECT id FROM waitlist WHERE event_id = $1 AND occurrence_start IS NOT DISTINCT FROM $2 ORDER BY created_at, id LIMIT 1
+				) RETURNING user_id`
+
+		var userId int
+		if err := tx.QueryRowContext(ctx, query, eventId, occurrence).Scan(&userId); err != nil {
+			if err == sql.ErrNoRows {
+				return nil
+			}
+			return err
+		}
+
+		// a promoted user may already hold a maybe or declined RSVP
+		query = `INSERT INTO attendees (user_id, event_id, occurrence_start, status) VALUES ($1, $2, $3, 'going')
+					ON CONFLICT ` + occurrenceConflictTarget + ` DO UPDATE SET status = 'going'`
+
+		if _, err := tx.ExecContext(ctx, query, userId, eventId, occurrence); err != nil {
+			return err
+		}
+	}
+}
+
+// promoteAllFromWaitlist runs promoteFromWaitlist for every occurrence of the
+// event that has a waitlist.
+func promoteAllFromWaitlist(ctx context.Context, tx *sql.Tx, eventId int) error {
+	rows, err := tx.QueryContext(ctx, `SELECT DISTINCT occurrence_start FROM waitlist WHERE event_id = $1`, eventId)
+	if err != nil {
+		return err
+	}
+
+	var occurrences []*time.Time
+	for rows.Next() {
+		var occurrence *time.Time
+		if err := rows.Scan(&occurrence); err != nil {
+			rows.Close()
+			return err
+		}
+		occurrences = append(occurrences, occurrence)
+	}
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, occurrence := range occurrences {
+		if err := promoteFromWaitlist(ctx, tx, eventId, occurrence); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}